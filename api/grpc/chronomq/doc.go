@@ -0,0 +1,5 @@
+// Package chronomq holds the gRPC service definition of the Chronomq server along with the generated
+// client and server code. Regenerate it with protoc and protoc-gen-go v1.3.x after changing chronomq.proto
+package chronomq
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. chronomq.proto
@@ -0,0 +1,460 @@
+package chronomq
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	uuid "github.com/satori/go.uuid"
+)
+
+// clusterPollInterval is how long Next of a cluster client waits for a job on one server
+// before it looks at all servers again
+const clusterPollInterval = time.Millisecond * 100
+
+// rebalanceBatch is the number of jobs Rebalance fetches from a server at once
+const rebalanceBatch = 100
+
+// ErrNoServers is returned when creating a cluster client without servers
+var ErrNoServers = errors.New("No servers given")
+
+// UnownedArgs are the arguments of an Unowned call
+type UnownedArgs struct {
+	Queue string
+	Nodes []string // Nodes of the cluster to compute the owners of jobs on
+	Self  string   // The node of the called server. Jobs owned by any other node are returned
+	N     int
+	After string // Only jobs with greater ids are returned, e.g. the id of the last job of the previous batch
+}
+
+// ClusterClient communicates with the servers of a sharded cluster. Every job lives on the server that owns
+// its id on a Ring of the servers' addresses. Calls for a job go to its owner and Next takes jobs from all servers.
+// Servers of a cluster are independent Chronomq servers, the cluster only exists in its clients.
+// Once connected, a client may be used by multiple goroutines simultaneously
+type ClusterClient struct {
+	ring    *Ring
+	servers map[string]*Client // Clients of the servers by address
+	queue   string             // Queue jobs are put into, canceled from and acknowledged in. Empty means the default queue
+	watch   []string           // Queues Next takes jobs from. Empty means the used queue
+	rr      *uint32            // Rotates the server Next looks at first. Shared with the clients created with Use and Watch
+}
+
+// NewClusterClient connects to all servers of a cluster. Every client of a cluster must be created with the same
+// addresses, in any order, so that they agree on the owners of jobs
+func NewClusterClient(addrs ...string) (*ClusterClient, error) {
+	if len(addrs) == 0 {
+		return nil, ErrNoServers
+	}
+	c := &ClusterClient{ring: NewRing(addrs...), servers: make(map[string]*Client, len(addrs)), rr: new(uint32)}
+	for _, addr := range c.ring.Nodes() {
+		client, err := NewClient(addr)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.servers[addr] = client
+	}
+	return c, nil
+}
+
+// Use returns a cluster client sharing this client's connections that puts, cancels and acknowledges jobs in the
+// given queue and takes jobs only from that queue. An empty name means the default queue
+func (c *ClusterClient) Use(queue string) *ClusterClient {
+	return &ClusterClient{ring: c.ring, servers: c.servers, queue: queue, rr: c.rr}
+}
+
+// Watch returns a cluster client sharing this client's connections whose Next takes jobs from any of the given queues
+func (c *ClusterClient) Watch(queues ...string) *ClusterClient {
+	return &ClusterClient{ring: c.ring, servers: c.servers, queue: c.queue, watch: queues, rr: c.rr}
+}
+
+// Ring returns the ring that assigns jobs to the servers of the cluster
+func (c *ClusterClient) Ring() *Ring {
+	return c.ring
+}
+
+// server returns the client of the server with the given address for the client's queues
+func (c *ClusterClient) server(addr string) *Client {
+	return c.servers[addr].Use(c.queue).Watch(c.watch...)
+}
+
+// Owner returns the address of the server that owns the job with the given id
+func (c *ClusterClient) Owner(id string) string {
+	return c.ring.Owner(id)
+}
+
+// onJob calls f with the client of the server that owns the job. The other servers are tried in order if
+// the owner doesn't hold the job - it may not have been moved to its owner yet while the cluster is rebalanced
+func (c *ClusterClient) onJob(id string, f func(*Client) error) error {
+	owner := c.ring.Owner(id)
+	err := f(c.server(owner))
+	if !notHeld(err) {
+		return err
+	}
+	for _, addr := range c.ring.Nodes() {
+		if addr == owner {
+			continue
+		}
+		if serr := f(c.server(addr)); !notHeld(serr) {
+			return serr
+		}
+	}
+	return err
+}
+
+// notHeld returns true for the errors of servers that don't hold a job
+func notHeld(err error) bool {
+	return errors.Is(err, ErrJobNotFound) || errors.Is(err, ErrJobNotReserved)
+}
+
+// PutWithID saves a job on the server that owns the id
+func (c *ClusterClient) PutWithID(id string, body []byte, delay time.Duration, opts ...PutOpt) error {
+	return c.server(c.ring.Owner(id)).PutWithID(id, body, delay, opts...)
+}
+
+// PutAtWithID saves a job on the server that owns the id to be triggered at the given time
+func (c *ClusterClient) PutAtWithID(id string, body []byte, triggerAt time.Time, opts ...PutOpt) error {
+	return c.server(c.ring.Owner(id)).PutAtWithID(id, body, triggerAt, opts...)
+}
+
+// Put saves a job with a random id and returns the id. The id is generated by the client to find the job's server
+func (c *ClusterClient) Put(body []byte, delay time.Duration, opts ...PutOpt) (string, error) {
+	id := uuid.NewV4().String()
+	return id, c.PutWithID(id, body, delay, opts...)
+}
+
+// PutAt saves a job with a random id to be triggered at the given time and returns the id
+func (c *ClusterClient) PutAt(body []byte, triggerAt time.Time, opts ...PutOpt) (string, error) {
+	id := uuid.NewV4().String()
+	return id, c.PutAtWithID(id, body, triggerAt, opts...)
+}
+
+// Get returns the job with the given id along with its state
+func (c *ClusterClient) Get(id string) (job *Job, err error) {
+	err = c.onJob(id, func(s *Client) error {
+		job, err = s.Get(id)
+		return err
+	})
+	return job, err
+}
+
+// Cancel deletes a job identified by the given id. Calls to cancel are idempotent, canceling a job that no server
+// holds is not an error
+func (c *ClusterClient) Cancel(id string) error {
+	err := c.onJob(id, func(s *Client) error {
+		canceled, err := s.CancelBatch([]string{id})
+		if err == nil && !canceled[0] {
+			return ErrJobNotFound
+		}
+		return err
+	})
+	if errors.Is(err, ErrJobNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Reschedule moves a pending job to a new trigger time
+func (c *ClusterClient) Reschedule(id string, triggerAt time.Time) error {
+	return c.onJob(id, func(s *Client) error {
+		return s.Reschedule(id, triggerAt)
+	})
+}
+
+// UpdateBody replaces the body of a pending job
+func (c *ClusterClient) UpdateBody(id string, body []byte) error {
+	return c.onJob(id, func(s *Client) error {
+		return s.UpdateBody(id, body)
+	})
+}
+
+// Ack deletes a reserved job once it has been worked on
+func (c *ClusterClient) Ack(id string) error {
+	return c.onJob(id, func(s *Client) error {
+		return s.Ack(id)
+	})
+}
+
+// Release puts a reserved job back into the queue to be ready again after delay
+func (c *ClusterClient) Release(id string, delay time.Duration) error {
+	return c.onJob(id, func(s *Client) error {
+		return s.Release(id, delay)
+	})
+}
+
+// Touch restarts the TTR of a reserved job
+func (c *ClusterClient) Touch(id string) error {
+	return c.onJob(id, func(s *Client) error {
+		return s.Touch(id)
+	})
+}
+
+// Nack fails a reserved job. Returns true if the job was dead-lettered
+func (c *ClusterClient) Nack(id string) (dead bool, err error) {
+	err = c.onJob(id, func(s *Client) error {
+		dead, err = s.Nack(id)
+		return err
+	})
+	return dead, err
+}
+
+// CancelByTag deletes the jobs with the given tag on all servers. Returns the number of deleted jobs
+func (c *ClusterClient) CancelByTag(tag string) (int, error) {
+	total := 0
+	for _, addr := range c.ring.Nodes() {
+		canceled, err := c.server(addr).CancelByTag(tag)
+		if err != nil {
+			return total, err
+		}
+		total += canceled
+	}
+	return total, nil
+}
+
+// CancelByPrefix deletes the jobs whose id starts with the given prefix on all servers.
+// Returns the number of deleted jobs
+func (c *ClusterClient) CancelByPrefix(prefix string) (int, error) {
+	total := 0
+	for _, addr := range c.ring.Nodes() {
+		canceled, err := c.server(addr).CancelByPrefix(prefix)
+		if err != nil {
+			return total, err
+		}
+		total += canceled
+	}
+	return total, nil
+}
+
+// Queues lists the names of the queues of all servers
+func (c *ClusterClient) Queues() ([]string, error) {
+	names := map[string]bool{}
+	for _, addr := range c.ring.Nodes() {
+		queues, err := c.server(addr).Queues()
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range queues {
+			names[q] = true
+		}
+	}
+	queues := make([]string, 0, len(names))
+	for q := range names {
+		queues = append(queues, q)
+	}
+	sort.Strings(queues)
+	return queues, nil
+}
+
+// rotated returns the clients of all servers, starting with a different server on every call
+// so that no server starves
+func (c *ClusterClient) rotated() []*Client {
+	nodes := c.ring.Nodes()
+	start := int(atomic.AddUint32(c.rr, 1))
+	servers := make([]*Client, len(nodes))
+	for i := range nodes {
+		servers[i] = c.server(nodes[(start+i)%len(nodes)])
+	}
+	return servers
+}
+
+// Next waits at-most timeout duration to return a ready job body from any server
+func (c *ClusterClient) Next(timeout time.Duration) (string, []byte, error) {
+	job, err := c.NextJob(timeout)
+	if err != nil {
+		return "", nil, err
+	}
+	return job.ID, job.Body, nil
+}
+
+// NextJob is like Next but returns the full job. Jobs are only taken from one server at a time, so no job
+// is taken that isn't returned. While no server has a ready job, the client waits on one server at a time
+// for clusterPollInterval, so jobs of the other servers are returned up to that late
+func (c *ClusterClient) NextJob(timeout time.Duration) (*Job, error) {
+	var job *Job
+	err := c.poll(timeout, func(s *Client, wait time.Duration) (err error) {
+		job, err = s.NextJob(wait)
+		return err
+	})
+	return job, err
+}
+
+// NextN waits at-most timeout duration for jobs to be ready on any server and returns up to n of them
+func (c *ClusterClient) NextN(n int, timeout time.Duration) ([]*Job, error) {
+	var jobs []*Job
+	err := c.poll(timeout, func(s *Client, wait time.Duration) error {
+		if len(jobs) > 0 && wait > 0 {
+			// Found fewer than n jobs on all servers, don't wait for more
+			return nil
+		}
+		next, err := s.NextN(n-len(jobs), wait)
+		jobs = append(jobs, next...)
+		if err == nil && len(jobs) < n && wait == 0 {
+			// Look for more on the other servers
+			return ErrTimeout
+		}
+		return err
+	})
+	if len(jobs) > 0 {
+		return jobs, nil
+	}
+	return nil, err
+}
+
+// poll calls take with every server without waiting till it succeeds. If no server has ready jobs, it calls
+// take with one server waiting for a ready job. It returns ErrTimeout once the timeout passed
+func (c *ClusterClient) poll(timeout time.Duration, take func(s *Client, wait time.Duration) error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		servers := c.rotated()
+		for _, s := range servers {
+			if err := take(s, 0); !errors.Is(err, ErrTimeout) {
+				return err
+			}
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return ErrTimeout
+		}
+		if wait > clusterPollInterval {
+			wait = clusterPollInterval
+		}
+		if err := take(servers[0], wait); !errors.Is(err, ErrTimeout) {
+			return err
+		}
+	}
+}
+
+// Ping all servers of the cluster
+func (c *ClusterClient) Ping() error {
+	for _, addr := range c.ring.Nodes() {
+		if err := c.servers[addr].Ping(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close the connections to all servers. Clients created with Use or Watch share the connections and are closed too
+func (c *ClusterClient) Close() error {
+	var err error
+	for _, s := range c.servers {
+		if cerr := s.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Rebalance moves pending jobs between the servers of a cluster that changes from the servers in from to the
+// servers in to, e.g. after adding a server. Every pending job of a server in from that is owned by another server
+// on the ring of to is put into its owner and then canceled on the server in from. Clients of the new cluster find
+// jobs that are not moved yet, so they can be used while the cluster is rebalanced.
+// Reserved and dead-lettered jobs stay where they are, as do the attempts of moved jobs. A job that is consumed
+// on its old server while it is moved is canceled again on its new server, but may be handed out by both.
+// Returns the number of moved jobs
+func Rebalance(from []string, to []string) (int, error) {
+	c, err := NewClusterClient(to...)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	moved := 0
+	for _, addr := range NewRing(from...).Nodes() {
+		src, ok := c.servers[addr]
+		if !ok {
+			// A removed server
+			if src, err = NewClient(addr); err != nil {
+				return moved, err
+			}
+			defer src.Close()
+		}
+		queues, err := src.Queues()
+		if err != nil {
+			return moved, err
+		}
+		for _, queue := range queues {
+			n, err := c.Use(queue).rebalanceQueue(src.Use(queue), addr)
+			moved += n
+			if err != nil {
+				return moved, err
+			}
+			log.Info().Str("server", addr).Str("queue", queue).Int("moved", n).Msg("Rebalanced queue")
+		}
+	}
+	return moved, nil
+}
+
+// rebalanceQueue moves the jobs of a queue of the server src at addr that it doesn't own to their owners.
+// Returns the number of moved jobs
+func (c *ClusterClient) rebalanceQueue(src *Client, addr string) (int, error) {
+	moved := 0
+	args := &UnownedArgs{Queue: c.queue, Nodes: c.ring.Nodes(), Self: addr, N: rebalanceBatch}
+	for {
+		var jobs []*Job
+		if err := src.call("RPCServer.Unowned", args, &jobs); err != nil {
+			return moved, err
+		}
+		if len(jobs) == 0 {
+			return moved, nil
+		}
+		for _, job := range jobs {
+			ok, err := c.move(src, job)
+			if err != nil {
+				return moved, err
+			}
+			if ok {
+				moved++
+			}
+		}
+		args.After = jobs[len(jobs)-1].ID
+	}
+}
+
+// move puts a job of src into its owner and then cancels it on src. Jobs that expire before they are put are
+// left to src, which drops or dead-letters them. Returns true if the job was moved
+func (c *ClusterClient) move(src *Client, job *Job) (bool, error) {
+	j := Job{
+		ID:          job.ID,
+		Body:        job.Body,
+		TriggerAt:   job.TriggerAt,
+		TTR:         job.TTR,
+		Pri:         job.Pri,
+		Queue:       c.queue,
+		Cron:        job.Cron,
+		Timezone:    job.Timezone,
+		Until:       job.Until,
+		OnDuplicate: DuplicateReplace, // A copy left by an interrupted rebalance
+		ExpireAt:    job.ExpireAt,
+		Tags:        job.Tags,
+		Headers:     job.Headers,
+	}
+	if j.Cron != "" {
+		// Recurring jobs start at the first occurrence after their trigger time, which is the pending occurrence
+		j.TriggerAt = j.TriggerAt.Add(-time.Nanosecond)
+	} else if j.TriggerAt.Before(time.Now()) {
+		// Ready already. Jobs may be overdue for longer than the server accepts
+		j.TriggerAt = time.Time{}
+	}
+
+	dst := c.server(c.ring.Owner(job.ID))
+	var id string
+	if err := dst.call("RPCServer.PutWithID", &j, &id); err != nil {
+		if errors.Is(err, ErrInvalidExpiry) && !job.ExpireAt.IsZero() && !job.ExpireAt.After(time.Now()) {
+			log.Debug().Str("jobID", job.ID).Msg("Job expired while moved")
+			return false, nil
+		}
+		return false, err
+	}
+	canceled, err := src.CancelBatch([]string{job.ID})
+	if err != nil {
+		return false, err
+	}
+	if !canceled[0] {
+		log.Debug().Str("jobID", job.ID).Msg("Job consumed while moved")
+		return false, dst.Cancel(job.ID)
+	}
+	return true, nil
+}
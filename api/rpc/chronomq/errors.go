@@ -0,0 +1,111 @@
+package chronomq
+
+import (
+	"net/rpc"
+	"strings"
+)
+
+// ErrorCode tells errors returned by the server apart without parsing their messages
+type ErrorCode string
+
+// Codes of the errors returned by the server
+const (
+	CodeJobExists              ErrorCode = "job_exists"
+	CodeJobNotFound            ErrorCode = "job_not_found"
+	CodeJobNotReserved         ErrorCode = "job_not_reserved"
+	CodeJobNotDead             ErrorCode = "job_not_dead"
+	CodeTimeout                ErrorCode = "timeout"
+	CodeInvalidQueueName       ErrorCode = "invalid_queue_name"
+	CodeUnknownQueue           ErrorCode = "unknown_queue"
+	CodeInvalidTriggerAt       ErrorCode = "invalid_trigger_at"
+	CodeDelayAndTriggerAt      ErrorCode = "delay_and_trigger_at"
+	CodeNoOccurrence           ErrorCode = "no_occurrence"
+	CodeInvalidDuplicatePolicy ErrorCode = "invalid_duplicate_policy"
+	CodeInvalidExpiry          ErrorCode = "invalid_expiry"
+	CodeNotLeader              ErrorCode = "not_leader"
+	CodeNotStandby             ErrorCode = "not_standby"
+)
+
+// Error is an error returned by the server. Compare errors with errors.Is and the Err variables of this package,
+// errors with the same code match regardless of their message:
+//
+//	if errors.Is(err, chronomq.ErrJobExists) { ... }
+type Error struct {
+	Code    ErrorCode
+	Message string // The error message of the server
+	Leader  string // Address of the leader for CodeNotLeader errors. Empty if the server doesn't know the leader
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is returns true if target is an *Error with the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Errors returned by the server. Their messages are the messages of the server's errors
+var (
+	// ErrJobExists is returned when putting a job with the id of an existing or recently consumed job
+	ErrJobExists = &Error{Code: CodeJobExists, Message: "Job already exists"}
+	// ErrJobNotFound is returned for jobs that have been consumed or canceled or that are not in the needed state
+	ErrJobNotFound = &Error{Code: CodeJobNotFound, Message: "Job not found"}
+	// ErrJobNotReserved is returned when acknowledging, releasing, touching or failing a job that is not reserved
+	ErrJobNotReserved = &Error{Code: CodeJobNotReserved, Message: "Job is not reserved"}
+	// ErrJobNotDead is returned for jobs that are not in the dead-letter store
+	ErrJobNotDead = &Error{Code: CodeJobNotDead, Message: "Job is not in the dead-letter store"}
+	// ErrTimeout is returned when no job was ready within the timeout
+	ErrTimeout = &Error{Code: CodeTimeout, Message: "No new jobs available in given timeout"}
+	// ErrInvalidQueueName is returned for queue names the server can't store
+	ErrInvalidQueueName = &Error{Code: CodeInvalidQueueName,
+		Message: "Queue names must be 1-128 letters, digits, '_', '-' or '.' and cannot start with '.'"}
+	// ErrUnknownQueue is returned when a queue does not exist and cannot be created
+	ErrUnknownQueue = &Error{Code: CodeUnknownQueue, Message: "Queue does not exist"}
+	// ErrInvalidTriggerAt is returned for trigger times too far in the past or the future
+	ErrInvalidTriggerAt = &Error{Code: CodeInvalidTriggerAt, Message: "Trigger time is too far in the past or the future"}
+	// ErrDelayAndTriggerAt is returned for jobs with both a delay and a trigger time
+	ErrDelayAndTriggerAt = &Error{Code: CodeDelayAndTriggerAt, Message: "Set either a delay or a trigger time"}
+	// ErrNoOccurrence is returned for recurring jobs whose schedule ends before their first occurrence
+	ErrNoOccurrence = &Error{Code: CodeNoOccurrence, Message: "Schedule has no occurrence before its end"}
+	// ErrInvalidDuplicatePolicy is returned for unknown duplicate policies
+	ErrInvalidDuplicatePolicy = &Error{Code: CodeInvalidDuplicatePolicy, Message: "Unknown duplicate policy"}
+	// ErrInvalidExpiry is returned for jobs that would expire before they trigger
+	ErrInvalidExpiry = &Error{Code: CodeInvalidExpiry, Message: "Expiry must be after the trigger time"}
+	// ErrNotLeader is returned by servers of a replicated cluster that are not the leader. Clients follow redirects
+	// to the leader, so it is only returned while no leader is elected
+	ErrNotLeader = &Error{Code: CodeNotLeader, Message: "Not the leader"}
+	// ErrNotStandby is returned when promoting a server that is not a standby replica
+	ErrNotStandby = &Error{Code: CodeNotStandby, Message: "Not a standby replica"}
+)
+
+var serverErrors = []*Error{
+	ErrJobExists, ErrJobNotFound, ErrJobNotReserved, ErrJobNotDead, ErrTimeout, ErrInvalidQueueName, ErrUnknownQueue,
+	ErrInvalidTriggerAt, ErrDelayAndTriggerAt, ErrNoOccurrence, ErrInvalidDuplicatePolicy,
+	ErrInvalidExpiry, ErrNotLeader, ErrNotStandby,
+}
+
+// leaderPrefix starts the messages of ErrNotLeader errors that name the leader: "Leader at <addr>: Not the leader"
+const leaderPrefix = "Leader at "
+
+// toError converts an error returned by the server into an *Error if its cause is known.
+// net/rpc only transfers error messages and the server's messages end with the message of their cause
+func toError(err error) error {
+	serverErr, ok := err.(rpc.ServerError)
+	if !ok {
+		return err
+	}
+	msg := string(serverErr)
+	for _, e := range serverErrors {
+		if !strings.HasSuffix(msg, e.Message) {
+			continue
+		}
+		err := &Error{Code: e.Code, Message: msg}
+		if e.Code == CodeNotLeader && strings.HasPrefix(msg, leaderPrefix) {
+			err.Leader = strings.TrimSuffix(strings.TrimPrefix(msg, leaderPrefix), ": "+e.Message)
+		}
+		return err
+	}
+	return err
+}
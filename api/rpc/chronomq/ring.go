@@ -0,0 +1,75 @@
+package chronomq
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// ringReplicas is the number of points every node has on a ring. More points spread the jobs more evenly
+const ringReplicas = 128
+
+// Ring assigns job ids to the nodes of a sharded cluster by consistent hashing. Adding a node to a ring of
+// n nodes only moves about 1/(n+1) of the ids to the new node, all other ids keep their owner.
+// The owners only depend on the set of nodes, not on their order
+type Ring struct {
+	nodes  []string
+	points []ringPoint // Sorted by hash
+}
+
+type ringPoint struct {
+	hash uint64
+	node string
+}
+
+// NewRing creates a ring of the given nodes, usually their rpc addresses. Repeated nodes are ignored
+func NewRing(nodes ...string) *Ring {
+	r := &Ring{}
+	seen := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		r.nodes = append(r.nodes, node)
+		for i := 0; i < ringReplicas; i++ {
+			r.points = append(r.points, ringPoint{hash: ringHash(node + "#" + strconv.Itoa(i)), node: node})
+		}
+	}
+	sort.Strings(r.nodes)
+	sort.Slice(r.points, func(i, k int) bool {
+		if r.points[i].hash == r.points[k].hash {
+			return r.points[i].node < r.points[k].node
+		}
+		return r.points[i].hash < r.points[k].hash
+	})
+	return r
+}
+
+// ringHash hashes ids and node points. md5 spreads similar keys like job-1 and job-2 evenly, unlike the fast
+// non-cryptographic hashes
+func ringHash(key string) uint64 {
+	sum := md5.Sum([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// Nodes returns the nodes of the ring in order
+func (r *Ring) Nodes() []string {
+	return r.nodes
+}
+
+// Owner returns the node that owns the job with the given id or "" if the ring has no nodes
+func (r *Ring) Owner(id string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	hash := ringHash(id)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= hash
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].node
+}
@@ -3,6 +3,7 @@ package chronomq
 import (
 	"errors"
 	"net/rpc"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -11,9 +12,44 @@ import (
 // ErrClientDisconnected means a client was used while it was disconnected from the remote server
 var ErrClientDisconnected = errors.New("Client is not connected to the server")
 
+// maxRedirects is how often a call follows redirects to the leader of a replicated cluster before giving up
+const maxRedirects = 3
+
 // Client communicates with the Chronomq RPC server
 type Client struct {
+	conn  *conn
+	queue string   // Queue jobs are put into, canceled from and acknowledged in. Empty means the default queue
+	watch []string // Queues Next takes jobs from. Empty means the used queue
+}
+
+// conn is the connection shared by a client and the clients created from it with Use and Watch.
+// It is replaced when a server of a replicated cluster redirects the client to the leader
+type conn struct {
 	client *rpc.Client
+	lock   *sync.RWMutex
+}
+
+func (cn *conn) get() *rpc.Client {
+	cn.lock.RLock()
+	defer cn.lock.RUnlock()
+	return cn.client
+}
+
+// redirect replaces the connection to a server that is not the leader with a connection to the leader.
+// Nothing is done if another call has replaced the connection already
+func (cn *conn) redirect(from *rpc.Client, addr string) error {
+	cn.lock.Lock()
+	defer cn.lock.Unlock()
+	if cn.client != from {
+		return nil
+	}
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	from.Close()
+	cn.client = client
+	return nil
 }
 
 // Job is a light wrapper struct representing job data on the wire without extra metadata that is stored internally
@@ -21,6 +57,143 @@ type Job struct {
 	Body  []byte
 	ID    string
 	Delay time.Duration
+	TTR   time.Duration // Time-to-run of a reserved job. Zero means the job is not reserved when dequeued
+	Pri   int32         // Priority among jobs ready at the same time. Higher priority jobs are dequeued first
+	Queue string        // Name of the queue the job belongs to. Empty means the default queue
+	// Absolute trigger time. Set either TriggerAt or Delay. Unlike Delay, it isn't shifted by network latency
+	TriggerAt time.Time
+	Attempts  int32     // Number of times consumers failed the job with Nack. Set by the server
+	DeadAt    time.Time // When the job was moved to the dead-letter store. Set by the server for dead-lettered jobs
+	// Cron expression of a recurring job. The job first triggers at the first occurrence after its delay or trigger time
+	Cron        string
+	Timezone    string          // IANA timezone the cron expression is evaluated in. Empty means UTC
+	Until       time.Time       // When a recurring job stops recurring. Zero means never
+	Occurrences []time.Time     // Next trigger times of a recurring job. Set by the server when inspecting jobs
+	State       string          // Whether the job is pending, reserved or dead. Set by the server by Get
+	OnDuplicate DuplicatePolicy // What to do if a job with the same id exists. Rejected by default
+	// When the job expires if it hasn't been consumed. Expired jobs are never handed out. Zero means never
+	ExpireAt time.Time
+	Tags     []string // Labels to cancel jobs by with CancelByTag, e.g. the id of the user the job belongs to
+	// Metadata for consumers, e.g. the job type to route on without parsing the body
+	Headers map[string]string
+}
+
+// DuplicatePolicy decides what happens when a job is put with the id of a job the server already holds
+type DuplicatePolicy uint8
+
+const (
+	// DuplicateReject fails the put with ErrJobExists
+	DuplicateReject DuplicatePolicy = iota
+	// DuplicateIgnore succeeds without changing anything if the existing job has the same body, priority and TTR.
+	// Safe for retrying puts that may or may not have reached the server
+	DuplicateIgnore
+	// DuplicateReplace overwrites a pending job with the new one. Reserved and dead-lettered jobs are not replaced
+	DuplicateReplace
+)
+
+// NextArgs are the arguments of a NextFrom call
+type NextArgs struct {
+	Timeout time.Duration
+	Queues  []string // Queues to take the next job from. Empty means the default queue
+}
+
+// NextNArgs are the arguments of a NextN call
+type NextNArgs struct {
+	N       int // Max number of jobs to return
+	Timeout time.Duration
+	Queues  []string // Queues to take the jobs from. Empty means the default queue
+}
+
+// PutResult is the outcome of putting one job of a batch
+type PutResult struct {
+	ID        string // Id of the job, generated by the server if the job had none
+	Error     string // Why the job was rejected. Empty if the job was accepted
+	Duplicate bool   // True if the job was rejected because a job with the same id exists
+	Ignored   bool   // True if the job was not added because an identical job exists
+	Replaced  bool   // True if the job replaced a pending job with the same id
+}
+
+// CancelBatchArgs are the arguments of a CancelBatch call
+type CancelBatchArgs struct {
+	IDs   []string
+	Queue string
+}
+
+// CancelMatchingArgs are the arguments of CancelByTag and CancelByPrefix calls
+type CancelMatchingArgs struct {
+	Match string // Tag or id prefix of the jobs to cancel
+	Queue string
+}
+
+// PurgeArgs are the arguments of a PurgeDeadLetters call
+type PurgeArgs struct {
+	IDs   []string // Jobs to purge. Empty means all dead-lettered jobs of the queue
+	Queue string
+}
+
+// InspectArgs are the arguments of an InspectQueue call
+type InspectArgs struct {
+	N     int
+	Queue string
+}
+
+// PutOpt sets optional attributes of a job before it is sent to the server
+type PutOpt func(*Job)
+
+// WithPriority sets the priority of a job. Among jobs that are ready at the same time,
+// jobs with a higher priority are dequeued first
+func WithPriority(pri int32) PutOpt {
+	return func(j *Job) {
+		j.Pri = pri
+	}
+}
+
+// WithTags labels a job with tags. All jobs with a tag can be canceled at once with CancelByTag
+func WithTags(tags ...string) PutOpt {
+	return func(j *Job) {
+		j.Tags = tags
+	}
+}
+
+// WithHeaders sets the headers of a job. Consumers get them along with the body
+func WithHeaders(headers map[string]string) PutOpt {
+	return func(j *Job) {
+		j.Headers = headers
+	}
+}
+
+// WithTTR sets the time-to-run of a job. Jobs with a TTR are reserved when they are dequeued
+// and must be acknowledged with Ack before the TTR runs out, otherwise they are handed out again
+func WithTTR(ttr time.Duration) PutOpt {
+	return func(j *Job) {
+		j.TTR = ttr
+	}
+}
+
+// WithDuplicatePolicy sets what happens if a job with the same id exists. Existing jobs are not changed by default
+// and the put fails with ErrJobExists
+func WithDuplicatePolicy(policy DuplicatePolicy) PutOpt {
+	return func(j *Job) {
+		j.OnDuplicate = policy
+	}
+}
+
+// WithExpiry makes the job expire at the given time if it hasn't been consumed by then.
+// Use it for jobs that are worthless if delivered late
+func WithExpiry(expireAt time.Time) PutOpt {
+	return func(j *Job) {
+		j.ExpireAt = expireAt
+	}
+}
+
+// WithSchedule makes a job recur on a standard cron expression like "0 9 * * *" or a descriptor like "@daily",
+// evaluated in the given IANA timezone (UTC if empty). The job stops recurring after until unless it is zero
+func WithSchedule(cron string, timezone string, until time.Time) PutOpt {
+	return func(j *Job) {
+		j.Cron = cron
+		j.Timezone = timezone
+		j.Until = until
+	}
 }
 
 // NewClient creates an rpc client and tries to connect to a Chronomq RCP Server.
@@ -32,75 +205,345 @@ func NewClient(addr string) (*Client, error) {
 	return c, err
 }
 
+// Use returns a client sharing this client's connection that puts, cancels and acknowledges jobs in the
+// given queue and takes jobs only from that queue. An empty name means the default queue
+func (c *Client) Use(queue string) *Client {
+	return &Client{conn: c.conn, queue: queue}
+}
+
+// Watch returns a client sharing this client's connection whose Next takes jobs from any of the given queues.
+// Jobs returned by NextJob carry their queue, acknowledge them with c.Use(job.Queue).Ack(job.ID)
+func (c *Client) Watch(queues ...string) *Client {
+	return &Client{conn: c.conn, queue: c.queue, watch: queues}
+}
+
+// Queues lists the names of all queues on the server
+func (c *Client) Queues() ([]string, error) {
+	if c.conn == nil {
+		return nil, ErrClientDisconnected
+	}
+	var queues []string
+	err := c.call("RPCServer.Queues", 0, &queues)
+	return queues, err
+}
+
+// call invokes a method of the server, converting the errors of the server into *Error.
+// Calls to a server of a replicated cluster that is not the leader are retried with the leader
+func (c *Client) call(method string, args interface{}, reply interface{}) error {
+	for redirects := 0; ; redirects++ {
+		client := c.conn.get()
+		err := toError(client.Call(method, args, reply))
+		e, ok := err.(*Error)
+		if !ok || e.Code != CodeNotLeader || e.Leader == "" || redirects == maxRedirects {
+			return err
+		}
+		log.Debug().Str("leader", e.Leader).Msg("Redirected to the leader")
+		if err = c.conn.redirect(client, e.Leader); err != nil {
+			return err
+		}
+	}
+}
+
 func (c *Client) connect(addr string) error {
 	client, err := rpc.Dial("tcp", addr)
 	if err != nil {
 		return err
 	}
 
-	c.client = client
+	c.conn = &conn{client: client, lock: &sync.RWMutex{}}
 
 	return nil
 }
 
 // PutWithID saves a job with Chronomq against a given id.
-func (c *Client) PutWithID(id string, body []byte, delay time.Duration) error {
-	if c.client == nil {
+func (c *Client) PutWithID(id string, body []byte, delay time.Duration, opts ...PutOpt) error {
+	if c.conn == nil {
 		return ErrClientDisconnected
 	}
-	job := &Job{ID: id, Body: body, Delay: delay}
-	return c.client.Call("RPCServer.PutWithID", job, &id)
+	job := &Job{ID: id, Body: body, Delay: delay, Queue: c.queue}
+	for _, opt := range opts {
+		opt(job)
+	}
+	return c.call("RPCServer.PutWithID", job, &id)
+}
+
+// PutAtWithID saves a job with Chronomq against a given id to be triggered at the given time.
+// The server rejects trigger times that are too far in the past or future
+func (c *Client) PutAtWithID(id string, body []byte, triggerAt time.Time, opts ...PutOpt) error {
+	if c.conn == nil {
+		return ErrClientDisconnected
+	}
+	job := &Job{ID: id, Body: body, TriggerAt: triggerAt, Queue: c.queue}
+	for _, opt := range opts {
+		opt(job)
+	}
+	return c.call("RPCServer.PutWithID", job, &id)
+}
+
+// PutAt saves a job with Chronomq to be triggered at the given time and returns the auto-generated job id
+func (c *Client) PutAt(body []byte, triggerAt time.Time, opts ...PutOpt) (string, error) {
+	if c.conn == nil {
+		return "", ErrClientDisconnected
+	}
+	job := &Job{Body: body, TriggerAt: triggerAt, Queue: c.queue}
+	for _, opt := range opts {
+		opt(job)
+	}
+	var id string
+	err := c.call("RPCServer.PutWithID", job, &id)
+	return id, err
 }
 
 // Put saves a job with Chronomq and returns the auto-generated job id
-func (c *Client) Put(body []byte, delay time.Duration) (string, error) {
-	if c.client == nil {
+func (c *Client) Put(body []byte, delay time.Duration, opts ...PutOpt) (string, error) {
+	if c.conn == nil {
 		return "", ErrClientDisconnected
 	}
-	job := &Job{ID: "", Body: body, Delay: delay}
+	job := &Job{ID: "", Body: body, Delay: delay, Queue: c.queue}
+	for _, opt := range opts {
+		opt(job)
+	}
 	var id string
-	err := c.client.Call("RPCServer.PutWithID", job, &id)
+	err := c.call("RPCServer.PutWithID", job, &id)
 	return id, err
 }
 
+// PutBatch saves a batch of jobs with Chronomq in a single round trip. Jobs without a queue go to the client's queue.
+// The results are in the order of the jobs and tell which jobs were rejected. The error is only set
+// if the batch could not be sent at all
+func (c *Client) PutBatch(jobs []Job) ([]PutResult, error) {
+	if c.conn == nil {
+		return nil, ErrClientDisconnected
+	}
+	batch := make([]Job, len(jobs))
+	for i, j := range jobs {
+		if j.Queue == "" {
+			j.Queue = c.queue
+		}
+		batch[i] = j
+	}
+	var results []PutResult
+	err := c.call("RPCServer.PutBatch", batch, &results)
+	return results, err
+}
+
+// CancelBatch deletes the jobs identified by the given ids in a single round trip.
+// The results are in the order of the ids and are true for the jobs that existed and were deleted
+func (c *Client) CancelBatch(ids []string) ([]bool, error) {
+	if c.conn == nil {
+		return nil, ErrClientDisconnected
+	}
+	var canceled []bool
+	err := c.call("RPCServer.CancelBatch", &CancelBatchArgs{IDs: ids, Queue: c.queue}, &canceled)
+	return canceled, err
+}
+
+// CancelByTag deletes all pending, reserved and dead-lettered jobs with the given tag.
+// Returns the number of deleted jobs
+func (c *Client) CancelByTag(tag string) (int, error) {
+	if c.conn == nil {
+		return 0, ErrClientDisconnected
+	}
+	var canceled int
+	err := c.call("RPCServer.CancelByTag", &CancelMatchingArgs{Match: tag, Queue: c.queue}, &canceled)
+	return canceled, err
+}
+
+// CancelByPrefix deletes all pending, reserved and dead-lettered jobs whose id starts with the given prefix.
+// Nothing is deleted for an empty prefix. Returns the number of deleted jobs
+func (c *Client) CancelByPrefix(prefix string) (int, error) {
+	if c.conn == nil {
+		return 0, ErrClientDisconnected
+	}
+	var canceled int
+	err := c.call("RPCServer.CancelByPrefix", &CancelMatchingArgs{Match: prefix, Queue: c.queue}, &canceled)
+	return canceled, err
+}
+
+// Get returns the job with the given id along with its state, or the server's "Job not found" error
+// if the job has been consumed or canceled
+func (c *Client) Get(id string) (*Job, error) {
+	if c.conn == nil {
+		return nil, ErrClientDisconnected
+	}
+	job := &Job{}
+	if err := c.call("RPCServer.Get", &Job{ID: id, Queue: c.queue}, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Reschedule moves a pending job to a new trigger time in one atomic step.
+// Fails with the server's "Job not found" error if the job was consumed or is reserved
+func (c *Client) Reschedule(id string, triggerAt time.Time) error {
+	if c.conn == nil {
+		return ErrClientDisconnected
+	}
+	var ignoredReply int8
+	return c.call("RPCServer.Reschedule", &Job{ID: id, TriggerAt: triggerAt, Queue: c.queue}, &ignoredReply)
+}
+
+// UpdateBody replaces the body of a pending job.
+// Fails with the server's "Job not found" error if the job was consumed or is reserved
+func (c *Client) UpdateBody(id string, body []byte) error {
+	if c.conn == nil {
+		return ErrClientDisconnected
+	}
+	var ignoredReply int8
+	return c.call("RPCServer.UpdateBody", &Job{ID: id, Body: body, Queue: c.queue}, &ignoredReply)
+}
+
 // Cancel deletes a job identified by the given id. Calls to cancel are idempotent
 func (c *Client) Cancel(id string) error {
-	if c.client == nil {
+	if c.conn == nil {
 		return ErrClientDisconnected
 	}
 	var ignoredReply int8
-	return c.client.Call("RPCServer.Cancel", id, &ignoredReply)
+	return c.call("RPCServer.CancelIn", &Job{ID: id, Queue: c.queue}, &ignoredReply)
 }
 
 // Next wait at-most timeout duration to return a ready job body from Chronomq
 // If no job is available within the timeout, ErrTimeout is returned and clients should try again later
 func (c *Client) Next(timeout time.Duration) (string, []byte, error) {
-	if c.client == nil {
-		return "", nil, ErrClientDisconnected
-	}
-	var job Job
-	err := c.client.Call("RPCServer.Next", timeout, &job)
+	job, err := c.NextJob(timeout)
 	if err != nil {
 		return "", nil, err
 	}
 	return job.ID, job.Body, nil
 }
 
-// Close the client connection
+// NextJob is like Next but returns the full job as sent by the server
+func (c *Client) NextJob(timeout time.Duration) (*Job, error) {
+	if c.conn == nil {
+		return nil, ErrClientDisconnected
+	}
+	queues := c.watch
+	if len(queues) == 0 {
+		queues = []string{c.queue}
+	}
+	job := &Job{}
+	err := c.call("RPCServer.NextFrom", &NextArgs{Timeout: timeout, Queues: queues}, job)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// NextN waits at-most timeout duration for jobs to be ready and returns up to n of them.
+// It returns as soon as any job is ready, so fewer than n jobs may be returned.
+// If no job is available within the timeout, ErrTimeout is returned
+func (c *Client) NextN(n int, timeout time.Duration) ([]*Job, error) {
+	if c.conn == nil {
+		return nil, ErrClientDisconnected
+	}
+	queues := c.watch
+	if len(queues) == 0 {
+		queues = []string{c.queue}
+	}
+	var jobs []*Job
+	err := c.call("RPCServer.NextN", &NextNArgs{N: n, Timeout: timeout, Queues: queues}, &jobs)
+	return jobs, err
+}
+
+// Ack deletes a reserved job once it has been worked on. Jobs that are not acknowledged
+// within their TTR are handed out again
+func (c *Client) Ack(id string) error {
+	if c.conn == nil {
+		return ErrClientDisconnected
+	}
+	var ignoredReply int8
+	return c.call("RPCServer.Ack", &Job{ID: id, Queue: c.queue}, &ignoredReply)
+}
+
+// Release puts a reserved job back into the queue to be ready again after delay.
+// With a zero delay the job is ready again right away
+func (c *Client) Release(id string, delay time.Duration) error {
+	if c.conn == nil {
+		return ErrClientDisconnected
+	}
+	var ignoredReply int8
+	job := &Job{ID: id, Delay: delay, Queue: c.queue}
+	return c.call("RPCServer.Release", job, &ignoredReply)
+}
+
+// Nack fails a reserved job. The server retries the job with a backoff or, once it failed too often,
+// moves it to the dead-letter store. Returns true if the job was dead-lettered
+func (c *Client) Nack(id string) (bool, error) {
+	if c.conn == nil {
+		return false, ErrClientDisconnected
+	}
+	var dead bool
+	err := c.call("RPCServer.Nack", &Job{ID: id, Queue: c.queue}, &dead)
+	return dead, err
+}
+
+// DeadLetters fetches up to n jobs from the dead-letter store, the ones that died first first
+func (c *Client) DeadLetters(n int) ([]*Job, error) {
+	if c.conn == nil {
+		return nil, ErrClientDisconnected
+	}
+	var jobs []*Job
+	err := c.call("RPCServer.DeadLetters", &InspectArgs{N: n, Queue: c.queue}, &jobs)
+	return jobs, err
+}
+
+// DeadLetter fetches the dead-lettered job with the given id
+func (c *Client) DeadLetter(id string) (*Job, error) {
+	if c.conn == nil {
+		return nil, ErrClientDisconnected
+	}
+	job := &Job{}
+	if err := c.call("RPCServer.DeadLetter", &Job{ID: id, Queue: c.queue}, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// RequeueDeadLetter moves a job out of the dead-letter store back into its queue to be ready after delay.
+// The job's attempts are reset
+func (c *Client) RequeueDeadLetter(id string, delay time.Duration) error {
+	if c.conn == nil {
+		return ErrClientDisconnected
+	}
+	var ignoredReply int8
+	return c.call("RPCServer.RequeueDeadLetter", &Job{ID: id, Delay: delay, Queue: c.queue}, &ignoredReply)
+}
+
+// PurgeDeadLetters deletes the dead-lettered jobs with the given ids or all dead-lettered jobs of the queue
+// if no ids are given. Returns the number of deleted jobs
+func (c *Client) PurgeDeadLetters(ids ...string) (int, error) {
+	if c.conn == nil {
+		return 0, ErrClientDisconnected
+	}
+	var purged int
+	err := c.call("RPCServer.PurgeDeadLetters", &PurgeArgs{IDs: ids, Queue: c.queue}, &purged)
+	return purged, err
+}
+
+// Touch restarts the TTR of a reserved job to get more time to work on it
+func (c *Client) Touch(id string) error {
+	if c.conn == nil {
+		return ErrClientDisconnected
+	}
+	var ignoredReply int8
+	return c.call("RPCServer.Touch", &Job{ID: id, Queue: c.queue}, &ignoredReply)
+}
+
+// Close the client connection. Clients created with Use or Watch share the connection and are closed too
 func (c *Client) Close() error {
-	if c.client != nil {
-		return c.client.Close()
+	if c.conn != nil {
+		return c.conn.get().Close()
 	}
 	return nil
 }
 
 // Ping the server and check connectivity
 func (c *Client) Ping() error {
-	if c.client == nil {
+	if c.conn == nil {
 		return ErrClientDisconnected
 	}
 	var pong string
-	err := c.client.Call("RPCServer.Ping", 0, &pong)
+	err := c.call("RPCServer.Ping", 0, &pong)
 	if err != nil {
 		return err
 	}
@@ -111,10 +554,19 @@ func (c *Client) Ping() error {
 	return nil
 }
 
+// Promote makes a standby replica serve clients. The replica stops following its primary for good
+func (c *Client) Promote() error {
+	if c.conn == nil {
+		return ErrClientDisconnected
+	}
+	var ignoredReply int8
+	return c.call("RPCServer.Promote", 0, &ignoredReply)
+}
+
 // InspectN fetches upto n number of jobs from the server without consuming them
 func (c *Client) InspectN(n int, jobs *[]*Job) error {
-	if c.client != nil {
-		return c.client.Call("RPCServer.InspectN", n, jobs)
+	if c.conn != nil {
+		return c.call("RPCServer.InspectQueue", &InspectArgs{N: n, Queue: c.queue}, jobs)
 	}
 	return nil
 }
@@ -3,6 +3,7 @@ package cmd
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -18,6 +19,16 @@ type putArgs struct {
 	id      string
 	payload *bufValue
 	delay   time.Duration
+	at      string
+	pri     int32
+	queue   string
+	cron    string
+	tz      string
+	until   string
+	onDup   string
+	expire  string
+	tags    []string
+	headers map[string]string
 }
 
 type bufValue struct {
@@ -42,13 +53,14 @@ var (
 	putCmd = &cobra.Command{
 		Use:   "put",
 		Short: "Enqueue a job",
-		Long: `Enqueues a job. Errors if another job with the same id already exists.
+		Long: `Enqueues a job. Errors if another job with the same id already exists unless --on-duplicate is ignore or replace.
 		If no id is specific, the command will auto-generate a random id and return it.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			client, err := chronomq.NewClient(defaultAddrs.rpcAddr)
+			conn, err := chronomq.NewClient(defaultAddrs.rpcAddr)
 			if err != nil {
 				return err
 			}
+			client := conn.Use(putCmdArgs.queue)
 
 			var payload []byte
 			if putCmdArgs.payload.isSet {
@@ -62,11 +74,59 @@ var (
 				}
 			}
 
-			if putCmdArgs.id != "" {
-				err = client.PutWithID(putCmdArgs.id, payload, putCmdArgs.delay)
+			opts := []chronomq.PutOpt{
+				chronomq.WithPriority(putCmdArgs.pri),
+				chronomq.WithTags(putCmdArgs.tags...),
+				chronomq.WithHeaders(putCmdArgs.headers),
+			}
+			switch putCmdArgs.onDup {
+			case "reject":
+			case "ignore":
+				opts = append(opts, chronomq.WithDuplicatePolicy(chronomq.DuplicateIgnore))
+			case "replace":
+				opts = append(opts, chronomq.WithDuplicatePolicy(chronomq.DuplicateReplace))
+			default:
+				return fmt.Errorf("Unknown --on-duplicate policy: %s", putCmdArgs.onDup)
+			}
+			if putCmdArgs.cron != "" {
+				var until time.Time
+				if putCmdArgs.until != "" {
+					until, err = time.Parse(time.RFC3339, putCmdArgs.until)
+					if err != nil {
+						return err
+					}
+				}
+				opts = append(opts, chronomq.WithSchedule(putCmdArgs.cron, putCmdArgs.tz, until))
+			} else if putCmdArgs.tz != "" || putCmdArgs.until != "" {
+				return errors.New("--tz and --until can only be used with --cron")
+			}
+			if putCmdArgs.expire != "" {
+				var expireAt time.Time
+				expireAt, err = time.Parse(time.RFC3339, putCmdArgs.expire)
+				if err != nil {
+					return err
+				}
+				opts = append(opts, chronomq.WithExpiry(expireAt))
+			}
+			if putCmdArgs.at != "" {
+				if cmd.Flags().Changed("delay") {
+					return errors.New("Set either --delay or --at")
+				}
+				var at time.Time
+				at, err = time.Parse(time.RFC3339, putCmdArgs.at)
+				if err != nil {
+					return err
+				}
+				if putCmdArgs.id != "" {
+					err = client.PutAtWithID(putCmdArgs.id, payload, at, opts...)
+				} else {
+					putCmdArgs.id, err = client.PutAt(payload, at, opts...)
+				}
+			} else if putCmdArgs.id != "" {
+				err = client.PutWithID(putCmdArgs.id, payload, putCmdArgs.delay, opts...)
 			} else {
 				var id string
-				id, err = client.Put(payload, putCmdArgs.delay)
+				id, err = client.Put(payload, putCmdArgs.delay, opts...)
 				putCmdArgs.id = id
 			}
 			if err == nil {
@@ -82,10 +142,13 @@ var (
 type nextArgs struct {
 	timeout time.Duration
 	json    bool
+	queues  []string
 }
 type nextJSON struct {
-	ID   string
-	Body string
+	ID      string
+	Body    string
+	Queue   string
+	Headers map[string]string `json:",omitempty"`
 }
 
 var (
@@ -100,7 +163,7 @@ var (
 				log.Error().Err(err).Send()
 				return
 			}
-			id, body, err := client.Next(nextCmdArgs.timeout)
+			job, err := client.Watch(nextCmdArgs.queues...).NextJob(nextCmdArgs.timeout)
 			if err != nil {
 				log.Error().Err(err).Send()
 				return
@@ -108,14 +171,14 @@ var (
 			switch nextCmdArgs.json {
 			case true:
 				var j []byte
-				j, err = json.Marshal(nextJSON{ID: id, Body: string(body)})
+				j, err = json.Marshal(nextJSON{ID: job.ID, Body: string(job.Body), Queue: job.Queue, Headers: job.Headers})
 				if err != nil {
 					log.Error().Err(err).Send()
 					return
 				}
 				fmt.Printf("%s", j)
 			case false:
-				fmt.Printf("ID: %s\nBODY: %s", id, body)
+				fmt.Printf("ID: %s\nQUEUE: %s%s\nBODY: %s", job.ID, job.Queue, formatHeaders(job), job.Body)
 			}
 		},
 		SilenceUsage:  true,
@@ -124,7 +187,10 @@ var (
 )
 
 type cancelArgs struct {
-	id string
+	id     string
+	tag    string
+	prefix string
+	queue  string
 }
 
 var (
@@ -132,18 +198,100 @@ var (
 	cancelCmd     = &cobra.Command{
 		Use:   "cancel",
 		Short: "Cancel a job",
-		Long:  `Cancels the job with the given id. Cancel is ignore is no job matches the id`,
+		Long: `Cancels the job with the given id. Cancel is ignore is no job matches the id.
+		With --tag or --prefix, cancels all jobs with the tag or whose id starts with the prefix and prints their number`,
 		Run: func(cmd *cobra.Command, args []string) {
-			client, err := chronomq.NewClient(defaultAddrs.rpcAddr)
+			set := 0
+			for _, arg := range []string{cancelCmdArgs.id, cancelCmdArgs.tag, cancelCmdArgs.prefix} {
+				if arg != "" {
+					set++
+				}
+			}
+			if set != 1 {
+				log.Error().Msg("Set exactly one of --id, --tag or --prefix")
+				return
+			}
+			conn, err := chronomq.NewClient(defaultAddrs.rpcAddr)
 			if err != nil {
 				log.Error().Err(err).Send()
 				return
 			}
-			err = client.Cancel(cancelCmdArgs.id)
+			client := conn.Use(cancelCmdArgs.queue)
+			if cancelCmdArgs.id != "" {
+				err = client.Cancel(cancelCmdArgs.id)
+				if err != nil {
+					log.Error().Err(err).Send()
+				}
+				return
+			}
+			var canceled int
+			if cancelCmdArgs.tag != "" {
+				canceled, err = client.CancelByTag(cancelCmdArgs.tag)
+			} else {
+				canceled, err = client.CancelByPrefix(cancelCmdArgs.prefix)
+			}
 			if err != nil {
 				log.Error().Err(err).Send()
 				return
 			}
+			fmt.Println(canceled)
+		},
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+)
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Promote a standby replica",
+	Long: `Makes the standby replica at --raddr serve clients with the jobs it replicated. It stops following its primary for good.
+		Make sure that the primary is down or does not serve clients anymore`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := chronomq.NewClient(defaultAddrs.rpcAddr)
+		if err != nil {
+			log.Error().Err(err).Send()
+			return
+		}
+		if err = client.Promote(); err != nil {
+			log.Error().Err(err).Send()
+		}
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+type getArgs struct {
+	id    string
+	queue string
+}
+
+var (
+	getCmdArgs = getArgs{}
+	getCmd     = &cobra.Command{
+		Use:   "get",
+		Short: "Show a job",
+		Long:  `Shows the job with the given id, its state and when it triggers. Errors if no job matches the id`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := chronomq.NewClient(defaultAddrs.rpcAddr)
+			if err != nil {
+				return err
+			}
+			j, err := client.Use(getCmdArgs.queue).Get(getCmdArgs.id)
+			if err != nil {
+				return err
+			}
+			fmt.Printf(`ID:	%s
+Queue:	%s
+State:	%s
+TriggerAt:	%s
+DelayFromNow:	%s
+Priority:	%d
+TTR:	%s
+Attempts:	%d%s%s%s%s
+Body:
+%s
+`, j.ID, j.Queue, j.State, j.TriggerAt.Format(time.RFC3339Nano), j.Delay, j.Pri, j.TTR, j.Attempts, formatTags(j), formatHeaders(j), formatExpiry(j), formatSchedule(j), string(j.Body))
+			return nil
 		},
 		SilenceUsage:  true,
 		SilenceErrors: true,
@@ -153,15 +301,35 @@ var (
 func init() {
 	putCmd.PersistentFlags().StringVarP(&putCmdArgs.id, "id", "i", "", "ID for the job")
 	putCmd.PersistentFlags().DurationVarP(&putCmdArgs.delay, "delay", "d", 0, "Job trigger delay relative to now (golang duration string format)")
+	putCmd.PersistentFlags().StringVar(&putCmdArgs.at, "at", "", "Absolute job trigger time in RFC3339 format, e.g. 2030-01-02T15:04:05Z. Cannot be used with --delay")
 	putCmd.PersistentFlags().VarP(putCmdArgs.payload, "body", "b", "Job body. Defaults to reading stdin if not specified")
+	putCmd.PersistentFlags().StringVarP(&putCmdArgs.queue, "queue", "q", "", "Queue to put the job into (default queue if not specified)")
+	putCmd.PersistentFlags().Int32VarP(&putCmdArgs.pri, "pri", "p", 0, "Job priority. Among jobs ready at the same time, higher priority jobs are dequeued first")
+	putCmd.PersistentFlags().StringVar(&putCmdArgs.cron, "cron", "", `Make the job recur on a cron expression, e.g. "0 9 * * *" or "@daily". It first triggers at the first occurrence after --delay or --at`)
+	putCmd.PersistentFlags().StringVar(&putCmdArgs.tz, "tz", "", "IANA timezone the cron expression is evaluated in, e.g. Europe/Berlin (default UTC)")
+	putCmd.PersistentFlags().StringVar(&putCmdArgs.until, "until", "", "Stop recurring after this time in RFC3339 format (default never)")
+	putCmd.PersistentFlags().StringToStringVar(&putCmdArgs.headers, "header", nil, "Header of the job as key=value, e.g. type=email. Can be repeated")
+	putCmd.PersistentFlags().StringSliceVar(&putCmdArgs.tags, "tag", nil, "Tag to cancel the job by, e.g. a user id. Can be repeated")
+	putCmd.PersistentFlags().StringVar(&putCmdArgs.expire, "expire-at", "", "Drop the job if it hasn't been consumed by this time in RFC3339 format (default never)")
+	putCmd.PersistentFlags().StringVar(&putCmdArgs.onDup, "on-duplicate", "reject", `What to do if a job with the same id exists: reject, ignore (succeed if the job is identical)
+or replace (overwrite a pending job)`)
 
 	nextCmd.PersistentFlags().DurationVarP(&nextCmdArgs.timeout, "timeout", "t", 0, "Wait at most timeout duration for a job to be available")
 	nextCmd.PersistentFlags().BoolVarP(&nextCmdArgs.json, "json", "j", false, "Print job response in json format")
+	nextCmd.PersistentFlags().StringSliceVarP(&nextCmdArgs.queues, "queue", "q", nil, "Queues to take the job from. Can be repeated (default queue if not specified)")
 
 	cancelCmd.PersistentFlags().StringVarP(&cancelCmdArgs.id, "id", "i", "", "ID for the job")
-	cancelCmd.MarkPersistentFlagRequired("id")
+	cancelCmd.PersistentFlags().StringVar(&cancelCmdArgs.tag, "tag", "", "Cancel all jobs with this tag")
+	cancelCmd.PersistentFlags().StringVar(&cancelCmdArgs.prefix, "prefix", "", "Cancel all jobs whose id starts with this prefix")
+	cancelCmd.PersistentFlags().StringVarP(&cancelCmdArgs.queue, "queue", "q", "", "Queue of the job (default queue if not specified)")
+
+	getCmd.PersistentFlags().StringVarP(&getCmdArgs.id, "id", "i", "", "ID for the job")
+	getCmd.MarkPersistentFlagRequired("id")
+	getCmd.PersistentFlags().StringVarP(&getCmdArgs.queue, "queue", "q", "", "Queue of the job (default queue if not specified)")
 
 	rootCmd.AddCommand(putCmd)
+	rootCmd.AddCommand(getCmd)
 	rootCmd.AddCommand(nextCmd)
 	rootCmd.AddCommand(cancelCmd)
+	rootCmd.AddCommand(promoteCmd)
 }
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/chronomq/chronomq/api/rpc/chronomq"
+)
+
+type deadLetterArgs struct {
+	queue string
+	num   int
+	id    string
+	ids   []string
+	all   bool
+	delay time.Duration
+}
+
+var (
+	deadLetterCmdArgs = deadLetterArgs{}
+	deadLetterCmd     = &cobra.Command{
+		Use:   "dlq",
+		Short: "Manage the dead-letter store of a queue",
+		Long: `Jobs that consumers failed with Nack more often than the server's --max-attempts are moved
+		to the dead-letter store of their queue. They stay there till they are requeued, purged or canceled.`,
+	}
+	deadLetterListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List up to num dead-lettered jobs, the ones that died first first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := deadLetterClient()
+			if err != nil {
+				return err
+			}
+			jobs, err := client.DeadLetters(deadLetterCmdArgs.num)
+			if err != nil {
+				return err
+			}
+			for _, j := range jobs {
+				printDeadLetter(j)
+			}
+			return nil
+		},
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	deadLetterInspectCmd = &cobra.Command{
+		Use:   "inspect",
+		Short: "Show a dead-lettered job",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := deadLetterClient()
+			if err != nil {
+				return err
+			}
+			job, err := client.DeadLetter(deadLetterCmdArgs.id)
+			if err != nil {
+				return err
+			}
+			printDeadLetter(job)
+			return nil
+		},
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	deadLetterRequeueCmd = &cobra.Command{
+		Use:   "requeue",
+		Short: "Move a dead-lettered job back into its queue with its attempts reset",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := deadLetterClient()
+			if err != nil {
+				return err
+			}
+			return client.RequeueDeadLetter(deadLetterCmdArgs.id, deadLetterCmdArgs.delay)
+		},
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	deadLetterPurgeCmd = &cobra.Command{
+		Use:   "purge",
+		Short: "Delete dead-lettered jobs for good",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(deadLetterCmdArgs.ids) == 0 && !deadLetterCmdArgs.all {
+				return errors.New("Set the jobs to purge with --id or purge all of them with --all")
+			}
+			if len(deadLetterCmdArgs.ids) > 0 && deadLetterCmdArgs.all {
+				return errors.New("Set either --id or --all")
+			}
+			client, err := deadLetterClient()
+			if err != nil {
+				return err
+			}
+			purged, err := client.PurgeDeadLetters(deadLetterCmdArgs.ids...)
+			if err == nil {
+				fmt.Println(purged)
+			}
+			return err
+		},
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+)
+
+func init() {
+	deadLetterCmd.PersistentFlags().StringVarP(&deadLetterCmdArgs.queue, "queue", "q", "", "Queue of the dead-letter store (default queue if not specified)")
+
+	deadLetterListCmd.Flags().IntVarP(&deadLetterCmdArgs.num, "num", "n", 10, "Max number of jobs to list")
+
+	deadLetterInspectCmd.Flags().StringVarP(&deadLetterCmdArgs.id, "id", "i", "", "ID of the job")
+	deadLetterInspectCmd.MarkFlagRequired("id")
+
+	deadLetterRequeueCmd.Flags().StringVarP(&deadLetterCmdArgs.id, "id", "i", "", "ID of the job")
+	deadLetterRequeueCmd.MarkFlagRequired("id")
+	deadLetterRequeueCmd.Flags().DurationVarP(&deadLetterCmdArgs.delay, "delay", "d", 0, "Job trigger delay relative to now (golang duration string format)")
+
+	deadLetterPurgeCmd.Flags().StringSliceVarP(&deadLetterCmdArgs.ids, "id", "i", nil, "ID of a job to purge. Can be repeated")
+	deadLetterPurgeCmd.Flags().BoolVar(&deadLetterCmdArgs.all, "all", false, "Purge all dead-lettered jobs of the queue")
+
+	deadLetterCmd.AddCommand(deadLetterListCmd, deadLetterInspectCmd, deadLetterRequeueCmd, deadLetterPurgeCmd)
+	rootCmd.AddCommand(deadLetterCmd)
+}
+
+func deadLetterClient() (*chronomq.Client, error) {
+	client, err := chronomq.NewClient(defaultAddrs.rpcAddr)
+	if err != nil {
+		return nil, err
+	}
+	return client.Use(deadLetterCmdArgs.queue), nil
+}
+
+func printDeadLetter(j *chronomq.Job) {
+	fmt.Fprintf(os.Stdout, `
+%s
+ID:	%s
+Queue:	%s
+Attempts:	%d
+DeadAt:	%s
+Priority:	%d
+Body:
+%s`, delimiter, j.ID, j.Queue, j.Attempts, j.DeadAt.Format(time.RFC3339Nano), j.Pri, string(j.Body))
+}
@@ -3,6 +3,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/chronomq/chronomq/api/rpc/chronomq"
 	"github.com/rs/zerolog/log"
@@ -14,6 +17,7 @@ const delimiter = "-----------------------------------------"
 var (
 	num        int
 	outfile    string
+	queue      string
 	inspectCmd = &cobra.Command{
 		Use:   "inspect",
 		Short: "Fetches upto num jobs from the server without consuming them",
@@ -30,6 +34,7 @@ var (
 func init() {
 	inspectCmd.Flags().IntVarP(&num, "num", "n", 1, "Max Number of jobs to inspect")
 	inspectCmd.Flags().StringVarP(&outfile, "out", "o", "", "Write output to outfile (default: stdout)")
+	inspectCmd.Flags().StringVarP(&queue, "queue", "q", "", "Queue to inspect (default queue if not specified)")
 
 	inspectCmd.Flags().StringVar(&defaultAddrs.rpcAddr, "raddr", defaultAddrs.rpcAddr, "Set RPC server addr (host:port)")
 	rootCmd.AddCommand(inspectCmd)
@@ -54,7 +59,7 @@ func inspect() error {
 	}
 
 	jobs := []*chronomq.Job{}
-	err = client.InspectN(num, &jobs)
+	err = client.Use(queue).InspectN(num, &jobs)
 	if err != nil {
 		return err
 	}
@@ -63,12 +68,64 @@ func inspect() error {
 		_, err = output.WriteString(fmt.Sprintf(`
 %s
 ID:	%s
+Queue:	%s
 DelayFromNow:	%s
+TriggerAt:	%s
+Priority:	%d%s%s%s%s
 Body:
-%s`, delimiter, j.ID, j.Delay, string(j.Body)))
+%s`, delimiter, j.ID, j.Queue, j.Delay, j.TriggerAt.Format(time.RFC3339Nano), j.Pri, formatTags(j), formatHeaders(j), formatExpiry(j), formatSchedule(j), string(j.Body)))
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// formatTags returns the tags of a job or nothing for jobs without tags
+func formatTags(j *chronomq.Job) string {
+	if len(j.Tags) == 0 {
+		return ""
+	}
+	return "\nTags:\t" + strings.Join(j.Tags, ", ")
+}
+
+// formatHeaders returns the headers of a job sorted by key or nothing for jobs without headers
+func formatHeaders(j *chronomq.Job) string {
+	if len(j.Headers) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(j.Headers))
+	for k := range j.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	s := "\nHeaders:"
+	for _, k := range keys {
+		s += fmt.Sprintf("\n\t%s=%s", k, j.Headers[k])
+	}
+	return s
+}
+
+// formatExpiry returns when a job expires or nothing for jobs that never expire
+func formatExpiry(j *chronomq.Job) string {
+	if j.ExpireAt.IsZero() {
+		return ""
+	}
+	return "\nExpireAt:\t" + j.ExpireAt.Format(time.RFC3339Nano)
+}
+
+// formatSchedule returns the schedule and next occurrences of a recurring job or nothing for other jobs
+func formatSchedule(j *chronomq.Job) string {
+	if j.Cron == "" {
+		return ""
+	}
+	until := "never"
+	if !j.Until.IsZero() {
+		until = j.Until.Format(time.RFC3339)
+	}
+	s := fmt.Sprintf("\nCron:\t%s\nTimezone:\t%s\nUntil:\t%s\nNextOccurrences:", j.Cron, j.Timezone, until)
+	for _, at := range j.Occurrences {
+		s += "\n\t" + at.Format(time.RFC3339)
+	}
+	return s
+}
@@ -27,6 +27,7 @@ var (
 	nsTolerance     int64 = 1000
 	enableTolerance       = false
 	sizeBytes             = 100
+	batchSize             = 1
 
 	loadTestCmd = &cobra.Command{
 		Use:   "loadtest",
@@ -49,6 +50,7 @@ func init() {
 	loadTestCmd.Flags().IntVarP(&sizeBytes, "size", "z", 1000, "Job size in bytes")
 	loadTestCmd.Flags().IntVarP(&jobs, "num", "n", 1000, "Number of total jobs")
 	loadTestCmd.Flags().IntVarP(&connections, "con", "c", 5, "Number of connections to use")
+	loadTestCmd.Flags().IntVarP(&batchSize, "batch", "b", 1, "Number of jobs put, taken and canceled per call (1 disables batching)")
 	loadTestCmd.Flags().IntVarP(&maxDelaySec, "delayMax", "M", 60, "Max delay in seconds (Delay is random over delayMin, delayMax)")
 	loadTestCmd.Flags().IntVarP(&minDelaySec, "delayMin", "N", 0, "Min delay in seconds (Delay is random over delayMin, delayMax)")
 
@@ -67,6 +69,7 @@ func runLoadTest() {
 		Int("MinDelaySec", minDelaySec).
 		Bool("EnqueueMode", enqueueMode).
 		Bool("DequeueMode", dequeueMode).
+		Int("BatchSize", batchSize).
 		Str("RPCAddr", defaultAddrs.rpcAddr).
 		Msg("Setting up load test parameters")
 
@@ -137,6 +140,13 @@ func runLoadTest() {
 }
 
 func dequeueRPC(deqWG *sync.WaitGroup, workerID int, rpcClient *chronomq.Client, deqJobs chan struct{}, stopDeq chan struct{}, data []byte) {
+	if batchSize > 1 {
+		go dequeueBatchRPC(workerID, rpcClient, deqJobs, data)
+		<-stopDeq
+		deqWG.Done()
+		log.Info().Int("workerID", workerID).Msg("Stopping dequeue for connection")
+		return
+	}
 	go func() {
 		var prevTriggerAt int64
 		for {
@@ -163,6 +173,33 @@ func dequeueRPC(deqWG *sync.WaitGroup, workerID int, rpcClient *chronomq.Client,
 	log.Info().Int("workerID", workerID).Msg("Stopping dequeue for connection")
 }
 
+// dequeueBatchRPC takes and cancels up to batchSize jobs per call till the process exits
+func dequeueBatchRPC(workerID int, rpcClient *chronomq.Client, deqJobs chan struct{}, data []byte) {
+	var prevTriggerAt int64
+	for {
+		jobs, err := rpcClient.NextN(batchSize, time.Second*1)
+		if err != nil {
+			if err.Error() == protocol.ErrTimeout.Error() {
+				continue
+			}
+			// legit error
+			log.Fatal().Err(err).Msg("Error reading from rpc client")
+		}
+		ids := make([]string, len(jobs))
+		for i, j := range jobs {
+			ids[i] = j.ID
+		}
+		log.Debug().Int("count", len(ids)).Msg("Canceling jobs")
+		if _, err = rpcClient.CancelBatch(ids); err != nil {
+			log.Fatal().Err(err).Msg("Error canceling rpc jobs")
+		}
+		for _, j := range jobs {
+			validateJob(data, j.Body, prevTriggerAt, workerID)
+			deqJobs <- struct{}{}
+		}
+	}
+}
+
 func validateJob(testData []byte, body []byte, prevTriggerAt int64, workerID int) {
 	parts := bytes.Split(body, []byte(` `))
 	if len(parts) == 2 {
@@ -210,6 +247,10 @@ func validateJob(testData []byte, body []byte, prevTriggerAt int64, workerID int
 
 func enqueueRPC(wg *sync.WaitGroup, workerID int, client *chronomq.Client, jobs chan *testJob) {
 	defer wg.Done()
+	if batchSize > 1 {
+		enqueueBatchRPC(workerID, client, jobs)
+		return
+	}
 	for j := range jobs {
 		var err error
 		// To use PutWithID - have to ensure ids are globally unique among the multiple producer goroutines
@@ -223,6 +264,34 @@ func enqueueRPC(wg *sync.WaitGroup, workerID int, client *chronomq.Client, jobs
 	log.Info().Int("workerID", workerID).Msg("Connection done enqueueing")
 }
 
+// enqueueBatchRPC puts jobs batchSize at a time
+func enqueueBatchRPC(workerID int, client *chronomq.Client, jobs chan *testJob) {
+	batch := make([]chronomq.Job, 0, batchSize)
+	put := func() {
+		results, err := client.PutBatch(batch)
+		if err != nil {
+			log.Fatal().Int("workderID", workerID).Err(err).Msg("Failed to enqueue batch")
+		}
+		for _, r := range results {
+			if r.Error != "" {
+				log.Fatal().Int("workderID", workerID).Str("jobID", r.ID).Str("error", r.Error).Msg("Failed to enqueue")
+			}
+		}
+		metrics.Count("loadtest.enqueuerpc", len(batch))
+		batch = batch[:0]
+	}
+	for j := range jobs {
+		batch = append(batch, chronomq.Job{ID: j.id, Body: j.data, Delay: time.Second * time.Duration(j.delaySec)})
+		if len(batch) == batchSize {
+			put()
+		}
+	}
+	if len(batch) > 0 {
+		put()
+	}
+	log.Info().Int("workerID", workerID).Msg("Connection done enqueueing")
+}
+
 func generateJobs(data []byte) chan *testJob {
 	out := make(chan *testJob, connections)
 	go func() {
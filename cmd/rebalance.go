@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/chronomq/chronomq/api/rpc/chronomq"
+)
+
+var (
+	rebalanceFrom []string
+	rebalanceTo   []string
+	rebalanceCmd  = &cobra.Command{
+		Use:   "rebalance",
+		Short: "Move jobs between the servers of a sharded cluster after servers were added or removed",
+		Long: `Moves every pending job of the --from servers to the server that owns its id among the --to servers.
+Use the same addresses as the cluster clients. Clients of the new cluster can be used while jobs are moved.
+Reserved and dead-lettered jobs are not moved`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(rebalanceFrom) == 0 || len(rebalanceTo) == 0 {
+				return errors.New("Set the servers of the cluster before and after the change with --from and --to")
+			}
+			log.Info().Strs("from", rebalanceFrom).Strs("to", rebalanceTo).Msg("Rebalancing cluster")
+			moved, err := chronomq.Rebalance(rebalanceFrom, rebalanceTo)
+			fmt.Println(moved)
+			return err
+		},
+	}
+)
+
+func init() {
+	rebalanceCmd.Flags().StringSliceVar(&rebalanceFrom, "from", nil, "Servers of the cluster before the change (host:port). Can be repeated")
+	rebalanceCmd.Flags().StringSliceVar(&rebalanceTo, "to", nil, "Servers of the cluster after the change (host:port). Can be repeated")
+	rootCmd.AddCommand(rebalanceCmd)
+}
@@ -33,6 +33,7 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&defaultAddrs.rpcAddr, "raddr", defaultAddrs.rpcAddr, "Bind RPC listener to (host:port)")
 	rootCmd.PersistentFlags().StringVar(&defaultAddrs.grpcAddr, "gaddr", defaultAddrs.grpcAddr, "Bind GRPC listener to (host:port)")
+	rootCmd.PersistentFlags().StringVar(&defaultAddrs.httpAddr, "haddr", defaultAddrs.httpAddr, "Bind HTTP API listener to (host:port)")
 	rootCmd.PersistentFlags().StringVar(&defaultAddrs.statsAddr, "statsAddr", defaultAddrs.statsAddr, "Remote StatsD listener (host:port)")
 }
 
@@ -40,6 +41,7 @@ func init() {
 type addrs struct {
 	rpcAddr   string // RPC Listener Addr
 	grpcAddr  string // GRPC Listener Addr
+	httpAddr  string // HTTP API Listener Addr
 	statsAddr string // StatsD listener Addr
 }
 
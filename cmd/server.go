@@ -1,24 +1,28 @@
 package cmd
 
 import (
-	"errors"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime/debug"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
+	"github.com/chronomq/chronomq/internal/monitor"
 	"github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/ha"
 	"github.com/chronomq/chronomq/pkg/persistence"
 	"github.com/chronomq/chronomq/pkg/protocol"
+	"github.com/chronomq/chronomq/pkg/replication"
 )
 
 var (
@@ -26,6 +30,7 @@ var (
 	defaultAddrs = &addrs{
 		rpcAddr:   ":11301",
 		grpcAddr:  ":9999",
+		httpAddr:  ":11302",
 		statsAddr: ":8125",
 	}
 	// appCfg - wires in the application and configuration
@@ -60,7 +65,39 @@ Supported s3-compatible storage backends: s3, gs, azblob and others: https://goc
 			q.Add("prefix", appCfg.rawStoreCfg.prefix)
 			u.RawQuery = q.Encode()
 			appCfg.storeCfg.Bucket = u
-			return nil
+
+			appCfg.queueSpans = make(map[string]time.Duration, len(appCfg.rawQueueSpans))
+			for queue, span := range appCfg.rawQueueSpans {
+				if err = chronomq.ValidateQueueName(queue); err != nil {
+					return err
+				}
+				appCfg.queueSpans[queue], err = time.ParseDuration(span)
+				if err != nil {
+					return err
+				}
+			}
+
+			appCfg.walCfg.Sync, err = persistence.ParseSyncPolicy(appCfg.rawWALSync)
+			if err != nil {
+				return err
+			}
+			if appCfg.walCfg.Sync == persistence.SyncInterval && appCfg.walCfg.SyncInterval <= 0 {
+				return errors.New("The write-ahead log sync interval must be positive for the interval sync policy")
+			}
+			appCfg.codec, err = persistence.ParseCodec(appCfg.rawCodec)
+			if err != nil {
+				return err
+			}
+			if appCfg.replicaOf != "" && (appCfg.replicationAddr != "" || appCfg.ha.ID != "") {
+				return errors.New("A standby replica cannot serve replicas or be a node of a replicated cluster")
+			}
+			if appCfg.replicationAddr != "" && appCfg.ha.ID != "" {
+				return errors.New("Nodes of a replicated cluster cannot serve standby replicas")
+			}
+			if err = parseEngineConfig(appCfg); err != nil {
+				return err
+			}
+			return parseHAConfig(appCfg)
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 			log.Info().Int("PID", os.Getpid()).Msg("Starting Server")
@@ -78,9 +115,38 @@ type config struct {
 		prefix string
 	}
 
+	rawWALSync    string
+	rawCodec      string
+	rawEngine     string
+	rawQueueSpans map[string]string
+	rawHAPeers    []string
+
 	storeCfg  persistence.StoreConfig // Persistence Storage config
+	walCfg    persistence.WALConfig   // Write-ahead log config. Disabled if no dir is set
+	codec     persistence.Codec       // Encoding of jobs in snapshots and the write-ahead log
 	restore   bool                    // If true, hub will attempt restore on startup
 	spokeSpan time.Duration           // Spoke duration
+
+	snapshotInterval time.Duration // Time between background snapshots. Disabled if 0
+
+	spillHorizon time.Duration // Jobs of spokes starting later than this from now are spilled. Disabled if 0
+	spillDir     string        // Local dir spilled jobs are kept in. The store is used if empty
+
+	jobStoreCfg persistence.JobStoreConfig // Config of the leveldb job store of the leveldb engine. Disabled if no dir is set
+
+	queueSpans     map[string]time.Duration // Spoke duration of named queues. Defaults to spokeSpan
+	queueMaxCFSize uint                     // Max size of the Cuckoo Filter of named queues
+
+	backoff     chronomq.BackoffPolicy // Retries of failed jobs of all queues
+	dedupWindow time.Duration          // How long the ids of consumed jobs are remembered. Disabled if 0
+
+	deadLetterExpired bool // Move expired jobs to the dead-letter store instead of dropping them
+
+	ha ha.Config // Replicated cluster config. Disabled if no node id is set
+
+	replicationAddr string            // Address standby replicas stream the jobs from. Disabled if empty
+	replicaOf       string            // Replication address of the primary to follow as a standby replica
+	feed            *replication.Feed // Publishes the mutations of all hubs to standby replicas. Set if replicationAddr is
 }
 
 func init() {
@@ -90,6 +156,44 @@ func init() {
 	serverCmd.Flags().StringVar(&appCfg.rawStoreCfg.url, "store-url", dataDir, `Filesystem dir (default: PWD) or S3-style url.
 Examples: filesystemdir/subdir or {file|s3|gs|azblob}://bucket`)
 	serverCmd.Flags().StringVar(&appCfg.rawStoreCfg.prefix, "store-prefix", "", `Store path prefix`)
+	serverCmd.Flags().StringVar(&appCfg.walCfg.Dir, "wal-dir", "", `Local dir for the write-ahead log. Every put, cancel and consume is journaled
+and replayed on startup (implies restore). Disabled if empty`)
+	serverCmd.Flags().StringVar(&appCfg.rawWALSync, "wal-sync", "interval", "Write-ahead log fsync policy: always, interval or none")
+	serverCmd.Flags().StringVar(&appCfg.rawCodec, "codec", "gob", `Encoding of jobs in snapshots and the write-ahead log: gob or protobuf.
+Jobs written with either codec are restored regardless of this setting`)
+	serverCmd.Flags().DurationVar(&appCfg.walCfg.SyncInterval, "wal-sync-interval", time.Second, "Time between write-ahead log fsyncs for the interval sync policy")
+	serverCmd.Flags().StringToStringVar(&appCfg.rawQueueSpans, "queue-span", nil, `Spoke span of a named queue as queue=duration. Can be repeated.
+Queues without a span use --spokeSpan`)
+	serverCmd.Flags().UintVar(&appCfg.queueMaxCFSize, "queue-max-jobs", 10*1000*1000, `Max number of jobs each named queue is expected to hold.
+Sizes the queue's job id filter up front. The default queue always holds up to 500M jobs`)
+	serverCmd.Flags().DurationVar(&appCfg.snapshotInterval, "snapshot-interval", 0, `Time between background snapshots to the store. Write-ahead log segments older than
+the latest snapshot are deleted. Disabled if 0`)
+	serverCmd.Flags().DurationVar(&appCfg.spillHorizon, "spill-horizon", 0, `Offload jobs scheduled later than this from now from memory and page them back in
+as they come within the horizon. Disabled if 0`)
+	serverCmd.Flags().StringVar(&appCfg.spillDir, "spill-dir", "", `Local dir to offload jobs to (default: the store)`)
+	serverCmd.Flags().StringVar(&appCfg.rawEngine, "engine", "memory", `Where hubs keep their pending jobs: memory or leveldb.
+The leveldb engine keeps them in a local db that survives crashes without snapshots or a write-ahead log`)
+	serverCmd.Flags().StringVar(&appCfg.jobStoreCfg.Dir, "engine-dir", "", `Local dir for the dbs of the leveldb engine (default: <store-url dir>/jobs)`)
+	serverCmd.Flags().BoolVar(&appCfg.jobStoreCfg.Sync, "engine-sync", false, "Fsync every write of the leveldb engine. Only a machine crash can lose unsynced writes")
+
+	serverCmd.Flags().Int32Var(&appCfg.backoff.MaxAttempts, "max-attempts", chronomq.DefaultBackoffPolicy.MaxAttempts,
+		"Failed attempts after which a job is moved to the dead-letter store. Never if 0")
+	serverCmd.Flags().DurationVar(&appCfg.backoff.Initial, "backoff-initial", chronomq.DefaultBackoffPolicy.Initial, "Delay before a failed job is retried the first time")
+	serverCmd.Flags().DurationVar(&appCfg.backoff.Max, "backoff-max", chronomq.DefaultBackoffPolicy.Max, "Max delay before a failed job is retried")
+	serverCmd.Flags().Float64Var(&appCfg.backoff.Multiplier, "backoff-multiplier", chronomq.DefaultBackoffPolicy.Multiplier,
+		"Growth of the retry delay with every failed attempt")
+	serverCmd.Flags().DurationVar(&appCfg.dedupWindow, "dedup-window", 0, `How long the ids of consumed jobs are remembered. Jobs put again with such an id
+are treated as duplicates. Disabled if 0`)
+	serverCmd.Flags().BoolVar(&appCfg.deadLetterExpired, "dead-letter-expired", false, "Move jobs that expire before they are consumed to the dead-letter store instead of dropping them")
+
+	serverCmd.Flags().StringVar(&appCfg.ha.ID, "ha-id", "", `Id of this node in a replicated cluster, one of the --ha-peer ids.
+Only the rpc protocol is served in a cluster. Disabled if empty`)
+	serverCmd.Flags().StringArrayVar(&appCfg.rawHAPeers, "ha-peer", nil, `Node of the replicated cluster as id,raftAddr,rpcAddr. Repeat for every node including this one`)
+	serverCmd.Flags().StringVar(&appCfg.ha.Dir, "ha-dir", "", `Local dir for the raft log and snapshots of this node (default: <store-url dir>/raft)`)
+
+	serverCmd.Flags().StringVar(&appCfg.replicationAddr, "replication-addr", "", `Stream all jobs and mutations to standby replicas connecting on (host:port). Disabled if empty`)
+	serverCmd.Flags().StringVar(&appCfg.replicaOf, "replica-of", "", `Run as a standby replica of the primary with this --replication-addr (host:port).
+The replica serves no clients till it is promoted with the promote command. Only the rpc protocol is served`)
 
 	rootCmd.AddCommand(serverCmd)
 }
@@ -110,24 +214,53 @@ func startApp(cfg *config) {
 	}()
 
 	log.Info().Msg("Starting Chronomq")
-
-	storage, err := cfg.storeCfg.Storage()
-	if err != nil {
-		log.Fatal().Err(err).Msg("Cannot initialize storage")
+	if cfg.ha.ID != "" {
+		startReplica(cfg)
+		return
+	}
+	if cfg.replicaOf != "" {
+		startStandby(cfg)
+		return
+	}
+	if cfg.replicationAddr != "" {
+		cfg.feed = replication.NewFeed(cfg.codec)
 	}
 
-	opts := &chronomq.HubOpts{
-		AttemptRestore: cfg.restore,
-		SpokeSpan:      cfg.spokeSpan,
-		Persister:      persistence.NewJournalPersister(storage),
-		MaxCFSize:      chronomq.DefaultMaxCFSize,
+	queues := chronomq.NewQueueSet(func(queue string) (*chronomq.Hub, error) {
+		return newQueueHub(cfg, queue)
+	})
+	// Bring back queues that have data so their jobs are served without waiting for a put
+	for _, queue := range append([]string{chronomq.DefaultQueue}, storedQueues(cfg)...) {
+		if _, err := queues.Hub(queue); err != nil {
+			log.Fatal().Err(err).Str("queue", queue).Msg("Cannot initialize queue")
+		}
 	}
 
-	h := chronomq.NewHub(opts)
-	var rpcSRV io.Closer
+	var rpcSRV, grpcSRV, httpSRV, replicationSRV io.Closer
 	wg := sync.WaitGroup{}
+	if cfg.feed != nil {
+		var err error
+		replicationSRV, err = replication.Serve(cfg.feed, queues, cfg.replicationAddr)
+		if err != nil {
+			log.Fatal().Err(err).Str("addr", cfg.replicationAddr).Msg("Cannot start replication server")
+		}
+	}
+	go func() {
+		rpcSRV, _ = protocol.ServeQueuesRPC(queues, cfg.addrs.rpcAddr)
+	}()
+	go func() {
+		var err error
+		grpcSRV, err = protocol.ServeGRPC(queues, cfg.addrs.grpcAddr)
+		if err != nil {
+			log.Fatal().Err(err).Str("addr", cfg.addrs.grpcAddr).Msg("Cannot start grpc protocol server")
+		}
+	}()
 	go func() {
-		rpcSRV, _ = protocol.ServeRPC(h, cfg.addrs.rpcAddr)
+		var err error
+		httpSRV, err = protocol.ServeHTTPAPI(queues, cfg.addrs.httpAddr)
+		if err != nil {
+			log.Fatal().Err(err).Str("addr", cfg.addrs.httpAddr).Msg("Cannot start http protocol server")
+		}
 	}()
 
 	sigc := make(chan os.Signal, 1)
@@ -140,8 +273,279 @@ func startApp(cfg *config) {
 		log.Info().Msg("Stopping rpc protocol server")
 		rpcSRV.Close()
 		log.Info().Msg("Stopping rpc protocol server - Done")
-		h.Stop(true)
+		log.Info().Msg("Stopping grpc protocol server")
+		grpcSRV.Close()
+		log.Info().Msg("Stopping grpc protocol server - Done")
+		log.Info().Msg("Stopping http protocol server")
+		httpSRV.Close()
+		log.Info().Msg("Stopping http protocol server - Done")
+		if replicationSRV != nil {
+			log.Info().Msg("Stopping replication server")
+			replicationSRV.Close()
+			log.Info().Msg("Stopping replication server - Done")
+		}
+		queues.Stop(true)
 	}()
 
 	wg.Wait()
 }
+
+// startReplica runs the server as a node of a replicated cluster. Only the leader serves clients
+func startReplica(cfg *config) {
+	cfg.ha.Codec = cfg.codec
+	cfg.ha.HubOpts = func(queue string) *chronomq.HubOpts {
+		return queueHubOpts(cfg, queue)
+	}
+	node, err := ha.NewNode(cfg.ha)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Cannot start replicated node")
+	}
+	rpcSRV, err := protocol.ServeReplicaRPC(node, cfg.addrs.rpcAddr)
+	if err != nil {
+		log.Fatal().Err(err).Str("addr", cfg.addrs.rpcAddr).Msg("Cannot start rpc protocol server")
+	}
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGUSR1)
+	<-sigc
+	log.Info().Msg("Stopping rpc protocol server")
+	rpcSRV.Close()
+	log.Info().Msg("Stopping rpc protocol server - Done")
+	if err := node.Shutdown(); err != nil {
+		log.Error().Err(err).Msg("Replicated node shutdown error")
+	}
+}
+
+// parseHAConfig validates the replicated cluster flags. This node's addresses are taken from its --ha-peer entry
+func parseHAConfig(cfg *config) error {
+	if cfg.ha.ID == "" {
+		return nil
+	}
+	cfg.ha.Peers = nil
+	for _, raw := range cfg.rawHAPeers {
+		parts := strings.Split(raw, ",")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return errors.Errorf("Invalid peer %s. Expected id,raftAddr,rpcAddr", raw)
+		}
+		p := ha.Peer{ID: parts[0], RaftAddr: parts[1], RPCAddr: parts[2]}
+		if p.ID == cfg.ha.ID {
+			cfg.ha.Peer = p
+		}
+		cfg.ha.Peers = append(cfg.ha.Peers, p)
+	}
+	if cfg.ha.RaftAddr == "" {
+		return errors.Errorf("Node %s is not one of the peers", cfg.ha.ID)
+	}
+	if cfg.ha.Dir == "" {
+		if cfg.storeCfg.Bucket.Scheme != "file" {
+			return errors.New("Set --ha-dir when the store is not a local dir")
+		}
+		cfg.ha.Dir = filepath.Join(cfg.storeCfg.Bucket.Path, "raft")
+	}
+	return nil
+}
+
+// parseEngineConfig validates the engine flags. The leveldb engine replaces snapshots, the write-ahead log and spilling
+func parseEngineConfig(cfg *config) error {
+	switch cfg.rawEngine {
+	case "memory":
+		if cfg.jobStoreCfg.Dir != "" {
+			return errors.New("--engine-dir is only used by the leveldb engine")
+		}
+		return nil
+	case "leveldb":
+	default:
+		return errors.Errorf("Unknown engine: %s", cfg.rawEngine)
+	}
+	if cfg.walCfg.Dir != "" || cfg.snapshotInterval > 0 || cfg.spillHorizon > 0 {
+		return errors.New("The leveldb engine cannot be combined with a write-ahead log, snapshots or spilling")
+	}
+	if cfg.ha.ID != "" || cfg.replicaOf != "" {
+		return errors.New("The leveldb engine cannot run in a replicated cluster or as a standby replica")
+	}
+	if cfg.jobStoreCfg.Dir == "" {
+		if cfg.storeCfg.Bucket.Scheme != "file" {
+			return errors.New("Set --engine-dir when the store is not a local dir")
+		}
+		cfg.jobStoreCfg.Dir = filepath.Join(cfg.storeCfg.Bucket.Path, "jobs")
+	}
+	return nil
+}
+
+// queueHubOpts returns the options of the hub of a queue without its persistence
+func queueHubOpts(cfg *config, queue string) *chronomq.HubOpts {
+	opts := &chronomq.HubOpts{
+		AttemptRestore: cfg.restore,
+		SpokeSpan:      cfg.spokeSpan,
+		MaxCFSize:      chronomq.DefaultMaxCFSize,
+		Queue:          queue,
+		Backoff:        cfg.backoff,
+		DedupWindow:    cfg.dedupWindow,
+
+		DeadLetterExpired: cfg.deadLetterExpired,
+		// Dropped expired jobs were never delivered, release their memory here
+		OnExpired: func(j *chronomq.Job) {
+			monitor.GetMemMonitor().Decrement(j)
+		},
+
+		SnapshotInterval: cfg.snapshotInterval,
+		Codec:            cfg.codec,
+	}
+	if queue != chronomq.DefaultQueue {
+		opts.MaxCFSize = cfg.queueMaxCFSize
+		if span, ok := cfg.queueSpans[queue]; ok {
+			opts.SpokeSpan = span
+		}
+	}
+	return opts
+}
+
+// newQueueHub creates the hub of a queue. The default queue keeps its data at the root of the store
+// and the write-ahead log dir, named queues keep theirs under a queues/<name> prefix
+func newQueueHub(cfg *config, queue string) (*chronomq.Hub, error) {
+	storeCfg := cfg.storeCfg
+	walCfg := cfg.walCfg
+	walCfg.Codec = cfg.codec
+	opts := queueHubOpts(cfg, queue)
+	if queue != chronomq.DefaultQueue {
+		storeCfg.Queue = queue
+		walCfg.Queue = queue
+	}
+
+	storage, err := storeCfg.Storage()
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot initialize storage")
+	}
+	opts.Persister = persistence.NewJournalPersisterWithCodec(storage, cfg.codec)
+
+	if walCfg.Dir != "" {
+		opts.WAL, err = persistence.NewWAL(walCfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot initialize write-ahead log")
+		}
+		// Jobs in the log are only useful if they are replayed
+		opts.AttemptRestore = true
+	}
+	if cfg.jobStoreCfg.Dir != "" {
+		jobStoreCfg := cfg.jobStoreCfg
+		jobStoreCfg.Codec = cfg.codec
+		if queue != chronomq.DefaultQueue {
+			jobStoreCfg.Queue = queue
+		}
+		opts.Store, err = persistence.NewJobStore(jobStoreCfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot initialize job store")
+		}
+		// The store journals the hub's mutations itself
+		opts.WAL = opts.Store
+	}
+	if cfg.feed != nil {
+		opts.WAL = cfg.feed.WAL(queue, opts.WAL)
+	}
+	if cfg.spillHorizon > 0 {
+		spillCfg := storeCfg
+		if cfg.spillDir != "" {
+			dir, err := filepath.Abs(cfg.spillDir)
+			if err == nil {
+				err = os.MkdirAll(dir, os.ModeDir|os.FileMode(0755))
+			}
+			if err != nil {
+				return nil, errors.Wrap(err, "Cannot create spill dir")
+			}
+			spillCfg.Bucket = &url.URL{Scheme: "file", Path: dir}
+		}
+		opts.Spill, err = persistence.NewSpillStore(spillCfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot initialize spill store")
+		}
+		opts.SpillHorizon = cfg.spillHorizon
+		// Spilled jobs don't take memory, producers are not fenced for them
+		opts.OnSpilled = func(j *chronomq.Job) {
+			monitor.GetMemMonitor().Decrement(j)
+		}
+		opts.OnPagedIn = func(j *chronomq.Job) {
+			monitor.GetMemMonitor().Increment(j)
+		}
+	}
+	return chronomq.NewHub(opts), nil
+}
+
+// startStandby runs the server as a standby replica of a primary. It serves clients once it is promoted
+func startStandby(cfg *config) {
+	standby := replication.Follow(cfg.replicaOf, func(queue string) (*chronomq.Hub, error) {
+		return newStandbyHub(cfg, queue)
+	})
+	rpcSRV, err := protocol.ServeReplicaRPC(standby, cfg.addrs.rpcAddr)
+	if err != nil {
+		log.Fatal().Err(err).Str("addr", cfg.addrs.rpcAddr).Msg("Cannot start rpc protocol server")
+	}
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGUSR1)
+	<-sigc
+	log.Info().Msg("Stopping rpc protocol server")
+	rpcSRV.Close()
+	log.Info().Msg("Stopping rpc protocol server - Done")
+	// Only a promoted replica owns its jobs and persists them
+	standby.Stop(true)
+}
+
+// newStandbyHub creates the hub of a queue of a standby replica. It neither restores, journals nor takes
+// snapshots in the background, so that a replica never writes to a store or log it shares with its primary
+func newStandbyHub(cfg *config, queue string) (*chronomq.Hub, error) {
+	storeCfg := cfg.storeCfg
+	if queue != chronomq.DefaultQueue {
+		storeCfg.Queue = queue
+	}
+	storage, err := storeCfg.Storage()
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot initialize storage")
+	}
+	opts := queueHubOpts(cfg, queue)
+	opts.Persister = persistence.NewJournalPersisterWithCodec(storage, cfg.codec)
+	opts.AttemptRestore = false
+	opts.SnapshotInterval = 0
+	return chronomq.NewHub(opts), nil
+}
+
+// storedQueues lists the named queues with data in the store, the write-ahead log dir or the job store dir
+func storedQueues(cfg *config) []string {
+	names := map[string]bool{}
+	if cfg.restore {
+		queues, err := cfg.storeCfg.Queues()
+		if err != nil {
+			log.Error().Err(err).Msg("Cannot list queues in store")
+		}
+		for _, q := range queues {
+			names[q] = true
+		}
+	}
+	if cfg.walCfg.Dir != "" {
+		queues, err := cfg.walCfg.Queues()
+		if err != nil {
+			log.Error().Err(err).Msg("Cannot list queues in write-ahead log dir")
+		}
+		for _, q := range queues {
+			names[q] = true
+		}
+	}
+	if cfg.jobStoreCfg.Dir != "" {
+		queues, err := cfg.jobStoreCfg.Queues()
+		if err != nil {
+			log.Error().Err(err).Msg("Cannot list queues in job store dir")
+		}
+		for _, q := range queues {
+			names[q] = true
+		}
+	}
+
+	queues := []string{}
+	for q := range names {
+		if err := chronomq.ValidateQueueName(q); err != nil {
+			log.Warn().Str("queue", q).Msg("Ignoring stored queue with invalid name")
+			continue
+		}
+		queues = append(queues, q)
+	}
+	return queues
+}
@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"container/heap"
 	"time"
 )
 
@@ -8,13 +9,19 @@ import (
 type Item struct {
 	value    interface{} // The value of the item; Spoke or Job.
 	priority time.Time   // The priority of the item in the queue.
+	rank     int32       // Breaks ties between items with the same priority. Higher ranks come first
 	// The index is needed by update and is maintained by the heap.Interface methods.
 	index int // The index of the item in the heap.
 }
 
 // NewItem wraps a value in a Queue Item
 func NewItem(value interface{}, priority time.Time) *Item {
-	return &Item{value, priority, 0}
+	return &Item{value, priority, 0, 0}
+}
+
+// NewRankedItem wraps a value in a Queue Item which is ordered by rank among items with the same priority
+func NewRankedItem(value interface{}, priority time.Time, rank int32) *Item {
+	return &Item{value, priority, rank, 0}
 }
 
 // Value pointed to by the item
@@ -27,11 +34,23 @@ func (i *Item) Priority() time.Time {
 	return i.priority
 }
 
+// Rank of the item
+func (i *Item) Rank() int32 {
+	return i.rank
+}
+
 // Index of the item
 func (i *Item) Index() int {
 	return i.index
 }
 
+// Queue is a heap of Items that allows peeking at any index
+type Queue interface {
+	heap.Interface
+	// AtIdx gets item at given index
+	AtIdx(i int) *Item
+}
+
 // A PriorityQueue implements heap.Interface and holds Items.
 type PriorityQueue []*Item
 
@@ -42,7 +61,11 @@ func (pq PriorityQueue) Len() int { return len(pq) }
 func (pq PriorityQueue) Cap() int { return cap(pq) }
 
 // Less defines item ordering. Priority is defined by trigger time in the future
+// Items with the same trigger time are ordered by their rank
 func (pq PriorityQueue) Less(i, j int) bool {
+	if pq[i].priority.Equal(pq[j].priority) {
+		return pq[i].rank > pq[j].rank
+	}
 	// We want Pop to give us the item nearest in time, not highest.
 	// if i starts AFTER j, i has lower priority
 	return pq[i].priority.Before(pq[j].priority)
@@ -80,3 +103,17 @@ func (pq *PriorityQueue) Pop() interface{} {
 func (pq PriorityQueue) AtIdx(i int) *Item {
 	return pq[i]
 }
+
+// ReadyQueue holds Items whose trigger time has already passed, so their trigger time no longer decides
+// which one is more urgent. Items are ordered by rank first and then by their trigger time
+type ReadyQueue struct {
+	PriorityQueue
+}
+
+// Less defines item ordering. Higher ranks come first and items of the same rank are ordered by trigger time
+func (rq ReadyQueue) Less(i, j int) bool {
+	if rq.PriorityQueue[i].rank != rq.PriorityQueue[j].rank {
+		return rq.PriorityQueue[i].rank > rq.PriorityQueue[j].rank
+	}
+	return rq.PriorityQueue[i].priority.Before(rq.PriorityQueue[j].priority)
+}
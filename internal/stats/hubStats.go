@@ -13,7 +13,11 @@ type Counters struct {
 type Snapshot struct {
 	CurrentJobs   int64 // current set of jobs
 	RemovedJobs   int64 // jobs removed so far
+	ReservedJobs  int64 // jobs handed out to consumers but not acknowledged yet
+	DeadJobs      int64 // jobs in the dead-letter store
+	ExpiredJobs   int64 // jobs that expired before they were consumed so far
 	CurrentSpokes int64 // number of current spokes
+	SpilledJobs   int64 // pending jobs offloaded to the spill store. They are counted in CurrentJobs as well
 }
 
 // Read returns a "copy" of the current stats snapshot at that instant
@@ -21,7 +25,11 @@ func (c *Counters) Read() Snapshot {
 	r := Snapshot{}
 	r.CurrentJobs = atomic.LoadInt64(&c.s.CurrentJobs)
 	r.RemovedJobs = atomic.LoadInt64(&c.s.RemovedJobs)
+	r.ReservedJobs = atomic.LoadInt64(&c.s.ReservedJobs)
+	r.DeadJobs = atomic.LoadInt64(&c.s.DeadJobs)
+	r.ExpiredJobs = atomic.LoadInt64(&c.s.ExpiredJobs)
 	r.CurrentSpokes = atomic.LoadInt64(&c.s.CurrentSpokes)
+	r.SpilledJobs = atomic.LoadInt64(&c.s.SpilledJobs)
 	return r
 }
 
@@ -36,6 +44,31 @@ func (c *Counters) DecrJob() {
 	atomic.AddInt64(&c.s.RemovedJobs, 1)
 }
 
+// IncrReserved updates counters - job has been reserved by a consumer
+func (c *Counters) IncrReserved() {
+	atomic.AddInt64(&c.s.ReservedJobs, 1)
+}
+
+// DecrReserved updates counters - reservation has been acknowledged, released or has expired
+func (c *Counters) DecrReserved() {
+	atomic.AddInt64(&c.s.ReservedJobs, -1)
+}
+
+// IncrDead updates counters - job has been moved to the dead-letter store
+func (c *Counters) IncrDead() {
+	atomic.AddInt64(&c.s.DeadJobs, 1)
+}
+
+// DecrDead updates counters - dead-lettered job has been requeued, purged or canceled
+func (c *Counters) DecrDead() {
+	atomic.AddInt64(&c.s.DeadJobs, -1)
+}
+
+// IncrExpired updates counters - job has expired before it was consumed
+func (c *Counters) IncrExpired() {
+	atomic.AddInt64(&c.s.ExpiredJobs, 1)
+}
+
 // IncrSpoke updates counters - spoke has been added
 func (c *Counters) IncrSpoke() {
 	atomic.AddInt64(&c.s.CurrentSpokes, 1)
@@ -45,3 +78,8 @@ func (c *Counters) IncrSpoke() {
 func (c *Counters) DecrSpoke() {
 	atomic.AddInt64(&c.s.CurrentSpokes, -1)
 }
+
+// AddSpilled updates counters - jobs have been spilled if n is positive or paged back in if n is negative
+func (c *Counters) AddSpilled(n int64) {
+	atomic.AddInt64(&c.s.SpilledJobs, n)
+}
@@ -0,0 +1,208 @@
+package chronomq
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronomq/chronomq/pkg/metrics"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+// ErrJobNotDead is returned when inspecting or requeueing a job that is not in the dead-letter store
+var ErrJobNotDead = errors.New("Job is not in the dead-letter store")
+
+// DefaultBackoffPolicy retries failed jobs after 1s, 2s, 4s... up to an hour apart and dead-letters them
+// after the 10th failed attempt
+var DefaultBackoffPolicy = BackoffPolicy{
+	Initial:     time.Second,
+	Max:         time.Hour,
+	Multiplier:  2,
+	MaxAttempts: 10,
+}
+
+// BackoffPolicy decides when failed jobs are retried and when they are given up on
+type BackoffPolicy struct {
+	Initial     time.Duration // Delay before the first retry
+	Max         time.Duration // Upper bound of the delay between retries. No bound if 0
+	Multiplier  float64       // Growth of the delay with every failed attempt. Values below 1 keep the delay constant
+	MaxAttempts int32         // Failed attempts after which a job is moved to the dead-letter store. Never if 0
+}
+
+// Delay returns how long to wait before retrying a job that failed for the given number of times
+func (p BackoffPolicy) Delay(attempts int32) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	multiplier := math.Max(p.Multiplier, 1)
+	delay := float64(p.Initial) * math.Pow(multiplier, float64(attempts-1))
+	if p.Max > 0 && delay > float64(p.Max) {
+		return p.Max
+	}
+	if delay > float64(hundredYears) {
+		return hundredYears
+	}
+	return time.Duration(delay)
+}
+
+// IsExhausted returns true if a job that failed for the given number of times should not be retried anymore
+func (p BackoffPolicy) IsExhausted(attempts int32) bool {
+	return p.MaxAttempts > 0 && attempts >= p.MaxAttempts
+}
+
+// deadLetters holds jobs that failed too often to be retried. They stay there till they are requeued, purged
+// or canceled. It is not safe for concurrent use - Lock the hub before calling any of its methods
+type deadLetters struct {
+	jobMap map[string]*Job
+}
+
+func newDeadLetters() *deadLetters {
+	return &deadLetters{jobMap: make(map[string]*Job)}
+}
+
+func (d *deadLetters) add(j *Job) {
+	d.jobMap[j.ID()] = j
+}
+
+// remove deletes the job with the given id and returns it if it was dead-lettered
+func (d *deadLetters) remove(id string) *Job {
+	j, ok := d.jobMap[id]
+	if !ok {
+		return nil
+	}
+	delete(d.jobMap, id)
+	return j
+}
+
+func (d *deadLetters) get(id string) *Job {
+	return d.jobMap[id]
+}
+
+// jobs returns up to n dead-lettered jobs, the ones that died first first. All jobs are returned if n < 0
+func (d *deadLetters) jobs(n int) []*Job {
+	jobs := make([]*Job, 0, len(d.jobMap))
+	for _, j := range d.jobMap {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		if jobs[a].deadAt.Equal(jobs[b].deadAt) {
+			return jobs[a].id < jobs[b].id
+		}
+		return jobs[a].deadAt.Before(jobs[b].deadAt)
+	})
+	if n >= 0 && n < len(jobs) {
+		jobs = jobs[:n]
+	}
+	return jobs
+}
+
+// NackLocked fails a reserved job. The job is retried after the delay of the hub's backoff policy or,
+// once it failed for the max number of attempts, moved to the dead-letter store. Returns true if the job was dead-lettered
+func (h *Hub) NackLocked(jobID string) (bool, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	j := h.reserved.remove(jobID)
+	if j == nil {
+		return false, ErrJobNotReserved
+	}
+	h.stats.DecrReserved()
+	j.attempts++
+
+	if h.backoff.IsExhausted(j.attempts) {
+		j.deadAt = time.Now()
+		h.dead.add(j)
+		h.stats.IncrDead()
+		h.journal(persistence.OpPut, j)
+		log.Info().Str("queue", h.queue).Str("jobID", jobID).Int32("attempts", j.attempts).Msg("Hub: Moved job to the dead-letter store")
+		go metrics.Incr("hub.nack.dead")
+		return true, nil
+	}
+
+	j.triggerAt = time.Now().Add(h.backoff.Delay(j.attempts))
+	h.journal(persistence.OpPut, j)
+	if err := h.addJob(j); err != nil {
+		h.forget(j)
+		return false, err
+	}
+	h.stats.IncrJob()
+	go metrics.Incr("hub.nack")
+	return false, nil
+}
+
+// DeadLettersLocked returns copies of up to n dead-lettered jobs, the ones that died first first
+func (h *Hub) DeadLettersLocked(n int) []*Job {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	jobs := h.dead.jobs(n)
+	for i, j := range jobs {
+		jc := *j
+		jobs[i] = &jc
+	}
+	return jobs
+}
+
+// DeadLetterLocked returns a copy of the dead-lettered job with the given id
+func (h *Hub) DeadLetterLocked(jobID string) (*Job, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	j := h.dead.get(jobID)
+	if j == nil {
+		return nil, ErrJobNotDead
+	}
+	jc := *j
+	return &jc, nil
+}
+
+// RequeueDeadLocked moves a job out of the dead-letter store back into the hub with its attempts and expiry reset.
+// The job is ready again after the given delay
+func (h *Hub) RequeueDeadLocked(jobID string, delay time.Duration) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	j := h.dead.remove(jobID)
+	if j == nil {
+		return ErrJobNotDead
+	}
+	h.stats.DecrDead()
+	j.attempts = 0
+	j.deadAt = time.Time{}
+	// Expired jobs would expire again right away
+	j.expireAt = time.Time{}
+	j.triggerAt = time.Now().Add(delay)
+	h.journal(persistence.OpPut, j)
+	if err := h.addJob(j); err != nil {
+		h.forget(j)
+		return err
+	}
+	h.stats.IncrJob()
+	go metrics.Incr("hub.dead.requeue")
+	return nil
+}
+
+// PurgeDeadLocked deletes the dead-lettered jobs with the given ids or all of them if no ids are given.
+// Returns the deleted jobs. Ids of jobs that are not dead-lettered are ignored
+func (h *Hub) PurgeDeadLocked(jobIDs ...string) []*Job {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(jobIDs) == 0 {
+		for _, j := range h.dead.jobs(-1) {
+			jobIDs = append(jobIDs, j.ID())
+		}
+	}
+	var purged []*Job
+	for _, jobID := range jobIDs {
+		if j := h.dead.remove(jobID); j != nil {
+			h.forget(j)
+			h.stats.DecrDead()
+			h.journal(persistence.OpCancel, j)
+			purged = append(purged, j)
+		}
+	}
+	go metrics.Count("hub.dead.purge", len(purged))
+	return purged
+}
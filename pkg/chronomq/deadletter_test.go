@@ -0,0 +1,143 @@
+package chronomq_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+var _ = Describe("Test dead-letter store", func() {
+	var p persistence.Persister
+	policy := BackoffPolicy{Initial: time.Millisecond * 50, Max: time.Millisecond * 150, Multiplier: 2, MaxAttempts: 3}
+
+	BeforeEach(func() {
+		store, err := persistence.InMemStorage()
+		Expect(err).NotTo(HaveOccurred())
+		p = persistence.NewJournalPersister(store)
+	})
+
+	It("backs off exponentially up to the max delay", func() {
+		Expect(policy.Delay(1)).To(Equal(time.Millisecond * 50))
+		Expect(policy.Delay(2)).To(Equal(time.Millisecond * 100))
+		Expect(policy.Delay(3)).To(Equal(time.Millisecond * 150))
+		Expect(policy.Delay(100)).To(Equal(time.Millisecond * 150))
+		Expect(policy.IsExhausted(2)).To(BeFalse())
+		Expect(policy.IsExhausted(3)).To(BeTrue())
+
+		unbounded := BackoffPolicy{Initial: time.Second, Multiplier: 10}
+		Expect(unbounded.Delay(1000)).To(BeNumerically(">", time.Hour*24*365))
+		Expect(unbounded.IsExhausted(1000)).To(BeFalse())
+	})
+
+	It("retries failed jobs and dead-letters them after the max attempts", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p, Backoff: policy})
+		defer h.Stop(false)
+
+		j := NewJob("fail", time.Now(), []byte("fail"))
+		j.SetOpts(0, time.Minute)
+		Expect(h.AddJobLocked(j)).To(Succeed())
+
+		_, err := h.NackLocked("fail")
+		Expect(err).To(Equal(ErrJobNotReserved))
+
+		for attempt := int32(1); attempt < policy.MaxAttempts; attempt++ {
+			Expect(h.NextLocked()).To(Equal(j))
+			failedAt := time.Now()
+			dead, err := h.NackLocked("fail")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dead).To(BeFalse())
+			Expect(j.Attempts()).To(Equal(attempt))
+			Expect(j.TriggerAt()).To(BeTemporally("~", failedAt.Add(policy.Delay(attempt)), time.Millisecond*10))
+			Expect(h.NextLocked()).To(BeNil())
+			Eventually(h.Ready(), time.Second).Should(BeClosed())
+		}
+
+		Expect(h.NextLocked()).To(Equal(j))
+		dead, err := h.NackLocked("fail")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dead).To(BeTrue())
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(0)))
+		Expect(h.Stats().DeadJobs).To(Equal(int64(1)))
+
+		// Dead-lettered jobs keep their id and are never handed out
+		Expect(h.AddJobLocked(NewJob("fail", time.Now(), nil))).NotTo(Succeed())
+		Consistently(h.NextLocked, time.Millisecond*200).Should(BeNil())
+
+		deadJobs := h.DeadLettersLocked(10)
+		Expect(deadJobs).To(HaveLen(1))
+		Expect(deadJobs[0].ID()).To(Equal("fail"))
+		Expect(deadJobs[0].Attempts()).To(Equal(policy.MaxAttempts))
+		Expect(deadJobs[0].DeadAt()).NotTo(BeZero())
+		_, err = h.DeadLetterLocked("unknown")
+		Expect(err).To(Equal(ErrJobNotDead))
+
+		// Requeued jobs start over
+		Expect(h.RequeueDeadLocked("fail", 0)).To(Succeed())
+		Expect(h.RequeueDeadLocked("fail", 0)).To(Equal(ErrJobNotDead))
+		Expect(h.Stats().DeadJobs).To(Equal(int64(0)))
+		requeued := h.NextLocked()
+		Expect(requeued.ID()).To(Equal("fail"))
+		Expect(requeued.Attempts()).To(BeZero())
+		Expect(requeued.DeadAt()).To(BeZero())
+	}, 5)
+
+	It("purges and cancels dead-lettered jobs", func() {
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p, Backoff: BackoffPolicy{MaxAttempts: 1}})
+		defer h.Stop(false)
+
+		for _, id := range []string{"a", "b", "c"} {
+			j := NewJob(id, time.Now(), nil)
+			j.SetOpts(0, time.Minute)
+			Expect(h.AddJobLocked(j)).To(Succeed())
+			Expect(h.NextLocked().ID()).To(Equal(id))
+			Expect(h.NackLocked(id)).To(BeTrue())
+		}
+		Expect(h.DeadLettersLocked(2)).To(HaveLen(2))
+
+		Expect(h.CancelJobLocked("a")).NotTo(BeNil())
+		Expect(h.PurgeDeadLocked("b", "unknown")).To(HaveLen(1))
+		Expect(h.PurgeDeadLocked()).To(HaveLen(1))
+		Expect(h.DeadLettersLocked(10)).To(BeEmpty())
+		Expect(h.Stats().DeadJobs).To(Equal(int64(0)))
+		Expect(h.AddJobLocked(NewJob("c", time.Now(), nil))).To(Succeed())
+	})
+
+	It("restores dead-lettered jobs into the dead-letter store", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p, Backoff: BackoffPolicy{MaxAttempts: 2}})
+
+		fail := func(id string, attempts int) {
+			j := NewJob(id, time.Now(), nil)
+			j.SetOpts(0, time.Minute)
+			Expect(h.AddJobLocked(j)).To(Succeed())
+			for i := 1; i <= attempts; i++ {
+				Expect(h.NextLocked().ID()).To(Equal(id))
+				Expect(h.NackLocked(id)).To(Equal(i == 2))
+			}
+		}
+		fail("dead", 2)
+		fail("retry", 1)
+		h.Stop(true)
+
+		restored := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+		defer restored.Stop(false)
+		Expect(restored.Restore()).To(Succeed())
+		Expect(restored.Stats().CurrentJobs).To(Equal(int64(1)))
+		Expect(restored.Stats().DeadJobs).To(Equal(int64(1)))
+
+		dead, err := restored.DeadLetterLocked("dead")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dead.Attempts()).To(Equal(int32(2)))
+		Expect(dead.DeadAt()).NotTo(BeZero())
+
+		j := restored.NextLocked()
+		Expect(j.ID()).To(Equal("retry"))
+		Expect(j.Attempts()).To(Equal(int32(1)))
+		Expect(restored.NextLocked()).To(BeNil())
+	}, 5)
+})
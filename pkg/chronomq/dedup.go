@@ -0,0 +1,157 @@
+package chronomq
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/chronomq/chronomq/pkg/metrics"
+)
+
+// DuplicatePolicy decides what happens when a job is put with the id of a job the hub already holds
+type DuplicatePolicy int
+
+const (
+	// RejectDuplicates fails the put with ErrJobExists
+	RejectDuplicates DuplicatePolicy = iota
+	// IgnoreDuplicates succeeds without changing anything if the existing job has the same body, priority and
+	// time-to-run. Trigger times are not compared since retried puts with a delay compute a later one.
+	// Puts of a different job with the same id fail with ErrJobExists
+	IgnoreDuplicates
+	// ReplaceDuplicates overwrites a pending job with the new one. Reserved and dead-lettered jobs can't be
+	// replaced, those puts fail with ErrJobExists
+	ReplaceDuplicates
+)
+
+// PutOutcome tells what a put with a duplicate policy did
+type PutOutcome struct {
+	Added    bool // The hub holds the new job now. False if the put was ignored as a duplicate
+	Replaced *Job // The pending job the new job replaced, if any
+}
+
+// PutJobLocked adds a job, handling jobs with the id of an existing job according to the policy
+func (h *Hub) PutJobLocked(j *Job, policy DuplicatePolicy) (PutOutcome, error) {
+	defer metrics.Time("hub.job.add.duration", time.Now())
+	go metrics.GaugeInt("hub.job.size", len(j.Body()))
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.put(j, policy)
+}
+
+// PutJobsLocked puts a batch of jobs with the same duplicate policy taking the hub lock only once.
+// The returned slices hold the outcome and the error of every job in order
+func (h *Hub) PutJobsLocked(jobs []*Job, policy DuplicatePolicy) ([]PutOutcome, []error) {
+	defer metrics.Time("hub.job.add.batch.duration", time.Now())
+	outcomes := make([]PutOutcome, len(jobs))
+	errs := make([]error, len(jobs))
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i, j := range jobs {
+		go metrics.GaugeInt("hub.job.size", len(j.Body()))
+		outcomes[i], errs[i] = h.put(j, policy)
+	}
+	return outcomes, errs
+}
+
+// put adds a job according to the duplicate policy. Lock the hub before calling this
+func (h *Hub) put(j *Job, policy DuplicatePolicy) (PutOutcome, error) {
+	switch policy {
+	case IgnoreDuplicates:
+		if existing, _ := h.get(j.ID()); existing != nil {
+			if !existing.isDuplicateOf(j) {
+				return PutOutcome{}, errors.Wrapf(ErrJobExists, "Rejecting new job. A different job with ID: %s", j.ID())
+			}
+			go metrics.Incr("hub.put.duplicate.ignored")
+			return PutOutcome{}, nil
+		}
+		if h.consumed.contains(j.ID()) {
+			go metrics.Incr("hub.put.duplicate.ignored")
+			return PutOutcome{}, nil
+		}
+	case ReplaceDuplicates:
+		if h.exists(j.ID()) {
+			replaced, err := h.update(j.ID(), func(pending *Job) {
+				*pending = *j
+			})
+			if errors.Cause(err) == ErrJobNotFound {
+				return PutOutcome{}, errors.Wrapf(ErrJobExists, "Rejecting new job. Cannot replace reserved or dead-lettered job with ID: %s", j.ID())
+			}
+			if err != nil {
+				return PutOutcome{}, err
+			}
+			go metrics.Incr("hub.put.duplicate.replaced")
+			return PutOutcome{Added: true, Replaced: replaced}, nil
+		}
+		// Replacing a consumed job puts it again
+		h.consumed.remove(j.ID())
+	}
+	if err := h.add(j); err != nil {
+		return PutOutcome{}, err
+	}
+	return PutOutcome{Added: true}, nil
+}
+
+// isDuplicateOf returns true if both jobs carry the same work. Trigger times are not compared
+func (j *Job) isDuplicateOf(other *Job) bool {
+	return bytes.Equal(j.body, other.body) && j.pri == other.pri && j.ttr == other.ttr
+}
+
+// consumedIDs remembers the ids of consumed jobs for a retention window so that jobs put again after they
+// were delivered - like retries of puts that timed out on the client - are treated as duplicates.
+// It is not safe for concurrent use - Lock the hub before calling any of its methods
+type consumedIDs struct {
+	window time.Duration // Nothing is remembered if 0
+	at     map[string]time.Time
+	order  []consumedID // In the order the jobs were consumed
+}
+
+type consumedID struct {
+	id string
+	at time.Time
+}
+
+func newConsumedIDs(window time.Duration) *consumedIDs {
+	return &consumedIDs{window: window, at: make(map[string]time.Time)}
+}
+
+// add remembers that the job with the given id was consumed now
+func (c *consumedIDs) add(id string) {
+	if c.window <= 0 {
+		return
+	}
+	now := time.Now()
+	c.prune(now)
+	c.at[id] = now
+	c.order = append(c.order, consumedID{id: id, at: now})
+}
+
+// contains returns true if the job with the given id was consumed within the window
+func (c *consumedIDs) contains(id string) bool {
+	if len(c.at) == 0 {
+		return false
+	}
+	c.prune(time.Now())
+	_, ok := c.at[id]
+	return ok
+}
+
+// remove forgets that the job with the given id was consumed
+func (c *consumedIDs) remove(id string) {
+	delete(c.at, id)
+}
+
+// prune forgets ids consumed before the window
+func (c *consumedIDs) prune(now time.Time) {
+	cutoff := now.Add(-c.window)
+	for len(c.order) > 0 && c.order[0].at.Before(cutoff) {
+		oldest := c.order[0]
+		// The id may have been removed or consumed again since
+		if at, ok := c.at[oldest.id]; ok && at.Equal(oldest.at) {
+			delete(c.at, oldest.id)
+		}
+		c.order = c.order[1:]
+	}
+}
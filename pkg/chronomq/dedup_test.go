@@ -0,0 +1,138 @@
+package chronomq_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	. "github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+var _ = Describe("Test duplicate jobs", func() {
+	var p persistence.Persister
+
+	BeforeEach(func() {
+		store, err := persistence.InMemStorage()
+		Expect(err).NotTo(HaveOccurred())
+		p = persistence.NewJournalPersister(store)
+	})
+
+	It("handles duplicates according to the put's policy", func() {
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+		defer h.Stop(false)
+
+		at := time.Now().Add(time.Hour)
+		outcome, err := h.PutJobLocked(NewJob("id", at, []byte("v1")), RejectDuplicates)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outcome).To(Equal(PutOutcome{Added: true}))
+		_, err = h.PutJobLocked(NewJob("id", at, []byte("v1")), RejectDuplicates)
+		Expect(errors.Cause(err)).To(Equal(ErrJobExists))
+
+		outcome, err = h.PutJobLocked(NewJob("id", at.Add(time.Second), []byte("v1")), IgnoreDuplicates)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outcome.Added).To(BeFalse())
+		_, err = h.PutJobLocked(NewJob("id", at, []byte("v2")), IgnoreDuplicates)
+		Expect(errors.Cause(err)).To(Equal(ErrJobExists))
+
+		outcome, err = h.PutJobLocked(NewJob("id", at.Add(time.Minute), []byte("v2")), ReplaceDuplicates)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outcome.Added).To(BeTrue())
+		Expect(string(outcome.Replaced.Body())).To(Equal("v1"))
+		j, state, err := h.GetJobLocked("id")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(JobPending))
+		Expect(string(j.Body())).To(Equal("v2"))
+		Expect(j.TriggerAt()).To(BeTemporally("==", at.Add(time.Minute)))
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(1)))
+
+		reserved := NewJob("reserved", time.Now(), nil)
+		reserved.SetOpts(0, time.Minute)
+		Expect(h.AddJobLocked(reserved)).To(Succeed())
+		Eventually(h.NextLocked, 2).ShouldNot(BeNil())
+		_, err = h.PutJobLocked(NewJob("reserved", at, nil), ReplaceDuplicates)
+		Expect(errors.Cause(err)).To(Equal(ErrJobExists))
+
+		outcomes, errs := h.PutJobsLocked([]*Job{NewJob("id", at, []byte("v2")), NewJob("new", at, nil)}, IgnoreDuplicates)
+		Expect(errs).To(Equal([]error{nil, nil}))
+		Expect(outcomes).To(Equal([]PutOutcome{{}, {Added: true}}))
+	})
+
+	It("remembers consumed ids for the dedup window", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p, DedupWindow: time.Millisecond * 500})
+		defer h.Stop(false)
+
+		Expect(h.AddJobLocked(NewJob("once", time.Now(), []byte("once")))).To(Succeed())
+		Eventually(h.NextLocked, 2).ShouldNot(BeNil())
+		Expect(errors.Cause(h.AddJobLocked(NewJob("once", time.Now(), nil)))).To(Equal(ErrJobExists))
+		outcome, err := h.PutJobLocked(NewJob("once", time.Now(), []byte("once")), IgnoreDuplicates)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outcome.Added).To(BeFalse())
+
+		// Replacing a consumed job puts it again
+		reserved := NewJob("reserved", time.Now(), nil)
+		reserved.SetOpts(0, time.Minute)
+		Expect(h.AddJobLocked(reserved)).To(Succeed())
+		Eventually(h.NextLocked, 2).ShouldNot(BeNil())
+		_, err = h.AckLocked("reserved")
+		Expect(err).NotTo(HaveOccurred())
+		outcome, err = h.PutJobLocked(NewJob("reserved", time.Now().Add(time.Hour), nil), ReplaceDuplicates)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outcome).To(Equal(PutOutcome{Added: true}))
+
+		time.Sleep(time.Millisecond * 600)
+		Expect(h.AddJobLocked(NewJob("once", time.Now(), nil))).To(Succeed())
+	}, 5)
+
+	It("returns undelivered jobs intact regardless of the dedup window", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p, DedupWindow: time.Minute})
+		defer h.Stop(false)
+
+		j := NewJob("undelivered", time.Now().Add(-time.Second), []byte("body"))
+		j.SetTags("t")
+		j.SetHeaders(map[string]string{"k": "v"})
+		Expect(j.SetExpiry(time.Now().Add(time.Hour))).To(Succeed())
+		Expect(h.AddJobLocked(j)).To(Succeed())
+		taken := h.NextLocked()
+		Expect(taken).To(Equal(j))
+		Expect(h.ReturnLocked(taken)).To(Succeed())
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(1)))
+		Expect(h.NextLocked()).To(Equal(j))
+		Expect(j.Tags()).To(Equal([]string{"t"}))
+		Expect(j.Headers()).To(Equal(map[string]string{"k": "v"}))
+		// Once delivered, the job is a duplicate again
+		Expect(errors.Cause(h.AddJobLocked(NewJob("undelivered", time.Now(), nil)))).To(Equal(ErrJobExists))
+
+		reserved := NewJob("reserved", time.Now().Add(-time.Second), nil)
+		reserved.SetOpts(0, time.Minute)
+		Expect(h.AddJobLocked(reserved)).To(Succeed())
+		Expect(h.NextLocked()).To(Equal(reserved))
+		Expect(h.ReturnLocked(reserved)).To(Succeed())
+		_, state, err := h.GetJobLocked("reserved")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(JobPending))
+		Expect(h.CancelJobLocked("reserved")).NotTo(BeNil())
+
+		s, err := NewSchedule("@every 1h", "", time.Time{})
+		Expect(err).NotTo(HaveOccurred())
+		recurring := NewJob("recurring", time.Now().Add(-time.Hour-time.Second), nil)
+		Expect(recurring.SetSchedule(s)).To(Succeed())
+		Expect(h.AddJobLocked(recurring)).To(Succeed())
+		occurrence := h.NextLocked()
+		Expect(occurrence.ID()).To(Equal("recurring"))
+		Expect(h.NextLocked()).To(BeNil())
+		at := occurrence.TriggerAt()
+		Expect(h.ReturnLocked(occurrence)).To(Succeed())
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(1)))
+		again := h.NextLocked()
+		Expect(again).NotTo(BeNil())
+		Expect(again.TriggerAt()).To(BeTemporally("==", at))
+		j, _, err = h.GetJobLocked("recurring")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.TriggerAt()).To(BeTemporally(">", time.Now()))
+	}, 5)
+})
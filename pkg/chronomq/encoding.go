@@ -0,0 +1,308 @@
+package chronomq
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// Jobs are persisted in snapshots and the write-ahead log as records that start with a two byte header:
+// formatMagic followed by the format version. Records written before the header was introduced are a bare
+// sequence of gob values and are decoded by decodeLegacy.
+//
+// Add a new version - and a golden record in testdata/persist_golden/records - whenever the record changes
+// in a way older decoders can't read. Decoders of all earlier versions must be kept.
+
+// formatMagic starts every versioned job record. A gob stream never starts with this byte - gob encodes
+// the length of its first message either as a single byte below 0x80 or as a byte count from 0xf8 up -
+// so versioned records can't be mistaken for legacy ones
+const formatMagic byte = 0xc7
+
+// Job record format versions
+const (
+	// formatV1 is a gob encoded jobRecordV1. Gob matches struct fields by name, so fields can be added
+	// to jobRecordV1 without a new version as long as their zero value means "not set"
+	formatV1 byte = 1
+
+	// formatProto is a jobProto protocol buffer, the message Job of job.proto. It is written by the protobuf codec
+	// of the persistence package so that other languages can read snapshots and logs. Add fields to job.proto
+	// and jobProto without a new version as long as their zero value means "not set" and field numbers are not reused
+	formatProto byte = 2
+
+	// currentFormat is the version new records are written in by GobEncode
+	currentFormat = formatV1
+)
+
+// ErrUnknownJobFormat is returned when decoding a job record written in a format this version doesn't know,
+// usually by a newer version of chronomq
+var ErrUnknownJobFormat = errors.New("Unknown job record format")
+
+// jobRecordV1 is the persisted form of a job in format version 1. Times are in unix nanos, 0 means not set.
+// Keep it in sync with jobProto
+type jobRecordV1 struct {
+	ID        string
+	Body      []byte
+	TriggerAt int64
+	Pri       int32
+	TTR       time.Duration
+	Attempts  int32
+	DeadAt    int64
+	Cron      string
+	Timezone  string
+	Until     int64
+	ExpireAt  int64
+	Tags      []string
+	Headers   map[string]string
+}
+
+// newJobRecord returns the persisted form of a job
+func newJobRecord(j *Job) jobRecordV1 {
+	r := jobRecordV1{
+		ID:        j.id,
+		Body:      j.body,
+		TriggerAt: j.triggerAt.UnixNano(),
+		Pri:       j.pri,
+		TTR:       j.ttr,
+		Attempts:  j.attempts,
+		DeadAt:    unixNano(j.deadAt),
+		ExpireAt:  unixNano(j.expireAt),
+		Tags:      j.tags,
+		Headers:   j.headers,
+	}
+	if j.schedule != nil {
+		r.Cron = j.schedule.Spec()
+		r.Timezone = j.schedule.Timezone()
+		r.Until = unixNano(j.schedule.Until())
+	}
+	return r
+}
+
+// restore sets j to the job of the record
+func (r jobRecordV1) restore(j *Job) error {
+	*j = Job{
+		id:        r.ID,
+		body:      r.Body,
+		triggerAt: time.Unix(0, r.TriggerAt),
+		pri:       r.Pri,
+		ttr:       r.TTR,
+		attempts:  r.Attempts,
+		deadAt:    fromUnixNano(r.DeadAt),
+		expireAt:  fromUnixNano(r.ExpireAt),
+		tags:      r.Tags,
+		headers:   r.Headers,
+	}
+	if r.Cron == "" {
+		return nil
+	}
+	var err error
+	j.schedule, err = NewSchedule(r.Cron, r.Timezone, fromUnixNano(r.Until))
+	return err
+}
+
+// jobProto mirrors jobRecordV1 with the protobuf field numbers of the message Job in job.proto
+type jobProto struct {
+	ID        string            `protobuf:"bytes,1,opt,name=id,proto3"`
+	Body      []byte            `protobuf:"bytes,2,opt,name=body,proto3"`
+	TriggerAt int64             `protobuf:"varint,3,opt,name=trigger_at,json=triggerAt,proto3"`
+	Pri       int32             `protobuf:"varint,4,opt,name=pri,proto3"`
+	TTR       time.Duration     `protobuf:"varint,5,opt,name=ttr,proto3"`
+	Attempts  int32             `protobuf:"varint,6,opt,name=attempts,proto3"`
+	DeadAt    int64             `protobuf:"varint,7,opt,name=dead_at,json=deadAt,proto3"`
+	Cron      string            `protobuf:"bytes,8,opt,name=cron,proto3"`
+	Timezone  string            `protobuf:"bytes,9,opt,name=timezone,proto3"`
+	Until     int64             `protobuf:"varint,10,opt,name=until,proto3"`
+	ExpireAt  int64             `protobuf:"varint,11,opt,name=expire_at,json=expireAt,proto3"`
+	Tags      []string          `protobuf:"bytes,12,rep,name=tags,proto3"`
+	Headers   map[string]string `protobuf:"bytes,13,rep,name=headers,proto3" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (r *jobProto) Reset()         { *r = jobProto{} }
+func (r *jobProto) String() string { return proto.CompactTextString(r) }
+func (*jobProto) ProtoMessage()    {}
+
+// encodeJob writes a job in the current format
+func encodeJob(j *Job) ([]byte, error) {
+	r := newJobRecord(j)
+	buf := bytes.NewBuffer([]byte{formatMagic, currentFormat})
+	if err := gob.NewEncoder(buf).Encode(&r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeJobProto writes a job in formatProto
+func encodeJobProto(j *Job) ([]byte, error) {
+	r := jobProto(newJobRecord(j))
+	buf := proto.NewBuffer([]byte{formatMagic, formatProto})
+	// Map entries in a stable order so that equal jobs are equal records
+	buf.SetDeterministic(true)
+	if err := buf.Marshal(&r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeJob reads a job written in any known format
+func decodeJob(j *Job, data []byte) error {
+	if len(data) == 0 || data[0] != formatMagic {
+		return decodeLegacy(j, data)
+	}
+	if len(data) < 2 {
+		return io.ErrUnexpectedEOF
+	}
+	switch data[1] {
+	case formatV1:
+		return decodeV1(j, data[2:])
+	case formatProto:
+		return decodeProto(j, data[2:])
+	}
+	return errors.Wrapf(ErrUnknownJobFormat, "Cannot decode job record of format version %d", data[1])
+}
+
+func decodeV1(j *Job, data []byte) error {
+	var r jobRecordV1
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&r); err != nil {
+		return err
+	}
+	return r.restore(j)
+}
+
+func decodeProto(j *Job, data []byte) error {
+	var r jobProto
+	if err := proto.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	return jobRecordV1(r).restore(j)
+}
+
+// unixNano returns t in unix nanos or 0 for the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano returns the time of the given unix nanos or the zero time for 0
+func fromUnixNano(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// decodeLegacy decodes a job written before records had a format header: a sequence of gob values.
+// Fields were appended over time, so records of older versions end early
+func decodeLegacy(j *Job, data []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+
+	// id
+	err := dec.Decode(&j.id)
+	if err != nil {
+		return err
+	}
+	// pri
+	err = dec.Decode(&j.pri)
+	if err != nil {
+		return err
+	}
+	//trigger at
+	var triggerAtUnixNano int64
+	err = dec.Decode(&triggerAtUnixNano)
+	if err != nil {
+		return err
+	}
+	j.triggerAt = time.Unix(0, triggerAtUnixNano)
+	//ttr
+	err = dec.Decode(&j.ttr)
+	if err != nil {
+		return err
+	}
+	//body
+	err = dec.Decode(&j.body)
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	// Jobs encoded before attempts were tracked end here
+	//attempts
+	err = dec.Decode(&j.attempts)
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	//dead at
+	var deadAtUnixNano int64
+	err = dec.Decode(&deadAtUnixNano)
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	if deadAtUnixNano != 0 {
+		j.deadAt = time.Unix(0, deadAtUnixNano)
+	}
+	// Jobs encoded before jobs could recur end here
+	//schedule
+	var spec, timezone string
+	var untilUnixNano int64
+	err = dec.Decode(&spec)
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	err = dec.Decode(&timezone)
+	if err != nil {
+		return err
+	}
+	err = dec.Decode(&untilUnixNano)
+	if err != nil {
+		return err
+	}
+	// Jobs encoded before jobs could expire end here
+	//expire at
+	var expireAtUnixNano int64
+	err = dec.Decode(&expireAtUnixNano)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if expireAtUnixNano != 0 {
+		j.expireAt = time.Unix(0, expireAtUnixNano)
+	}
+	// Jobs encoded before jobs could be tagged end here
+	//tags
+	if err == nil {
+		err = dec.Decode(&j.tags)
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+	// Jobs encoded before jobs had headers end here
+	//headers
+	if err == nil {
+		err = dec.Decode(&j.headers)
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+	if spec == "" {
+		return nil
+	}
+	var until time.Time
+	if untilUnixNano != 0 {
+		until = time.Unix(0, untilUnixNano)
+	}
+	j.schedule, err = NewSchedule(spec, timezone, until)
+	return err
+}
@@ -0,0 +1,152 @@
+package chronomq_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	. "github.com/chronomq/chronomq/pkg/chronomq"
+)
+
+// goldenRecords holds one record of every job format chronomq has written, all of the same job.
+// Formats that predate a field don't carry it
+const goldenRecords = "../../testdata/persist_golden/records"
+
+var _ = Describe("Test job record formats", func() {
+	triggerAt := time.Date(2030, 1, 2, 3, 4, 5, 6, time.UTC)
+	deadAt := time.Date(2030, 1, 3, 0, 0, 0, 0, time.UTC)
+	expireAt := time.Date(2030, 1, 2, 4, 0, 0, 0, time.UTC)
+	until := time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// goldenJob returns the job of the golden records
+	goldenJob := func() *Job {
+		j := NewJob("golden", triggerAt, []byte("golden body"))
+		j.SetOpts(7, time.Second*90)
+		j.SetTags("user-1", "emails")
+		j.SetHeaders(map[string]string{"type": "email"})
+		return j
+	}
+
+	// fields a format has, in the order they were added
+	const (
+		base = iota
+		attempts
+		schedule
+		expiry
+		tags
+		headers
+	)
+
+	expectDecoded := func(j *Job, fields int) {
+		Expect(j.ID()).To(Equal("golden"))
+		Expect(string(j.Body())).To(Equal("golden body"))
+		Expect(j.TriggerAt()).To(BeTemporally("==", triggerAt))
+		Expect(j.Pri()).To(Equal(int32(7)))
+		Expect(j.TTR()).To(Equal(time.Second * 90))
+		if fields >= attempts {
+			Expect(j.Attempts()).To(Equal(int32(2)))
+			Expect(j.DeadAt()).To(BeTemporally("==", deadAt))
+		} else {
+			Expect(j.Attempts()).To(BeZero())
+			Expect(j.DeadAt()).To(BeZero())
+		}
+		if fields >= schedule {
+			Expect(j.Schedule().Spec()).To(Equal("0 9 * * 1-5"))
+			Expect(j.Schedule().Timezone()).To(Equal("Europe/Berlin"))
+			Expect(j.Schedule().Until()).To(BeTemporally("==", until))
+		} else {
+			Expect(j.IsRecurring()).To(BeFalse())
+		}
+		if fields >= expiry {
+			Expect(j.ExpireAt()).To(BeTemporally("==", expireAt))
+		} else {
+			Expect(j.ExpireAt()).To(BeZero())
+		}
+		if fields >= tags {
+			Expect(j.Tags()).To(Equal([]string{"user-1", "emails"}))
+		} else {
+			Expect(j.Tags()).To(BeEmpty())
+		}
+		if fields >= headers {
+			Expect(j.Headers()).To(Equal(map[string]string{"type": "email"}))
+		} else {
+			Expect(j.Headers()).To(BeEmpty())
+		}
+	}
+
+	records := []struct {
+		file   string
+		fields int
+	}{
+		{"legacy-base.job", base},
+		{"legacy-attempts.job", attempts},
+		{"legacy-schedule.job", schedule},
+		{"legacy-expiry.job", expiry},
+		{"legacy-tags.job", tags},
+		{"legacy-headers.job", headers},
+		{"v1.job", headers},
+		{"proto.job", headers},
+	}
+	for _, r := range records {
+		r := r
+		It("decodes the golden record "+r.file, func() {
+			data, err := ioutil.ReadFile(filepath.Join(goldenRecords, r.file))
+			Expect(err).NotTo(HaveOccurred())
+			j := &Job{}
+			Expect(j.GobDecode(data)).To(Succeed())
+			expectDecoded(j, r.fields)
+		})
+	}
+
+	It("writes records in the newest golden format", func() {
+		data, err := ioutil.ReadFile(filepath.Join(goldenRecords, "v1.job"))
+		Expect(err).NotTo(HaveOccurred())
+		golden := &Job{}
+		Expect(golden.GobDecode(data)).To(Succeed())
+
+		encoded, err := golden.GobEncode()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(encoded).To(Equal(data), "The job record format changed. Add a new format version and golden record")
+
+		decoded := &Job{}
+		Expect(decoded.GobDecode(encoded)).To(Succeed())
+		expectDecoded(decoded, headers)
+	})
+
+	It("writes protobuf records in the golden format", func() {
+		data, err := ioutil.ReadFile(filepath.Join(goldenRecords, "proto.job"))
+		Expect(err).NotTo(HaveOccurred())
+		golden := &Job{}
+		Expect(golden.Unmarshal(data)).To(Succeed())
+
+		encoded, err := golden.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(encoded).To(Equal(data), "The protobuf job record changed. Keep job.proto compatible")
+	})
+
+	It("round trips jobs without optional fields", func() {
+		j := NewJob("plain", triggerAt, nil)
+		encoded, err := j.GobEncode()
+		Expect(err).NotTo(HaveOccurred())
+		decoded := &Job{}
+		Expect(decoded.GobDecode(encoded)).To(Succeed())
+		Expect(decoded.ID()).To(Equal("plain"))
+		Expect(decoded.TriggerAt()).To(BeTemporally("==", triggerAt))
+		Expect(decoded.Body()).To(BeEmpty())
+		Expect(decoded.IsRecurring()).To(BeFalse())
+		Expect(decoded.DeadAt()).To(BeZero())
+		Expect(decoded.ExpireAt()).To(BeZero())
+	})
+
+	It("rejects records of unknown format versions", func() {
+		encoded, err := goldenJob().GobEncode()
+		Expect(err).NotTo(HaveOccurred())
+		encoded[1] = 99
+		err = (&Job{}).GobDecode(encoded)
+		Expect(errors.Cause(err)).To(Equal(ErrUnknownJobFormat))
+	})
+})
@@ -0,0 +1,55 @@
+package chronomq
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronomq/chronomq/pkg/metrics"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+// ErrInvalidExpiry is returned when a job would expire before it triggers
+var ErrInvalidExpiry = errors.New("Expiry must be after the trigger time")
+
+// SetExpiry makes the job expire at the given time if it hasn't been consumed by then. Expired jobs are
+// never handed out. Recurring jobs stop recurring at their expiry. The zero time removes the expiry
+func (j *Job) SetExpiry(expireAt time.Time) error {
+	if !expireAt.IsZero() && !expireAt.After(j.triggerAt) {
+		return ErrInvalidExpiry
+	}
+	j.expireAt = expireAt
+	return nil
+}
+
+// IsExpired returns true if the job has an expiry that has passed
+func (j *Job) IsExpired() bool {
+	return j.isExpiredAt(time.Now())
+}
+
+func (j *Job) isExpiredAt(t time.Time) bool {
+	return !j.expireAt.IsZero() && !t.Before(j.expireAt)
+}
+
+// expire drops a dequeued job that expired before it was consumed or moves it to the dead-letter store.
+// Lock the hub before calling this
+func (h *Hub) expire(j *Job) {
+	h.stats.IncrExpired()
+	go metrics.Incr("hub.job.expired")
+
+	if h.deadExpired {
+		j.deadAt = time.Now()
+		h.dead.add(j)
+		h.stats.IncrDead()
+		h.journal(persistence.OpPut, j)
+		log.Info().Str("queue", h.queue).Str("jobID", j.ID()).Time("expireAt", j.expireAt).Msg("Hub: Moved expired job to the dead-letter store")
+		return
+	}
+	h.forget(j)
+	h.journal(persistence.OpConsume, j)
+	log.Debug().Str("queue", h.queue).Str("jobID", j.ID()).Time("expireAt", j.expireAt).Msg("Hub: Dropped expired job")
+	if h.onExpired != nil {
+		h.onExpired(j)
+	}
+}
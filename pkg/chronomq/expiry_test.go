@@ -0,0 +1,123 @@
+package chronomq_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+var _ = Describe("Test expiring jobs", func() {
+	var p persistence.Persister
+
+	BeforeEach(func() {
+		store, err := persistence.InMemStorage()
+		Expect(err).NotTo(HaveOccurred())
+		p = persistence.NewJournalPersister(store)
+	})
+
+	It("rejects expiries before the trigger time", func() {
+		at := time.Now().Add(time.Hour)
+		j := NewJob("late", at, nil)
+		Expect(j.SetExpiry(at)).To(Equal(ErrInvalidExpiry))
+		Expect(j.SetExpiry(at.Add(time.Second))).To(Succeed())
+		Expect(j.ExpireAt()).To(BeTemporally("==", at.Add(time.Second)))
+		Expect(j.IsExpired()).To(BeFalse())
+		Expect(j.SetExpiry(time.Time{})).To(Succeed())
+		Expect(j.ExpireAt()).To(BeZero())
+	})
+
+	It("drops jobs that expire before they are taken", func(done Done) {
+		defer close(done)
+		var dropped []*Job
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p, OnExpired: func(j *Job) {
+			dropped = append(dropped, j)
+		}})
+		defer h.Stop(false)
+
+		stale := NewJob("stale", time.Now(), nil)
+		Expect(stale.SetExpiry(time.Now().Add(time.Millisecond * 100))).To(Succeed())
+		Expect(h.AddJobLocked(stale)).To(Succeed())
+		fresh := NewJob("fresh", time.Now().Add(time.Millisecond*200), nil)
+		Expect(fresh.SetExpiry(time.Now().Add(time.Hour))).To(Succeed())
+		Expect(h.AddJobLocked(fresh)).To(Succeed())
+
+		time.Sleep(time.Millisecond * 150)
+		var j *Job
+		Eventually(func() *Job { j = h.NextLocked(); return j }, 2).ShouldNot(BeNil())
+		Expect(j.ID()).To(Equal("fresh"))
+		Expect(dropped).To(HaveLen(1))
+		Expect(dropped[0].ID()).To(Equal("stale"))
+		Expect(h.Stats().ExpiredJobs).To(Equal(int64(1)))
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(0)))
+		// The id of a dropped job can be used again
+		Expect(h.AddJobLocked(NewJob("stale", time.Now(), nil))).To(Succeed())
+	}, 5)
+
+	It("dead-letters expired jobs if configured", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p, DeadLetterExpired: true})
+		defer h.Stop(false)
+
+		j := NewJob("stale", time.Now(), []byte("stale"))
+		Expect(j.SetExpiry(time.Now().Add(time.Millisecond * 50))).To(Succeed())
+		Expect(h.AddJobLocked(j)).To(Succeed())
+		time.Sleep(time.Millisecond * 100)
+		Consistently(h.NextLocked, 0.2).Should(BeNil())
+		Expect(h.Stats().ExpiredJobs).To(Equal(int64(1)))
+		Expect(h.Stats().DeadJobs).To(Equal(int64(1)))
+		dead, err := h.DeadLetterLocked("stale")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(dead.Body())).To(Equal("stale"))
+
+		// Requeued jobs don't expire again
+		Expect(h.RequeueDeadLocked("stale", 0)).To(Succeed())
+		Eventually(h.NextLocked, 2).ShouldNot(BeNil())
+	}, 5)
+
+	It("stops recurring jobs at their expiry", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+		defer h.Stop(false)
+
+		s, err := NewSchedule("@every 1s", "", time.Time{})
+		Expect(err).NotTo(HaveOccurred())
+		j := NewJob("tick", time.Now(), nil)
+		Expect(j.SetSchedule(s)).To(Succeed())
+		Expect(j.SetExpiry(j.TriggerAt().Add(time.Millisecond * 500))).To(Succeed())
+		Expect(j.Occurrences(5)).To(HaveLen(1))
+		Expect(h.AddJobLocked(j)).To(Succeed())
+
+		var occurrence *Job
+		Eventually(func() *Job { occurrence = h.NextLocked(); return occurrence }, 2).ShouldNot(BeNil())
+		Expect(occurrence.IsRecurring()).To(BeFalse())
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(0)))
+	}, 5)
+
+	It("skips expired jobs on restore", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+
+		stale := NewJob("stale", time.Now().Add(time.Millisecond*100), nil)
+		Expect(stale.SetExpiry(time.Now().Add(time.Millisecond * 200))).To(Succeed())
+		Expect(h.AddJobLocked(stale)).To(Succeed())
+		expireAt := time.Now().Add(time.Hour * 2)
+		later := NewJob("later", time.Now().Add(time.Hour), nil)
+		Expect(later.SetExpiry(expireAt)).To(Succeed())
+		Expect(h.AddJobLocked(later)).To(Succeed())
+		h.Stop(true)
+
+		time.Sleep(time.Millisecond * 250)
+		restored := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+		defer restored.Stop(false)
+		Expect(restored.Restore()).To(Succeed())
+		Expect(restored.Stats().CurrentJobs).To(Equal(int64(1)))
+		Expect(restored.Stats().ExpiredJobs).To(Equal(int64(1)))
+		j, _, err := restored.GetJobLocked("later")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.ExpireAt()).To(BeTemporally("==", expireAt))
+	}, 5)
+})
@@ -4,6 +4,7 @@ import (
 	"container/heap"
 	"fmt"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -31,16 +32,66 @@ const (
 	TestMaxCFSize uint = 10000
 )
 
+// ErrJobExists is returned when adding a job with the id of a job that is pending, reserved or dead-lettered,
+// or of a job consumed within the hub's dedup window
+var ErrJobExists = errors.New("Job already exists")
+
+// ErrJobNotReserved is returned when acknowledging, releasing or touching a job that is not reserved.
+// The job's reservation may have expired and the job may have been handed out again
+var ErrJobNotReserved = errors.New("Job is not reserved")
+
+// ErrJobNotFound is returned for jobs the hub doesn't hold - they may have been consumed or canceled already -
+// and when updating a job that is reserved or dead-lettered instead of pending
+var ErrJobNotFound = errors.New("Job not found")
+
+// JobState tells where in its lifecycle a job held by the hub is
+type JobState string
+
+const (
+	// JobPending jobs wait for their trigger time or to be taken by a consumer
+	JobPending JobState = "pending"
+	// JobReserved jobs were taken by a consumer that hasn't acknowledged them yet
+	JobReserved JobState = "reserved"
+	// JobDead jobs are in the dead-letter store
+	JobDead JobState = "dead"
+)
+
 // HubOpts define customizations for Hub initialization
 type HubOpts struct {
 	Persister      persistence.Persister // persister to store/restore from disk
+	WAL            persistence.WAL       // optional write-ahead log every mutation is appended to. Requires Persister to be truncated
+	Codec          persistence.Codec     // Decodes restored jobs. persistence.GobCodec if not set
 	AttemptRestore bool                  // If true, hub will try to restore from disk on start
 	SpokeSpan      time.Duration         // How wide should the spokes be
 	MaxCFSize      uint                  // Max size of the Cuckoo Filter
+	Queue          string                // Name of the queue served by the hub, used for logging
+	Backoff        BackoffPolicy         // When to retry failed jobs. DefaultBackoffPolicy if not set
+	// Move jobs that expire before they are consumed to the dead-letter store instead of dropping them
+	DeadLetterExpired bool
+	// Called with every dropped expired job, e.g. to release its memory. The hub is locked while it runs
+	OnExpired func(j *Job)
+	// How long ids of consumed jobs are remembered so that putting them again is treated as a duplicate. Not at all if 0
+	DedupWindow time.Duration
+	// How often to take a snapshot in the background. Snapshots are only taken on Stop if not set
+	SnapshotInterval time.Duration
+	// Offloads the jobs of spokes starting later than SpillHorizon from now to this store and pages them back in
+	// as they come within the horizon. Only the ids of spilled jobs stay in memory. Disabled if not set
+	Spill        persistence.SpillStore
+	SpillHorizon time.Duration
+	// How often spokes are spilled and paged back in. DefaultSpillInterval or half the horizon if that is shorter
+	SpillInterval time.Duration
+	// Called with every spilled and every paged in job, e.g. to account for their memory. The hub is locked while they run
+	OnSpilled func(j *Job)
+	OnPagedIn func(j *Job)
+	// Keeps pending jobs in this store instead of in memory, only their ids stay in memory. The store is the hub's
+	// write-ahead log unless WAL is set, which then has to append to the store, e.g. a replication feed wrapping it.
+	// Hubs with a store recover their jobs from it when they are created, take no snapshots and don't spill
+	Store persistence.JobStore
 }
 
 // Hub is a time ordered collection of spokes
 type Hub struct {
+	queue     string
 	jobFilter *cuckoo.Filter
 	spokeSpan time.Duration             // How much time does a spoke span
 	spokeMap  map[temporal.Bound]*Spoke // Quick lookup map
@@ -49,39 +100,142 @@ type Hub struct {
 	pastSpoke    *Spoke // Permanently pinned to the past
 	currentSpoke *Spoke // The current spoke - started in the past or now, ends in the future or now
 
+	reserved *reservations // Jobs handed out to consumers that are waiting to be acknowledged
+	dead     *deadLetters  // Jobs that failed too often to be retried
+	backoff  BackoffPolicy
+	consumed *consumedIDs // Recently consumed job ids, see HubOpts.DedupWindow
+	tags     tagIndex     // Ids of the jobs with each tag
+
+	deadExpired bool // Dead-letter expired jobs instead of dropping them, see HubOpts.DeadLetterExpired
+	onExpired   func(j *Job)
+
 	stats *stats.Counters
 	lock  *sync.Mutex
 
-	persister persistence.Persister
+	persister    persistence.Persister
+	wal          persistence.WAL
+	codec        persistence.Codec
+	snapshotLock *sync.Mutex // Only one snapshot, restore or spill pass runs at a time
+	stop         chan struct{}
+
+	spill        persistence.SpillStore
+	spillHorizon time.Duration
+	spilled      map[temporal.Bound]*spilledSpoke // Spokes beyond the spill horizon. Not part of spokeMap
+	spillGarbage []string                         // Segments of spokes paged back in, deleted by the next spill pass
+	spillSeq     uint64
+	onSpilled    func(j *Job)
+	onPagedIn    func(j *Job)
+
+	store persistence.JobStore // Holds the pending jobs instead of the spokes if set
+
+	ready     chan struct{} // Closed and replaced whenever jobs may have become ready. See Ready
+	readyLock *sync.Mutex
+	wakeup    *time.Timer // Fires at wakeupAt to close ready when the earliest pending job triggers
+	wakeupAt  time.Time   // Zero when the wakeup timer is not set
 }
 
 // NewHub creates a new hub where adjacent spokes lie at the given
-// spokeSpan duration boundary.
+// spokeSpan duration boundary. Hubs with a write-ahead log but without a persister
+// can't take snapshots, so they replay the whole log on restore and never truncate it.
 func NewHub(opts *HubOpts) *Hub {
 	maxCFSize := TestMaxCFSize // keep test mem requirements low by default
 	if opts.MaxCFSize != 0 {
 		maxCFSize = opts.MaxCFSize
 	}
+	backoff := opts.Backoff
+	if backoff == (BackoffPolicy{}) {
+		backoff = DefaultBackoffPolicy
+	}
+	codec := opts.Codec
+	if codec == nil {
+		codec = persistence.GobCodec
+	}
 	h := &Hub{
+		queue:        queueName(opts.Queue),
 		jobFilter:    cuckoo.NewFilter(maxCFSize),
 		spokeSpan:    opts.SpokeSpan,
 		spokeMap:     make(map[temporal.Bound]*Spoke),
 		spokes:       &queue.PriorityQueue{},
-		pastSpoke:    NewSpoke(time.Now().Add(-1*hundredYears), time.Now().Add(hundredYears)),
+		pastSpoke:    newPastSpoke(time.Now().Add(-1*hundredYears), time.Now().Add(hundredYears)),
 		currentSpoke: nil,
+		reserved:     newReservations(),
+		dead:         newDeadLetters(),
+		backoff:      backoff,
+		consumed:     newConsumedIDs(opts.DedupWindow),
+		tags:         make(tagIndex),
+		deadExpired:  opts.DeadLetterExpired,
+		onExpired:    opts.OnExpired,
 		stats:        &stats.Counters{},
 		lock:         &sync.Mutex{},
 		persister:    opts.Persister,
+		wal:          opts.WAL,
+		codec:        codec,
+		snapshotLock: &sync.Mutex{},
+		stop:         make(chan struct{}),
+		ready:        make(chan struct{}),
+		readyLock:    &sync.Mutex{},
+		spilled:      make(map[temporal.Bound]*spilledSpoke),
+		onSpilled:    opts.OnSpilled,
+		onPagedIn:    opts.OnPagedIn,
+		store:        opts.Store,
+	}
+	if h.store != nil && h.wal == nil {
+		h.wal = h.store
 	}
 	heap.Init(h.spokes)
+	h.wakeup = time.AfterFunc(hundredYears, h.wake)
+	h.wakeup.Stop()
+
+	if h.wal != nil && h.store == nil && h.persister == nil {
+		log.Error().Msg("Hub: Write-ahead log without a persister. Snapshots are disabled and the log is never truncated")
+	} else if h.wal != nil && h.store == nil {
+		// New writes must not go to segments older than the latest snapshot - those are not replayed
+		version, err := h.persister.Version()
+		if err == nil {
+			_, err = h.wal.Rotate(version)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Hub: Cannot align write-ahead log with the latest snapshot")
+		}
+	}
 
-	log.Info().Dur("spokeSpan", opts.SpokeSpan).
+	spillInterval := opts.SpillInterval
+	if opts.Spill != nil && opts.SpillHorizon > 0 && h.store == nil {
+		// Segments left behind by a previous hub are stale, their jobs are restored from snapshots and the log
+		if err := opts.Spill.Reset(); err != nil {
+			log.Error().Err(err).Msg("Hub: Cannot reset spill store. Spilling is disabled")
+		} else {
+			h.spill = opts.Spill
+			h.spillHorizon = opts.SpillHorizon
+		}
+		if spillInterval == 0 {
+			spillInterval = DefaultSpillInterval
+			if opts.SpillHorizon < 2*spillInterval {
+				spillInterval = opts.SpillHorizon / 2
+			}
+		}
+	}
+
+	log.Info().Str("queue", h.queue).
+		Dur("spokeSpan", opts.SpokeSpan).
 		Bool("attemptRestore", opts.AttemptRestore).
 		Uint("maxCFSize", maxCFSize).
+		Dur("snapshotInterval", opts.SnapshotInterval).
+		Int32("maxAttempts", backoff.MaxAttempts).
+		Dur("dedupWindow", opts.DedupWindow).
+		Bool("deadLetterExpired", opts.DeadLetterExpired).
+		Dur("spillHorizon", h.spillHorizon).
+		Bool("jobStore", h.store != nil).
 		Msg("Created hub")
 
+	if h.store != nil {
+		// Jobs must be indexed again before the hub serves anything
+		if err := h.Restore(); err != nil {
+			log.Error().Err(err).Msg("Hub: Restore error")
+		}
+	}
 	go func() {
-		if opts.AttemptRestore {
+		if opts.AttemptRestore && h.store == nil {
 			log.Info().Msg("Hub: Entering restore mode")
 			err := h.Restore()
 			if err != nil {
@@ -92,12 +246,20 @@ func NewHub(opts *HubOpts) *Hub {
 		}
 	}()
 	go h.StatusPrinter()
+	if opts.SnapshotInterval > 0 && h.store == nil {
+		go h.snapshotter(opts.SnapshotInterval)
+	}
+	if h.spill != nil {
+		go h.spiller(spillInterval)
+	}
 
 	return h
 }
 
 // Stop the hub gracefully and if persist is true, then persist all jobs to disk for later recovery
 func (h *Hub) Stop(persist bool) {
+	close(h.stop)
+	h.wakeup.Stop()
 	if persist {
 		log.Info().Int("PID", os.Getpid()).Msg("Hub:Stop Starting persistence")
 		errC := h.PersistLocked()
@@ -107,9 +269,29 @@ func (h *Hub) Stop(persist bool) {
 		}
 		log.Info().Int("errorCount", errCount).Msg("Hub:Stop Finished persistence with errors")
 	}
+	if h.wal != nil {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		if err := h.wal.Close(); err != nil {
+			log.Error().Err(err).Msg("Hub:Stop failed to close write-ahead log")
+		}
+	}
+	if h.spill != nil {
+		// Spilled jobs are in the snapshot taken above or in the write-ahead log
+		h.snapshotLock.Lock()
+		defer h.snapshotLock.Unlock()
+		if err := h.spill.Reset(); err != nil {
+			log.Error().Err(err).Msg("Hub:Stop failed to delete spilled jobs")
+		}
+	}
 	log.Info().Msg("Hub:Stop stopped")
 }
 
+// Queue returns the name of the queue served by the hub
+func (h *Hub) Queue() string {
+	return h.queue
+}
+
 // Stats returns a snapshot of the current hubs stats
 func (h *Hub) Stats() stats.Snapshot {
 	return h.stats.Read()
@@ -118,25 +300,75 @@ func (h *Hub) Stats() stats.Snapshot {
 // CancelJobLocked cancels a job if found. Calls are noop for unknown jobs
 func (h *Hub) CancelJobLocked(jobID string) (*Job, error) {
 	go metrics.Incr("hub.cancel.req")
-	id := []byte(jobID)
 
 	h.lock.Lock()
 	defer h.lock.Unlock()
+	return h.cancel(jobID)
+}
+
+// CancelJobsLocked cancels a batch of jobs taking the hub lock only once. The returned slice holds the
+// canceled job for every id or nil if the job was not found
+func (h *Hub) CancelJobsLocked(jobIDs []string) []*Job {
+	go metrics.Incr("hub.cancel.batch.req")
+	canceled := make([]*Job, len(jobIDs))
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i, jobID := range jobIDs {
+		j, err := h.cancel(jobID)
+		if err != nil {
+			log.Error().Err(err).Str("jobID", jobID).Msg("Failed to cancel job of batch")
+			continue
+		}
+		canceled[i] = j
+	}
+	return canceled
+}
+
+// cancel cancels a pending or reserved job. Lock the hub before calling this
+func (h *Hub) cancel(jobID string) (*Job, error) {
+	id := []byte(jobID)
 	if !h.jobFilter.Lookup(id) {
 		// no such job
 		go metrics.Incr("hub.cancel.ok")
 		return nil, nil
 	}
+	if j := h.reserved.remove(jobID); j != nil {
+		h.forget(j)
+		h.stats.DecrReserved()
+		h.journal(persistence.OpCancel, j)
+		go metrics.Incr("hub.cancel.ok")
+		return j, nil
+	}
+	if j := h.dead.remove(jobID); j != nil {
+		h.forget(j)
+		h.stats.DecrDead()
+		h.journal(persistence.OpCancel, j)
+		go metrics.Incr("hub.cancel.ok")
+		return j, nil
+	}
 	j, err := h.cancelJob(jobID)
 	if err == nil {
 		if !h.jobFilter.Delete(id) {
 		}
+		if j != nil {
+			h.tags.remove(j)
+			h.journal(persistence.OpCancel, j)
+		}
 	}
 	return j, err
 }
 
 func (h *Hub) cancelJob(jobID string) (*Job, error) {
 	log.Debug().Str("jobID", jobID).Msg("canceling job")
+	if h.store != nil {
+		j, err := h.unscheduleStored(jobID)
+		if j != nil {
+			h.stats.DecrJob()
+			go metrics.Incr("hub.cancel.ok")
+		}
+		return j, err
+	}
 
 	s, err := h.findOwnerSpoke(jobID)
 	if err != nil {
@@ -153,24 +385,38 @@ func (h *Hub) cancelJob(jobID string) (*Job, error) {
 	return j, err
 }
 
-// findOwnerSpoke returns the spoke that owns this  Lock the hub before calling this
+// findOwnerSpoke returns the spoke that owns this job. Spilled spokes that may own the job are paged back in.
+// Lock the hub before calling this
 func (h *Hub) findOwnerSpoke(jobID string) (*Spoke, error) {
+	if s := h.ownerSpoke(jobID); s != nil {
+		return s, nil
+	}
+	if h.pageInJob(jobID) {
+		if s := h.ownerSpoke(jobID); s != nil {
+			return s, nil
+		}
+	}
+	return nil, errors.New("Cannot find job owner spoke")
+}
+
+// ownerSpoke returns the spoke in memory that owns this job or nil. Lock the hub before calling this
+func (h *Hub) ownerSpoke(jobID string) *Spoke {
 	if h.pastSpoke.OwnsJobLocked(jobID) {
-		return h.pastSpoke, nil
+		return h.pastSpoke
 	}
 
 	// Checking the current spoke
 	if h.currentSpoke != nil && h.currentSpoke.OwnsJobLocked(jobID) {
-		return h.currentSpoke, nil
+		return h.currentSpoke
 	}
 
 	// Find the owner in the spoke map
 	for _, s := range h.spokeMap {
 		if s.OwnsJobLocked(jobID) {
-			return s, nil
+			return s
 		}
 	}
-	return nil, errors.New("Cannot find job owner spoke")
+	return nil
 }
 
 // addSpoke adds spoke s to this hub
@@ -187,24 +433,82 @@ func (h *Hub) deleteSpokeFromMap(s *Spoke) {
 }
 
 // NextLocked returns the next job that is ready now or returns nil.
+// Jobs with a time-to-run are reserved instead of being removed and have to be acknowledged
+// with AckLocked before their TTR runs out, otherwise they are put back into the hub
 func (h *Hub) NextLocked() *Job {
 	defer metrics.Time("hub.next.search.duration", time.Now())
 
 	h.lock.Lock()
 	defer h.lock.Unlock()
+	return h.take()
+}
+
+// NextNLocked returns up to n jobs that are ready now taking the hub lock only once. See NextLocked
+func (h *Hub) NextNLocked(n int) []*Job {
+	defer metrics.Time("hub.next.batch.search.duration", time.Now())
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var jobs []*Job
+	for len(jobs) < n {
+		j := h.take()
+		if j == nil {
+			break
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
+
+// take dequeues the next ready job and reserves it if it has a time-to-run.
+// Recurring jobs without a time-to-run are scheduled again right away. Lock the hub before calling this
+func (h *Hub) take() *Job {
 	j := h.next()
-	if j != nil {
-		h.jobFilter.Delete([]byte(j.ID()))
+	if j == nil {
+		return nil
+	}
+
+	if j.ttr > 0 {
+		// Reserved jobs keep their id in the filter so that they can't be duplicated
+		h.reserved.add(j)
+		h.wakeAt(time.Now().Add(j.ttr))
+		h.stats.IncrReserved()
+		go metrics.Incr("hub.job.reserved")
+	} else if occurrence := h.recur(j); occurrence != nil {
+		return occurrence
+	} else {
+		h.forget(j)
+		h.consumed.add(j.ID())
+		h.journal(persistence.OpConsume, j)
 	}
 
 	return j
 }
+
+// next dequeues the next ready job. Jobs that expired while waiting to be consumed are dropped or
+// dead-lettered on the way. Lock the hub before calling this
 func (h *Hub) next() *Job {
+	for {
+		j := h.nextReady()
+		if j == nil || !j.IsExpired() {
+			return j
+		}
+		h.expire(j)
+	}
+}
+
+func (h *Hub) nextReady() *Job {
+	// Jobs whose reservation expired are ready again
+	h.requeueExpired()
 
 	// since we have the lock, send some metrics
 	go metrics.GaugeInt("hub.job.count", int(h.stats.Read().CurrentJobs))
 	go metrics.GaugeInt("hub.spoke.count", h.spokes.Len())
 
+	if h.store != nil {
+		return h.nextStored()
+	}
+
 	// Lock Past spoke lock in func scope
 	if j := func() *Job {
 		go metrics.GaugeInt("hub.job.past.count", h.pastSpoke.PendingJobsLen())
@@ -282,6 +586,231 @@ func (h *Hub) next() *Job {
 	return j
 }
 
+// requeueExpired puts jobs whose reservation has expired back into the hub at their original
+// trigger time so that they are handed out again ahead of jobs that triggered later.
+// Lock the hub before calling this
+func (h *Hub) requeueExpired() {
+	for _, j := range h.reserved.expired() {
+		h.stats.DecrReserved()
+		log.Debug().Str("jobID", j.ID()).Msg("Reservation expired. Requeueing job")
+		if err := h.addJob(j); err != nil {
+			log.Error().Err(err).Str("jobID", j.ID()).Msg("Failed to requeue job with expired reservation")
+			h.forget(j)
+			continue
+		}
+		h.stats.IncrJob()
+		go metrics.Incr("hub.job.reservation.expired")
+	}
+}
+
+// AckLocked deletes a reserved job once its consumer has finished working on it.
+// Recurring jobs are scheduled again at their next occurrence instead and a copy of the acknowledged occurrence is returned
+func (h *Hub) AckLocked(jobID string) (*Job, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	j := h.reserved.remove(jobID)
+	if j == nil {
+		return nil, ErrJobNotReserved
+	}
+	h.stats.DecrReserved()
+	go metrics.Incr("hub.ack")
+	if occurrence := h.recur(j); occurrence != nil {
+		return occurrence, nil
+	}
+	h.forget(j)
+	h.consumed.add(jobID)
+	h.journal(persistence.OpConsume, j)
+	return j, nil
+}
+
+// ReleaseLocked puts a reserved job back into the hub. The job is ready again after the given delay
+// or right away at its original trigger time if the delay is 0
+func (h *Hub) ReleaseLocked(jobID string, delay time.Duration) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.release(jobID, delay)
+}
+
+// release puts a reserved job back into the hub. Lock the hub before calling this
+func (h *Hub) release(jobID string, delay time.Duration) error {
+	j := h.reserved.remove(jobID)
+	if j == nil {
+		return ErrJobNotReserved
+	}
+	h.stats.DecrReserved()
+
+	if delay > 0 {
+		j.triggerAt = time.Now().Add(delay)
+		h.journal(persistence.OpPut, j)
+	}
+	if err := h.addJob(j); err != nil {
+		h.forget(j)
+		return err
+	}
+	h.stats.IncrJob()
+	go metrics.Incr("hub.release")
+	return nil
+}
+
+// ReturnLocked puts back a job taken with NextLocked or NextNLocked that never reached its consumer, e.g. because
+// the consumer went away before the job was sent. The job is ready again at its original trigger time with its
+// attempts, schedule, expiry, tags and headers intact: reserved jobs are released, the next occurrence of recurring
+// jobs is moved back to the returned one and consumed jobs are added again regardless of the dedup window
+func (h *Hub) ReturnLocked(j *Job) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if j.ttr > 0 {
+		return h.release(j.ID(), 0)
+	}
+	if j.schedule != nil {
+		// The next occurrence was scheduled when the job was taken
+		next, err := h.removePending(j.ID())
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			return ErrJobNotFound
+		}
+		if err := h.addJob(j); err != nil {
+			if err := h.addJob(next); err != nil {
+				log.Error().Err(err).Str("jobID", j.ID()).Msg("Failed to restore next occurrence of recurring job")
+			}
+			return err
+		}
+		h.journal(persistence.OpPut, j)
+		go metrics.Incr("hub.return")
+		return nil
+	}
+
+	if h.exists(j.ID()) {
+		return errors.Wrapf(ErrJobExists, "Cannot return job. Job with ID: %s was put again", j.ID())
+	}
+	h.consumed.remove(j.ID())
+	if err := h.add(j); err != nil {
+		return err
+	}
+	go metrics.Incr("hub.return")
+	return nil
+}
+
+// TouchLocked restarts the time-to-run of a reserved job so that its consumer gets more time to work on it
+func (h *Hub) TouchLocked(jobID string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if !h.reserved.touch(jobID) {
+		return ErrJobNotReserved
+	}
+	go metrics.Incr("hub.touch")
+	return nil
+}
+
+// GetJobLocked returns a copy of the job with the given id and its state or ErrJobNotFound
+func (h *Hub) GetJobLocked(jobID string) (*Job, JobState, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	j, state := h.get(jobID)
+	if j == nil {
+		return nil, "", ErrJobNotFound
+	}
+	jc := *j
+	return &jc, state, nil
+}
+
+// get returns the job with the given id and its state or nil if the hub doesn't hold the job.
+// Lock the hub before calling this
+func (h *Hub) get(jobID string) (*Job, JobState) {
+	// The filter rules out most unknown ids without searching the spokes
+	if !h.jobFilter.Lookup([]byte(jobID)) {
+		return nil, ""
+	}
+	if h.store != nil {
+		if j := h.storedPendingJob(jobID); j != nil {
+			return j, JobPending
+		}
+	} else if s, err := h.findOwnerSpoke(jobID); err == nil {
+		return s.GetJobLocked(jobID), JobPending
+	}
+	if j := h.reserved.get(jobID); j != nil {
+		return j, JobReserved
+	}
+	if j := h.dead.get(jobID); j != nil {
+		return j, JobDead
+	}
+	return nil, ""
+}
+
+// RescheduleLocked moves a pending job to a new trigger time. The job keeps its id, priority and time-to-run
+func (h *Hub) RescheduleLocked(jobID string, triggerAt time.Time) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	_, err := h.update(jobID, func(j *Job) {
+		j.triggerAt = triggerAt
+	})
+	if err == nil {
+		go metrics.Incr("hub.reschedule")
+	}
+	return err
+}
+
+// UpdateBodyLocked replaces the body of a pending job. Returns the job as it was before the update
+func (h *Hub) UpdateBodyLocked(jobID string, body []byte) (*Job, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	prev, err := h.update(jobID, func(j *Job) {
+		j.body = body
+	})
+	if err == nil {
+		go metrics.Incr("hub.update.body")
+	}
+	return prev, err
+}
+
+// update replaces a pending job with a changed copy, moving it to the spoke owning its trigger time.
+// The job is changed on a copy so that readers of the old job, like inspections, never see a partial update.
+// Returns the job as it was before the update. Lock the hub before calling this
+func (h *Hub) update(jobID string, change func(*Job)) (*Job, error) {
+	if !h.jobFilter.Lookup([]byte(jobID)) {
+		return nil, ErrJobNotFound
+	}
+	prev, err := h.removePending(jobID)
+	if err != nil || prev == nil {
+		return nil, ErrJobNotFound
+	}
+
+	j := *prev
+	change(&j)
+	if err := h.addJob(&j); err != nil {
+		// Leave the job as it was
+		if err := h.addJob(prev); err != nil {
+			log.Error().Err(err).Str("jobID", jobID).Msg("Failed to restore job after a failed update")
+		}
+		return nil, errors.Wrapf(err, "Cannot update job %s", jobID)
+	}
+	h.tags.remove(prev)
+	h.tags.add(&j)
+	h.journal(persistence.OpPut, &j)
+	return prev, nil
+}
+
+// removePending removes a pending job from its spoke or the store's pending index without counting it as removed.
+// Returns nil if the job isn't pending. Lock the hub before calling this
+func (h *Hub) removePending(jobID string) (*Job, error) {
+	if h.store != nil {
+		return h.unscheduleStored(jobID)
+	}
+	s, err := h.findOwnerSpoke(jobID)
+	if err != nil {
+		return nil, nil
+	}
+	return s.CancelJobLocked(jobID)
+}
+
 // Prune clears spokes which are expired and have no jobs
 // returns the number of spokes pruned
 func (h *Hub) Prune() int {
@@ -302,28 +831,106 @@ func (h *Hub) AddJobLocked(j *Job) error {
 
 	h.lock.Lock()
 	defer h.lock.Unlock()
+	return h.add(j)
+}
+
+// AddJobsLocked adds a batch of jobs taking the hub lock only once. The returned slice holds the error
+// for every job that was rejected, nil for accepted jobs. Jobs with the id of an existing job are rejected with ErrJobExists
+func (h *Hub) AddJobsLocked(jobs []*Job) []error {
+	defer metrics.Time("hub.job.add.batch.duration", time.Now())
+	errs := make([]error, len(jobs))
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i, j := range jobs {
+		go metrics.GaugeInt("hub.job.size", len(j.Body()))
+		errs[i] = h.add(j)
+	}
+	return errs
+}
 
+// add journals and inserts a new job. Lock the hub before calling this
+func (h *Hub) add(j *Job) error {
 	// Check is job already exists in the system
-	id := []byte(j.ID())
-	if h.jobFilter.Lookup(id) {
-		// filter can give us false positives, do a full scan
-		if spoke, _ := h.findOwnerSpoke(j.ID()); spoke != nil {
-			return fmt.Errorf("Rejecting new job. Job with ID: %s already exists", j.ID())
+	if h.exists(j.ID()) {
+		return errors.Wrapf(ErrJobExists, "Rejecting new job. Job with ID: %s", j.ID())
+	}
+	if h.consumed.contains(j.ID()) {
+		return errors.Wrapf(ErrJobExists, "Rejecting new job. Job with ID: %s was consumed within the dedup window", j.ID())
+	}
+
+	// Write ahead - a job that can't be journaled is not accepted
+	if h.wal != nil {
+		if err := h.wal.Append(persistence.OpPut, j.ID(), j); err != nil {
+			go metrics.Incr("hub.wal.error")
+			return errors.Wrap(err, "Rejecting new job. Cannot write to the write-ahead log")
 		}
 	}
 
+	return h.insert(j)
+}
+
+// exists returns true if a job by the given id is pending or reserved. Lock the hub before calling this
+func (h *Hub) exists(jobID string) bool {
+	if !h.jobFilter.Lookup([]byte(jobID)) {
+		return false
+	}
+	if h.store != nil {
+		// Reserved and dead-lettered jobs are stored as well
+		return h.storedJob(jobID) != nil
+	}
+	// filter can give us false positives, do a full scan
+	spoke, _ := h.findOwnerSpoke(jobID)
+	return spoke != nil || h.reserved.owns(jobID) || h.dead.get(jobID) != nil
+}
+
+// insert adds a job without journaling it. Lock the hub before calling this
+func (h *Hub) insert(j *Job) error {
 	err := h.addJob(j)
 	if err == nil {
-		if !h.jobFilter.Insert(id) {
-			log.Error().Msgf("Could not insert into the filter. ID: %s", id)
+		if !h.jobFilter.Insert([]byte(j.ID())) {
+			log.Error().Msgf("Could not insert into the filter. ID: %s", j.ID())
 		}
+		h.tags.add(j)
 		h.stats.IncrJob()
 		go metrics.Incr("hub.addjob")
 	}
 	return err
 }
 
+// journal appends a mutation of job j to the write-ahead log if the hub has one.
+// The mutation has already been applied, so errors are only reported. Lock the hub before calling this
+func (h *Hub) journal(op persistence.Op, j *Job) {
+	if h.wal == nil {
+		return
+	}
+	var e persistence.Entry
+	if op == persistence.OpPut {
+		e = j
+	}
+	if err := h.wal.Append(op, j.ID(), e); err != nil {
+		log.Error().Err(err).Str("jobID", j.ID()).Msg("Failed to write to the write-ahead log")
+		go metrics.Incr("hub.wal.error")
+	}
+}
+
+// addJob adds a job to the spoke owning its trigger time and wakes up waiters once it is ready.
+// Lock the hub before calling this
 func (h *Hub) addJob(j *Job) error {
+	var err error
+	if h.store != nil {
+		// The job itself is stored when it is journaled
+		err = h.store.Schedule(j.ID(), j.TriggerAt(), j.Pri())
+	} else {
+		err = h.addToSpoke(j)
+	}
+	if err == nil {
+		h.wakeAt(j.TriggerAt())
+	}
+	return err
+}
+
+func (h *Hub) addToSpoke(j *Job) error {
 	switch j.AsTemporalState() {
 	case temporal.Past:
 		log.Debug().Str("jobID", j.ID()).Msg("Adding job to past spoke")
@@ -384,6 +991,7 @@ func (h *Hub) addJob(j *Job) error {
 // StatusLocked prints the state of the spokes of this hub
 func (h *Hub) StatusLocked() {
 	log.Info().Msg("------------------------Hub Stats----------------------------")
+	log.Info().Str("queue", h.queue).Send()
 
 	hubStats := h.stats.Read()
 	log.Info().Int64("spokesCount", hubStats.CurrentSpokes).Send()
@@ -395,6 +1003,15 @@ func (h *Hub) StatusLocked() {
 	log.Info().Int64("removedJobsCount", hubStats.RemovedJobs).Send()
 	go metrics.GaugeInt("hub.job.removed.count", int(hubStats.RemovedJobs))
 
+	log.Info().Int64("reservedJobsCount", hubStats.ReservedJobs).Send()
+	go metrics.GaugeInt("hub.job.reserved.count", int(hubStats.ReservedJobs))
+
+	log.Info().Int64("deadJobsCount", hubStats.DeadJobs).Send()
+	go metrics.GaugeInt("hub.job.dead.count", int(hubStats.DeadJobs))
+
+	log.Info().Int64("expiredJobsCount", hubStats.ExpiredJobs).Send()
+	go metrics.GaugeInt("hub.job.expired.count", int(hubStats.ExpiredJobs))
+
 	// lock only for this bit - current spoke can be replaced while running...
 	h.lock.Lock()
 	defer h.lock.Unlock()
@@ -412,80 +1029,274 @@ func (h *Hub) StatusLocked() {
 // StatusPrinter starts a status printer that prints hub stats over some time interval
 func (h *Hub) StatusPrinter() {
 	t := time.NewTicker(time.Second * 10)
-	for range t.C {
-		h.StatusLocked()
+	defer t.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-t.C:
+			h.StatusLocked()
+		}
 	}
 }
 
 // PersistLocked locks the hub and starts persisting data to disk
+// The hub stays locked till all jobs are persisted so the snapshot is consistent
 func (h *Hub) PersistLocked() chan error {
 	log.Warn().Msg("Starting disk offload")
+	return h.snapshot(true)
+}
+
+// Snapshot persists all jobs to disk without locking the hub for the whole duration.
+// The hub is only locked while the write-ahead log is rotated and its jobs are copied. The copies are persisted
+// while the hub keeps serving jobs, changes made in the meantime are in the new log segment which is replayed
+// on top of the snapshot. Reservations are not journaled, so jobs reserved in the meantime are in the snapshot.
+// Once the snapshot is finalized, older snapshots and log segments are deleted
+func (h *Hub) Snapshot() chan error {
+	log.Info().Msg("Starting snapshot")
+	return h.snapshot(false)
+}
+
+func (h *Hub) snapshot(holdLock bool) chan error {
 	ec := make(chan error)
+	if h.store != nil {
+		log.Info().Msg("Hub:snapshot skipped. Jobs are kept in the job store")
+		close(ec)
+		return ec
+	}
+	if h.persister == nil {
+		go func() {
+			defer close(ec)
+			ec <- errors.New("Hub:snapshot cannot persist jobs without a persister")
+		}()
+		return ec
+	}
 
+	h.snapshotLock.Lock()
 	h.lock.Lock()
 	go func() {
-		defer h.lock.Unlock()
+		defer h.snapshotLock.Unlock()
 		defer close(ec)
 
-		log.Warn().
-			Int("totalSpokes", h.spokes.Len()).
-			Int64("pendingJobsCount", h.stats.Read().CurrentJobs).
-			Msg("About to persist")
+		version, err := h.persister.Version()
+		if err != nil {
+			h.lock.Unlock()
+			ec <- errors.Wrap(err, "Hub:snapshot cannot read snapshot version")
+			return
+		}
+		next := version + 1
+
+		// Every change from now on goes to segments the new snapshot can be restored with
+		canTruncate := true
+		if h.wal != nil {
+			if _, err := h.wal.Rotate(next); err != nil {
+				canTruncate = false
+				ec <- errors.Wrap(err, "Hub:snapshot cannot rotate write-ahead log")
+			}
+		}
 
+		// Pending jobs are copied before the hub is unlocked. Jobs taken from the spokes later are only
+		// journaled once they are consumed, they would be in neither the snapshot nor the new log segment
+		all := func(j *Job) bool { return true }
+		pending := h.pastSpoke.JobsLocked(all)
+		spokeCount := 1
+		if h.currentSpoke != nil {
+			pending = append(pending, h.currentSpoke.JobsLocked(all)...)
+			spokeCount++
+		}
 		for i := 0; i < h.spokes.Len(); i++ {
-			s := h.spokes.AtIdx(i).Value().(*Spoke)
-			errC := s.PersistLocked(h.persister)
-			for e := range errC {
-				ec <- e
+			if s := h.spokes.AtIdx(i).Value().(*Spoke); s != h.currentSpoke {
+				pending = append(pending, s.JobsLocked(all)...)
+				spokeCount++
 			}
 		}
+		// Reserved jobs were never acknowledged so they are still pending.
+		// Dead-lettered jobs are persisted along with them and restored into the dead-letter store
+		reserved := h.reserved.jobs()
+		dead := h.dead.jobs(-1)
+		// Segments of spokes paged in from now on are only deleted once the snapshot is done
+		var segments []string
+		if h.spill != nil {
+			segments = h.spilledSegments()
+		}
+		jobs := make([]*Job, 0, len(pending)+len(reserved)+len(dead))
+		for _, group := range [][]*Job{pending, reserved, dead} {
+			for _, j := range group {
+				jc := *j
+				jobs = append(jobs, &jc)
+			}
+		}
+
+		log.Warn().
+			Int("totalSpokes", spokeCount).
+			Int64("pendingJobsCount", h.stats.Read().CurrentJobs).
+			Int("reservedJobsCount", len(reserved)).
+			Int("deadJobsCount", len(dead)).
+			Int("spilledSegmentsCount", len(segments)).
+			Msg("About to persist")
 
-		// Save past spoke
-		errC := h.pastSpoke.PersistLocked(h.persister)
-		for e := range errC {
-			ec <- e
+		if holdLock {
+			defer h.lock.Unlock()
+		} else {
+			h.lock.Unlock()
 		}
 
-		// Save current spoke
-		if h.currentSpoke != nil {
-			errC := h.currentSpoke.PersistLocked(h.persister)
-			for e := range errC {
-				ec <- e
+		if err := h.persister.Begin(); err != nil {
+			ec <- err
+			return
+		}
+		for _, key := range segments {
+			spilled, err := h.readSegment(key)
+			if err != nil {
+				canTruncate = false
+				ec <- err
+				continue
+			}
+			jobs = append(jobs, spilled...)
+		}
+		for _, j := range jobs {
+			if err := h.persister.Persist(j); err != nil {
+				canTruncate = false
+				ec <- err
 			}
 		}
-
 		h.persister.Finalize()
+
+		if canTruncate {
+			if err := h.truncate(next); err != nil {
+				ec <- err
+			}
+		}
 	}()
 
 	return ec
 }
 
-// Restore loads any jobs saved to disk at the given path
-func (h *Hub) Restore() error {
-	jobs, err := h.persister.Recover()
+// truncate deletes snapshots and write-ahead log segments older than the given snapshot version.
+// Nothing is deleted unless the given version is the latest finalized snapshot
+func (h *Hub) truncate(version uint64) error {
+	latest, err := h.persister.Version()
 	if err != nil {
-		return err
+		return errors.Wrap(err, "Hub:truncate cannot read snapshot version")
+	}
+	if latest != version {
+		return errors.Errorf("Hub:truncate snapshot %d was not finalized. Latest snapshot is %d", version, latest)
+	}
+	if err := h.persister.Truncate(version); err != nil {
+		return errors.Wrap(err, "Hub:truncate cannot delete old snapshots")
+	}
+	if h.wal != nil {
+		if err := h.wal.Truncate(version); err != nil {
+			return errors.Wrap(err, "Hub:truncate cannot delete old write-ahead log segments")
+		}
+	}
+	log.Info().Uint64("version", version).Msg("Hub:truncate deleted older snapshots")
+	return nil
+}
+
+// snapshotter takes a snapshot at every interval till the hub is stopped
+func (h *Hub) snapshotter(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-t.C:
+			start := time.Now()
+			errCount := 0
+			for err := range h.Snapshot() {
+				errCount++
+				log.Error().Err(err).Msg("Hub:snapshotter")
+			}
+			go metrics.Time("hub.snapshot.duration", start)
+			log.Info().Int("errorCount", errCount).Dur("duration", time.Since(start)).Msg("Hub:snapshotter finished snapshot")
+		}
+	}
+}
+
+// Restore loads any jobs saved to disk at the given path and then replays the write-ahead log on top of them
+func (h *Hub) Restore() error {
+	// A snapshot taken while restoring would be incomplete
+	h.snapshotLock.Lock()
+	defer h.snapshotLock.Unlock()
+	if h.store != nil {
+		return h.recover()
+	}
+
+	// Without a persister there are no snapshots and the whole write-ahead log is replayed
+	var version uint64
+	jobs := make(chan []byte)
+	close(jobs)
+	if h.persister != nil {
+		var err error
+		version, err = h.persister.Version()
+		if err != nil {
+			return err
+		}
+		jobs, err = h.persister.Recover()
+		if err != nil {
+			return err
+		}
 	}
 
 	errDecodeCount := 0
 	errAddCount := 0
 	recoverCount := 0
+	expiredCount := 0
+	restored := make(map[string]*Job)
 	for e := range jobs {
 		j := new(Job)
-		err := j.GobDecode(e)
+		err := h.codec.Decode(e, j)
 		if err != nil {
 			errDecodeCount++
 			log.Error().Err(err).Send()
 			continue
 		}
-		if err = h.AddJobLocked(j); err != nil {
+		restored[j.ID()] = j
+	}
+
+	if h.wal != nil {
+		records, err := h.wal.Replay(version)
+		if err != nil {
+			return err
+		}
+		for r := range records {
+			switch r.Op {
+			case persistence.OpPut:
+				j := new(Job)
+				if err := h.codec.Decode(r.Data, j); err != nil {
+					errDecodeCount++
+					log.Error().Err(err).Send()
+					continue
+				}
+				restored[j.ID()] = j
+			case persistence.OpCancel, persistence.OpConsume:
+				delete(restored, r.ID)
+			}
+		}
+	}
+
+	for _, j := range restored {
+		// Jobs that expired while the hub was down are not worth delivering anymore
+		if j.deadAt.IsZero() && j.IsExpired() {
+			expiredCount++
+			h.stats.IncrExpired()
+			continue
+		}
+		// Restored jobs are already durable - add them without journaling them again
+		if err := func() error {
+			h.lock.Lock()
+			defer h.lock.Unlock()
+			return h.restore(j)
+		}(); err != nil {
 			errAddCount++
 			log.Error().Err(err).Send()
 			continue
 		}
 		recoverCount++
 	}
-	log.Info().Int("recoverCount", recoverCount).Msg("Hub:Restore recovered entries")
+	log.Info().Int("recoverCount", recoverCount).Int("expiredCount", expiredCount).Msg("Hub:Restore recovered entries")
 
 	if errAddCount == 0 && errDecodeCount == 0 {
 		return nil
@@ -497,10 +1308,72 @@ func (h *Hub) Restore() error {
 	return retErr
 }
 
+// restore adds a restored job to the pending jobs or the dead-letter store without journaling it.
+// Lock the hub before calling this
+func (h *Hub) restore(j *Job) error {
+	if h.exists(j.ID()) {
+		return fmt.Errorf("Skipping restored job. Job with ID: %s already exists", j.ID())
+	}
+	if !j.deadAt.IsZero() {
+		h.dead.add(j)
+		h.jobFilter.Insert([]byte(j.ID()))
+		h.tags.add(j)
+		h.stats.IncrDead()
+		return nil
+	}
+	return h.insert(j)
+}
+
+// ApplyLocked applies a write-ahead log record of another hub, e.g. one streamed from a primary server to
+// its standby replica. A put replaces the job with the same id, cancels and consumes remove the job.
+// The mutation is journaled if the hub has a write-ahead log
+func (h *Hub) ApplyLocked(r persistence.Record) error {
+	var j *Job
+	if r.Op == persistence.OpPut {
+		j = new(Job)
+		if err := h.codec.Decode(r.Data, j); err != nil {
+			return err
+		}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if _, err := h.cancel(r.ID); err != nil {
+		return err
+	}
+	if j == nil {
+		return nil
+	}
+	if err := h.restore(j); err != nil {
+		return err
+	}
+	h.journal(persistence.OpPut, j)
+	return nil
+}
+
 // GetNJobs returns upto N jobs (or less if there are less jobs in available)
-// It does not return a consistent snapshot of jobs but provides a best effort view
+// It does not return a consistent snapshot of jobs but provides a best effort view. Spilled jobs are not returned
 func (h *Hub) GetNJobs(n int) chan *Job {
 	jobChan := make(chan *Job)
+	if h.store != nil {
+		go func() {
+			defer close(jobChan)
+			err := h.store.Pending(func(data []byte) bool {
+				j := new(Job)
+				if err := h.codec.Decode(data, j); err != nil {
+					log.Error().Err(err).Msg("Failed to decode stored job")
+					return true
+				}
+				jobChan <- j
+				n--
+				return n > 0
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to read stored jobs")
+			}
+		}()
+		return jobChan
+	}
 	go func() {
 		defer close(jobChan)
 		func() {
@@ -541,3 +1414,137 @@ func (h *Hub) GetNJobs(n int) chan *Job {
 
 	return jobChan
 }
+
+// PendingJobsLocked returns up to n pending jobs that match and whose ids are greater than after in order of
+// their ids, e.g. to move them to another server in batches. Pass the id of the last job of a batch to get the next.
+// Reserved and dead-lettered jobs are never returned. Spill segments and stored jobs that cannot hold any of the
+// n lowest ids are not read
+func (h *Hub) PendingJobsLocked(after string, match func(j *Job) bool, n int) []*Job {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	page := &jobPage{after: after, n: n}
+	add := func(j *Job) bool {
+		return page.wants(j.ID()) && match(j)
+	}
+	for _, j := range h.pastSpoke.JobsLocked(add) {
+		page.add(j)
+	}
+	for _, s := range h.spokeMap {
+		for _, j := range s.JobsLocked(add) {
+			page.add(j)
+		}
+	}
+	for _, ss := range h.spilled {
+		for _, seg := range ss.segments {
+			if !page.overlaps(seg.first, seg.last) {
+				continue
+			}
+			js, err := h.readSegment(seg.key)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to read spilled jobs")
+				continue
+			}
+			for _, j := range js {
+				if add(j) {
+					page.add(j)
+				}
+			}
+		}
+	}
+	if h.store != nil {
+		// Ids come in order, none is wanted past the first one that isn't
+		err := h.store.Stored(after, func(id string, data []byte) bool {
+			if !page.wants(id) {
+				return false
+			}
+			if h.reserved.owns(id) || h.dead.get(id) != nil {
+				return true
+			}
+			j := new(Job)
+			if err := h.codec.Decode(data, j); err != nil {
+				log.Error().Err(err).Str("jobID", id).Msg("Failed to decode stored job")
+				return true
+			}
+			if match(j) {
+				page.add(j)
+			}
+			return true
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read stored jobs")
+		}
+	}
+	return page.sorted()
+}
+
+// jobPage collects the n jobs with the lowest ids greater than a cursor id. Its jobs are kept in a heap
+// with the highest id on top, which is dropped once more than n jobs are added
+type jobPage struct {
+	after string
+	n     int
+	jobs  jobsByIDDesc
+}
+
+// wants returns true if a job with the given id would be part of the page
+func (p *jobPage) wants(id string) bool {
+	return id > p.after && (len(p.jobs) < p.n || id < p.jobs[0].ID())
+}
+
+// overlaps returns true if a job with an id from first to last may be part of the page
+func (p *jobPage) overlaps(first, last string) bool {
+	return last > p.after && (len(p.jobs) < p.n || first < p.jobs[0].ID())
+}
+
+func (p *jobPage) add(j *Job) {
+	if !p.wants(j.ID()) {
+		return
+	}
+	heap.Push(&p.jobs, j)
+	if len(p.jobs) > p.n {
+		heap.Pop(&p.jobs)
+	}
+}
+
+// sorted returns the jobs of the page in order of their ids
+func (p *jobPage) sorted() []*Job {
+	jobs := []*Job(p.jobs)
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].ID() < jobs[k].ID()
+	})
+	return jobs
+}
+
+type jobsByIDDesc []*Job
+
+func (js jobsByIDDesc) Len() int            { return len(js) }
+func (js jobsByIDDesc) Less(i, k int) bool  { return js[i].ID() > js[k].ID() }
+func (js jobsByIDDesc) Swap(i, k int)       { js[i], js[k] = js[k], js[i] }
+func (js *jobsByIDDesc) Push(x interface{}) { *js = append(*js, x.(*Job)) }
+func (js *jobsByIDDesc) Pop() interface{} {
+	old := *js
+	j := old[len(old)-1]
+	*js = old[:len(old)-1]
+	return j
+}
+
+// JobsLocked returns copies of all pending, reserved and dead-lettered jobs, e.g. to send them to a standby replica
+func (h *Hub) JobsLocked() []*Job {
+	all := func(j *Job) bool { return true }
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	jobs := h.pastSpoke.JobsLocked(all)
+	for _, s := range h.spokeMap {
+		jobs = append(jobs, s.JobsLocked(all)...)
+	}
+	jobs = append(jobs, h.reserved.jobs()...)
+	jobs = append(jobs, h.dead.jobs(-1)...)
+	for i, j := range jobs {
+		jc := *j
+		jobs[i] = &jc
+	}
+	// Spilled and stored jobs are read as copies
+	jobs = append(jobs, h.spilledJobs()...)
+	return append(jobs, h.storedJobs(all)...)
+}
@@ -1,13 +1,17 @@
 package chronomq_test
 
 import (
+	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"time"
 
 	. "github.com/onsi/ginkgo"
+	"github.com/pkg/errors"
 	. "github.com/onsi/gomega"
 
 	. "github.com/chronomq/chronomq/pkg/chronomq"
@@ -16,6 +20,18 @@ import (
 
 var persister persistence.Persister
 
+// blockingPersister holds snapshots in Begin till it is released
+type blockingPersister struct {
+	persistence.Persister
+	begun, release chan struct{}
+}
+
+func (p *blockingPersister) Begin() error {
+	close(p.begun)
+	<-p.release
+	return p.Persister.Begin()
+}
+
 var _ = Describe("Test hub", func() {
 	defer GinkgoRecover()
 
@@ -103,6 +119,232 @@ var _ = Describe("Test hub", func() {
 
 	}, 1.500)
 
+	It("dequeues ready jobs by priority", func() {
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: persister, AttemptRestore: false})
+
+		now := time.Now()
+		jobs := []*Job{}
+		for i := 0; i < 10; i++ {
+			j := NewJobAutoID(now.Add(-time.Duration(rand.Intn(9999))), nil)
+			j.SetOpts(int32(i), 0)
+			jobs = append(jobs, j)
+		}
+		rand.Shuffle(len(jobs), func(i, j int) {
+			jobs[i], jobs[j] = jobs[j], jobs[i]
+		})
+		for _, j := range jobs {
+			Expect(h.AddJobLocked(j)).To(Succeed())
+		}
+
+		for i := 9; i >= 0; i-- {
+			Expect(h.NextLocked().Pri()).To(Equal(int32(i)))
+		}
+	})
+
+	It("reserves jobs with a ttr and requeues them when the reservation expires", func() {
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: persister, AttemptRestore: false})
+
+		j := NewJobAutoID(time.Now().Add(-time.Second), []byte("reserve me"))
+		j.SetOpts(0, time.Millisecond*50)
+		Expect(h.AddJobLocked(j)).To(Succeed())
+
+		Expect(h.NextLocked()).To(Equal(j))
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(0)))
+		Expect(h.Stats().ReservedJobs).To(Equal(int64(1)))
+		Expect(h.NextLocked()).To(BeNil())
+
+		// A reserved job still owns its id
+		Expect(h.AddJobLocked(NewJob(j.ID(), time.Now(), nil))).NotTo(Succeed())
+
+		// Touching extends the reservation
+		time.Sleep(time.Millisecond * 30)
+		Expect(h.TouchLocked(j.ID())).To(Succeed())
+		time.Sleep(time.Millisecond * 30)
+		Expect(h.NextLocked()).To(BeNil())
+
+		// Expired reservation makes the job ready again
+		time.Sleep(time.Millisecond * 30)
+		Expect(h.NextLocked()).To(Equal(j))
+		Expect(h.Stats().ReservedJobs).To(Equal(int64(1)))
+
+		// Ack removes it for good
+		Expect(h.AckLocked(j.ID())).To(Equal(j))
+		Expect(h.Stats().ReservedJobs).To(Equal(int64(0)))
+		_, err := h.AckLocked(j.ID())
+		Expect(err).To(Equal(ErrJobNotReserved))
+		Expect(h.TouchLocked(j.ID())).To(Equal(ErrJobNotReserved))
+		Expect(h.AddJobLocked(NewJob(j.ID(), time.Now(), nil))).To(Succeed())
+	})
+
+	It("releases reserved jobs back into the hub", func() {
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: persister, AttemptRestore: false})
+
+		j := NewJobAutoID(time.Now().Add(-time.Second), nil)
+		j.SetOpts(0, time.Minute)
+		Expect(h.AddJobLocked(j)).To(Succeed())
+
+		Expect(h.NextLocked()).To(Equal(j))
+		Expect(h.ReleaseLocked(j.ID(), 0)).To(Succeed())
+		Expect(h.ReleaseLocked(j.ID(), 0)).To(Equal(ErrJobNotReserved))
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(1)))
+
+		// Released with a delay
+		Expect(h.NextLocked()).To(Equal(j))
+		Expect(h.ReleaseLocked(j.ID(), time.Millisecond*50)).To(Succeed())
+		Expect(h.NextLocked()).To(BeNil())
+		Eventually(h.NextLocked).Should(Equal(j))
+
+		// Reserved jobs can be canceled
+		Expect(h.CancelJobLocked(j.ID())).To(Equal(j))
+		Expect(h.Stats().ReservedJobs).To(Equal(int64(0)))
+	})
+
+	It("adds, takes and cancels jobs in batches", func() {
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: persister, AttemptRestore: false})
+		defer h.Stop(false)
+
+		now := time.Now()
+		ttr := NewJob("ttr", now.Add(-time.Second), nil)
+		ttr.SetOpts(0, time.Minute)
+		errs := h.AddJobsLocked([]*Job{
+			NewJob("a", now.Add(-time.Millisecond), nil),
+			ttr,
+			NewJob("a", now, nil),
+			NewJob("later", now.Add(time.Hour), nil),
+		})
+		Expect(errs).To(HaveLen(4))
+		Expect(errs[0]).NotTo(HaveOccurred())
+		Expect(errs[1]).NotTo(HaveOccurred())
+		Expect(errors.Cause(errs[2])).To(Equal(ErrJobExists))
+		Expect(errs[3]).NotTo(HaveOccurred())
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(3)))
+
+		jobs := h.NextNLocked(5)
+		Expect(jobs).To(HaveLen(2))
+		Expect(jobs[0]).To(Equal(ttr))
+		Expect(jobs[1].ID()).To(Equal("a"))
+		Expect(h.NextNLocked(5)).To(BeEmpty())
+		Expect(h.Stats().ReservedJobs).To(Equal(int64(1)))
+
+		canceled := h.CancelJobsLocked([]string{"later", "a", "ttr"})
+		Expect(canceled).To(HaveLen(3))
+		Expect(canceled[0].ID()).To(Equal("later"))
+		Expect(canceled[1]).To(BeNil())
+		Expect(canceled[2]).To(Equal(ttr))
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(0)))
+		Expect(h.Stats().ReservedJobs).To(Equal(int64(0)))
+	})
+
+	It("reschedules and updates pending jobs in place", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Millisecond * 100, Persister: persister, AttemptRestore: false})
+		defer h.Stop(false)
+
+		now := time.Now()
+		Expect(h.AddJobLocked(NewJob("reminder", now.Add(-time.Second), []byte("old")))).To(Succeed())
+		Expect(h.AddJobLocked(NewJob("later", now.Add(time.Hour), nil))).To(Succeed())
+
+		// Push a ready job back into a future spoke and pull a future job into the past spoke
+		soon := now.Add(time.Millisecond * 200)
+		Expect(h.RescheduleLocked("reminder", soon)).To(Succeed())
+		Expect(h.RescheduleLocked("later", now.Add(-time.Minute))).To(Succeed())
+		prev, err := h.UpdateBodyLocked("reminder", []byte("new"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(prev.Body())).To(Equal("old"))
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(2)))
+
+		Expect(h.NextLocked().ID()).To(Equal("later"))
+		Expect(h.NextLocked()).To(BeNil())
+		Eventually(h.Ready(), time.Second).Should(BeClosed())
+		j := h.NextLocked()
+		Expect(j.ID()).To(Equal("reminder"))
+		Expect(j.TriggerAt()).To(Equal(soon))
+		Expect(string(j.Body())).To(Equal("new"))
+
+		// Consumed, unknown and reserved jobs are not pending anymore
+		Expect(h.RescheduleLocked("reminder", now)).To(Equal(ErrJobNotFound))
+		_, err = h.UpdateBodyLocked("unknown", nil)
+		Expect(err).To(Equal(ErrJobNotFound))
+		ttr := NewJob("ttr", now, nil)
+		ttr.SetOpts(0, time.Minute)
+		Expect(h.AddJobLocked(ttr)).To(Succeed())
+		Expect(h.NextLocked()).To(Equal(ttr))
+		Expect(h.RescheduleLocked("ttr", now.Add(time.Hour))).To(Equal(ErrJobNotFound))
+	}, 2)
+
+	It("gets jobs by id in every state", func() {
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: persister, AttemptRestore: false, Backoff: BackoffPolicy{MaxAttempts: 1}})
+		defer h.Stop(false)
+
+		later := time.Now().Add(time.Hour)
+		pending := NewJob("pending", later, []byte("pending"))
+		pending.SetOpts(3, 0)
+		Expect(h.AddJobLocked(pending)).To(Succeed())
+		for _, id := range []string{"reserved", "dead"} {
+			j := NewJob(id, time.Now(), nil)
+			j.SetOpts(0, time.Minute)
+			Expect(h.AddJobLocked(j)).To(Succeed())
+			Expect(h.NextLocked().ID()).To(Equal(id))
+		}
+		Expect(h.NackLocked("dead")).To(BeTrue())
+
+		j, state, err := h.GetJobLocked("pending")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(JobPending))
+		Expect(j.TriggerAt()).To(Equal(later))
+		Expect(j.Pri()).To(Equal(int32(3)))
+		Expect(string(j.Body())).To(Equal("pending"))
+		_, state, err = h.GetJobLocked("reserved")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(JobReserved))
+		_, state, err = h.GetJobLocked("dead")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(JobDead))
+
+		Expect(h.AckLocked("reserved")).NotTo(BeNil())
+		_, _, err = h.GetJobLocked("reserved")
+		Expect(err).To(Equal(ErrJobNotFound))
+		_, _, err = h.GetJobLocked("unknown")
+		Expect(err).To(Equal(ErrJobNotFound))
+	})
+
+	It("signals waiters when jobs become ready", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: persister, AttemptRestore: false})
+		defer h.Stop(false)
+
+		// A job that is ready right away wakes up waiters as soon as it is added
+		ready := h.Ready()
+		Expect(h.AddJobLocked(NewJob("now", time.Now(), nil))).To(Succeed())
+		Expect(ready).To(BeClosed())
+		Expect(h.NextLocked().ID()).To(Equal("now"))
+
+		// Future jobs wake up waiters at their trigger time, even if a later job is added in between.
+		// Jobs of the same spoke wake them up in turn
+		soon := time.Now().Add(time.Millisecond * 150)
+		later := soon.Add(time.Millisecond * 150)
+		Expect(h.AddJobLocked(NewJob("later", later, nil))).To(Succeed())
+		Expect(h.AddJobLocked(NewJob("soon", soon, nil))).To(Succeed())
+		for _, next := range []struct {
+			id string
+			at time.Time
+		}{{"soon", soon}, {"later", later}} {
+			ready = h.Ready()
+			Eventually(ready, time.Millisecond*300).Should(BeClosed())
+			Expect(time.Now()).To(BeTemporally(">=", next.at))
+			Expect(h.NextLocked().ID()).To(Equal(next.id))
+		}
+
+		// Expired reservations wake up waiters too
+		j := NewJob("ttr", time.Now(), nil)
+		j.SetOpts(0, time.Millisecond*100)
+		Expect(h.AddJobLocked(j)).To(Succeed())
+		Expect(h.NextLocked()).To(Equal(j))
+		ready = h.Ready()
+		Eventually(ready, time.Millisecond*300).Should(BeClosed())
+		Expect(h.NextLocked()).To(Equal(j))
+	}, 2)
+
 	It("Persists and recovers from disk", func(done Done) {
 		defer close(done)
 
@@ -157,6 +399,200 @@ var _ = Describe("Test hub", func() {
 		Expect(int64(counter)).To(Equal(h.Stats().CurrentJobs))
 	}, 15)
 
+	It("restores jobs from the write-ahead log", func(done Done) {
+		defer close(done)
+
+		dir, err := ioutil.TempDir("", "chronomqhubwal")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		walCfg := persistence.WALConfig{Dir: dir, Sync: persistence.SyncNone}
+
+		wal, err := persistence.NewWAL(walCfg)
+		Expect(err).To(BeNil())
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: persister, WAL: wal})
+
+		for i := 0; i < 10; i++ {
+			Expect(h.AddJobLocked(NewJob(fmt.Sprintf("past%d", i), time.Now().Add(-time.Second), nil))).To(Succeed())
+			Expect(h.AddJobLocked(NewJob(fmt.Sprintf("future%d", i), time.Now().Add(time.Hour), nil))).To(Succeed())
+		}
+		reserved := NewJob("reserved", time.Now().Add(-time.Hour), nil)
+		reserved.SetOpts(0, time.Minute)
+		Expect(h.AddJobLocked(reserved)).To(Succeed())
+		acked := NewJob("acked", time.Now().Add(-time.Hour), nil)
+		acked.SetOpts(0, time.Minute)
+		Expect(h.AddJobLocked(acked)).To(Succeed())
+
+		// reserve and ack
+		Expect(h.NextLocked()).To(Equal(reserved))
+		Expect(h.NextLocked()).To(Equal(acked))
+		Expect(h.AckLocked(acked.ID())).To(Equal(acked))
+		// consume 2 past jobs, cancel 1 future job
+		Expect(h.NextLocked()).ToNot(BeNil())
+		Expect(h.NextLocked()).ToNot(BeNil())
+		Expect(h.CancelJobLocked("future1")).ToNot(BeNil())
+		Expect(wal.Close()).To(Succeed())
+
+		wal, err = persistence.NewWAL(walCfg)
+		Expect(err).To(BeNil())
+		defer wal.Close()
+		restored := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: persister, WAL: wal})
+		Expect(restored.Restore()).To(Succeed())
+		// 8 past + 9 future + 1 reserved
+		Expect(restored.Stats().CurrentJobs).To(Equal(int64(18)))
+		Expect(restored.CancelJobLocked("future1")).To(BeNil())
+		j, err := restored.CancelJobLocked("reserved")
+		Expect(err).To(BeNil())
+		Expect(j.ID()).To(Equal(reserved.ID()))
+		Expect(j.TTR()).To(Equal(reserved.TTR()))
+	}, 5)
+
+	It("replays the whole write-ahead log without a persister", func(done Done) {
+		defer close(done)
+
+		dir, err := ioutil.TempDir("", "chronomqhubwal")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		walCfg := persistence.WALConfig{Dir: dir, Sync: persistence.SyncNone}
+
+		wal, err := persistence.NewWAL(walCfg)
+		Expect(err).To(BeNil())
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, WAL: wal})
+		Expect(h.AddJobLocked(NewJob("logged", time.Now().Add(time.Hour), nil))).To(Succeed())
+		errCount := 0
+		for range h.Snapshot() {
+			errCount++
+		}
+		Expect(errCount).To(Equal(1))
+		Expect(wal.Close()).To(Succeed())
+
+		wal, err = persistence.NewWAL(walCfg)
+		Expect(err).To(BeNil())
+		defer wal.Close()
+		restored := NewHub(&HubOpts{SpokeSpan: time.Second, WAL: wal})
+		Expect(restored.Restore()).To(Succeed())
+		Expect(restored.Stats().CurrentJobs).To(Equal(int64(1)))
+	}, 5)
+
+	It("restores jobs written with another codec", func(done Done) {
+		defer close(done)
+
+		dir, err := ioutil.TempDir("", "chronomqhubcodec")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		store, err := persistence.InMemStorage()
+		Expect(err).To(BeNil())
+		p := persistence.NewJournalPersisterWithCodec(store, persistence.ProtobufCodec)
+		walCfg := persistence.WALConfig{Dir: dir, Sync: persistence.SyncNone, Codec: persistence.ProtobufCodec}
+
+		wal, err := persistence.NewWAL(walCfg)
+		Expect(err).To(BeNil())
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p, WAL: wal, Codec: persistence.ProtobufCodec})
+		snapshotted := NewJob("snapshotted", time.Now().Add(time.Hour), []byte("snapshot"))
+		snapshotted.SetHeaders(map[string]string{"k": "v"})
+		Expect(h.AddJobLocked(snapshotted)).To(Succeed())
+		for e := range h.Snapshot() {
+			Fail("Snapshot failed due to error: " + e.Error())
+		}
+		Expect(h.AddJobLocked(NewJob("logged", time.Now().Add(time.Hour), []byte("log")))).To(Succeed())
+		Expect(wal.Close()).To(Succeed())
+
+		// The default codec reads protobuf records
+		wal, err = persistence.NewWAL(persistence.WALConfig{Dir: dir, Sync: persistence.SyncNone})
+		Expect(err).To(BeNil())
+		defer wal.Close()
+		restored := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p, WAL: wal})
+		Expect(restored.Restore()).To(Succeed())
+		Expect(restored.Stats().CurrentJobs).To(Equal(int64(2)))
+		j, _, err := restored.GetJobLocked("snapshotted")
+		Expect(err).To(BeNil())
+		Expect(j.Body()).To(Equal([]byte("snapshot")))
+		Expect(j.Headers()).To(Equal(map[string]string{"k": "v"}))
+		j, _, err = restored.GetJobLocked("logged")
+		Expect(err).To(BeNil())
+		Expect(j.Body()).To(Equal([]byte("log")))
+	}, 5)
+
+	It("snapshots without holding the hub and truncates the write-ahead log", func(done Done) {
+		defer close(done)
+
+		dir, err := ioutil.TempDir("", "chronomqhubsnap")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		walCfg := persistence.WALConfig{Dir: dir, Sync: persistence.SyncNone}
+
+		wal, err := persistence.NewWAL(walCfg)
+		Expect(err).To(BeNil())
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: persister, WAL: wal})
+
+		for i := 0; i < 10; i++ {
+			Expect(h.AddJobLocked(NewJob(fmt.Sprintf("before%d", i), time.Now().Add(time.Hour), nil))).To(Succeed())
+		}
+		for err := range h.Snapshot() {
+			Expect(err).To(BeNil())
+		}
+		v, err := persister.Version()
+		Expect(err).To(BeNil())
+		Expect(v).To(Equal(uint64(1)))
+		// Changes after the snapshot only live in the log
+		Expect(h.AddJobLocked(NewJob("after", time.Now().Add(time.Hour), nil))).To(Succeed())
+		Expect(h.CancelJobLocked("before0")).ToNot(BeNil())
+
+		for err := range h.Snapshot() {
+			Expect(err).To(BeNil())
+		}
+		Expect(h.AddJobLocked(NewJob("last", time.Now().Add(time.Hour), nil))).To(Succeed())
+		Expect(wal.Close()).To(Succeed())
+
+		// Only segments written after the latest snapshot are kept
+		segments, err := filepath.Glob(filepath.Join(dir, "wal.*"))
+		Expect(err).To(BeNil())
+		Expect(segments).To(HaveLen(1))
+
+		wal, err = persistence.NewWAL(walCfg)
+		Expect(err).To(BeNil())
+		defer wal.Close()
+		restored := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: persister, WAL: wal})
+		Expect(restored.Restore()).To(Succeed())
+		// 9 before + after + last
+		Expect(restored.Stats().CurrentJobs).To(Equal(int64(11)))
+		Expect(restored.CancelJobLocked("before0")).To(BeNil())
+		Expect(restored.CancelJobLocked("last")).ToNot(BeNil())
+	}, 5)
+
+	It("snapshots jobs reserved while the snapshot is persisted", func(done Done) {
+		defer close(done)
+
+		dir, err := ioutil.TempDir("", "chronomqhubsnap")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		walCfg := persistence.WALConfig{Dir: dir, Sync: persistence.SyncNone}
+
+		wal, err := persistence.NewWAL(walCfg)
+		Expect(err).To(BeNil())
+		p := &blockingPersister{Persister: persister, begun: make(chan struct{}), release: make(chan struct{})}
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p, WAL: wal})
+		j := NewJob("ttr", time.Now(), nil)
+		j.SetOpts(0, time.Hour)
+		Expect(h.AddJobLocked(j)).To(Succeed())
+
+		errC := h.Snapshot()
+		// The hub is unlocked once the snapshot begins. Reserving a job isn't journaled
+		<-p.begun
+		Expect(h.NextLocked()).To(Equal(j))
+		close(p.release)
+		for err := range errC {
+			Expect(err).To(BeNil())
+		}
+		Expect(wal.Close()).To(Succeed())
+
+		wal, err = persistence.NewWAL(walCfg)
+		Expect(err).To(BeNil())
+		defer wal.Close()
+		restored := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: persister, WAL: wal})
+		Expect(restored.Restore()).To(Succeed())
+		Expect(restored.CancelJobLocked("ttr")).ToNot(BeNil())
+	}, 5)
+
 	It("bootstraps a new hub from a golden peristence record", func(done Done) {
 		defer close(done)
 		wd, _ := os.Getwd()
@@ -1,10 +1,7 @@
 package chronomq
 
 import (
-	"bytes"
-	"encoding/gob"
 	"fmt"
-	"io"
 	"time"
 	"unsafe"
 
@@ -26,6 +23,15 @@ type Job struct {
 
 	pri int32
 	ttr time.Duration
+
+	attempts int32     // Number of times consumers failed the job
+	deadAt   time.Time // When the job was moved to the dead-letter store. Zero for live jobs
+
+	schedule *Schedule // Set for recurring jobs
+	expireAt time.Time // When the job expires if it hasn't been consumed. Zero if it never expires
+	tags     []string  // Labels to cancel jobs by, see Hub.CancelByTagLocked
+
+	headers map[string]string // Metadata for consumers, e.g. the job type to route on
 }
 
 // Impl Job
@@ -91,6 +97,42 @@ func (j *Job) TriggerAt() time.Time {
 	return j.triggerAt
 }
 
+// Pri returns the job's priority. Among jobs that are ready at the same time, jobs with a higher priority are dequeued first
+func (j *Job) Pri() int32 {
+	return j.pri
+}
+
+// TTR returns the job's time-to-run. Jobs with a TTR are reserved when they are dequeued and
+// return to the hub unless they are acknowledged within this duration
+func (j *Job) TTR() time.Duration {
+	return j.ttr
+}
+
+// Attempts returns the number of times consumers failed the job
+func (j *Job) Attempts() int32 {
+	return j.attempts
+}
+
+// DeadAt returns when the job was moved to the dead-letter store or the zero time if it is not dead-lettered
+func (j *Job) DeadAt() time.Time {
+	return j.deadAt
+}
+
+// ExpireAt returns when the job expires if it hasn't been consumed or the zero time if it never expires
+func (j *Job) ExpireAt() time.Time {
+	return j.expireAt
+}
+
+// SetHeaders sets the job's headers - metadata that consumers can look at without parsing the body
+func (j *Job) SetHeaders(headers map[string]string) {
+	j.headers = headers
+}
+
+// Headers returns the job's headers
+func (j *Job) Headers() map[string]string {
+	return j.headers
+}
+
 // IsReady returns true if job is ready to be worked on
 func (j *Job) IsReady() bool {
 	return time.Now().After(j.triggerAt)
@@ -106,79 +148,37 @@ func (j *Job) AsBound(spokeSpan time.Duration) temporal.Bound {
 
 // AsPriorityItem returns this job as a prioritizable item
 func (j *Job) AsPriorityItem() *queue.Item {
-	return queue.NewItem(j, j.triggerAt)
+	return queue.NewRankedItem(j, j.triggerAt, j.pri)
 }
 
-// GobEncode encodes a job into a binary buffer
-func (j *Job) GobEncode() (data []byte, err error) {
-	// We have a file for this Namespace
-	buf := new(bytes.Buffer)
-	enc := gob.NewEncoder(buf)
-
-	// id
-	err = enc.Encode(j.id)
-	if err != nil {
-		return nil, err
-	}
-	//pri
-	err = enc.Encode(j.pri)
-	if err != nil {
-		return nil, err
-	}
-	//trigger at
-	err = enc.Encode(j.triggerAt.UnixNano())
-	if err != nil {
-		return nil, err
-	}
-	//ttr
-	err = enc.Encode(j.ttr)
-	if err != nil {
-		return nil, err
-	}
-	//body
-	err = enc.Encode(j.body)
-	if err != nil {
-		return nil, err
-	}
-
+// GobEncode encodes a job into a binary buffer in the current format, see encoding.go
+func (j *Job) GobEncode() ([]byte, error) {
+	data, err := encodeJob(j)
 	if err != nil {
 		err = errors.Wrap(err, "Job: Failed to encode job for persistence")
-		log.Error().Err(err)
+		log.Error().Err(err).Send()
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return data, nil
 }
 
-// GobDecode encodes a job into a binary buffer
+// GobDecode decodes a job encoded in the current or any earlier format
 func (j *Job) GobDecode(data []byte) error {
-	dec := gob.NewDecoder(bytes.NewReader(data))
+	return decodeJob(j, data)
+}
 
-	// id
-	err := dec.Decode(&j.id)
+// Marshal encodes a job as a protocol buffer, see job.proto
+func (j *Job) Marshal() ([]byte, error) {
+	data, err := encodeJobProto(j)
 	if err != nil {
-		return err
-	}
-	// pri
-	err = dec.Decode(&j.pri)
-	if err != nil {
-		return err
-	}
-	//trigger at
-	var triggerAtUnixNano int64
-	err = dec.Decode(&triggerAtUnixNano)
-	if err != nil {
-		return err
-	}
-	j.triggerAt = time.Unix(0, triggerAtUnixNano)
-	//ttr
-	err = dec.Decode(&j.ttr)
-	if err != nil {
-		return err
-	}
-	//body
-	err = dec.Decode(&j.body)
-	if err == io.EOF {
-		return nil
+		err = errors.Wrap(err, "Job: Failed to encode job for persistence")
+		log.Error().Err(err).Send()
+		return nil, err
 	}
-	return err
+	return data, nil
+}
+
+// Unmarshal decodes a job encoded by Marshal. Like GobDecode it reads jobs of any format
+func (j *Job) Unmarshal(data []byte) error {
+	return decodeJob(j, data)
 }
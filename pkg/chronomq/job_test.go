@@ -1,7 +1,9 @@
 package chronomq_test
 
 import (
+	"bytes"
 	"container/heap"
+	"encoding/gob"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -48,6 +50,45 @@ var _ = Describe("Test jobs", func() {
 				Expect(j.ID()).To(Equal(job.ID()))
 			}
 		})
+
+		It("orders jobs with the same trigger time by priority", func() {
+			t := time.Now()
+			jlow := NewJobAutoID(t, nil)
+			jlow.SetOpts(-1, 0)
+			jdefault := NewJobAutoID(t, nil)
+			jhigh := NewJobAutoID(t, nil)
+			jhigh.SetOpts(10, 0)
+			jlater := NewJobAutoID(t.Add(1), nil)
+			jlater.SetOpts(100, 0)
+			ordList := []*Job{jhigh, jdefault, jlow, jlater}
+
+			jobs := &PriorityQueue{jlater.AsPriorityItem(), jlow.AsPriorityItem(), jdefault.AsPriorityItem(), jhigh.AsPriorityItem()}
+			heap.Init(jobs)
+
+			for _, job := range ordList {
+				j := heap.Pop(jobs).(*Item).Value().(*Job)
+				Expect(j.ID()).To(Equal(job.ID()))
+			}
+		})
+
+		It("orders ready jobs by priority first", func() {
+			t := time.Now()
+			jlow := NewJobAutoID(t, nil)
+			jlow.SetOpts(-1, 0)
+			jearly := NewJobAutoID(t.Add(-time.Hour), nil)
+			jlate := NewJobAutoID(t.Add(-time.Second), nil)
+			jhigh := NewJobAutoID(t.Add(-time.Nanosecond), nil)
+			jhigh.SetOpts(10, 0)
+			ordList := []*Job{jhigh, jearly, jlate, jlow}
+
+			jobs := &ReadyQueue{PriorityQueue: PriorityQueue{jlow.AsPriorityItem(), jlate.AsPriorityItem(), jearly.AsPriorityItem(), jhigh.AsPriorityItem()}}
+			heap.Init(jobs)
+
+			for _, job := range ordList {
+				j := heap.Pop(jobs).(*Item).Value().(*Job)
+				Expect(j.ID()).To(Equal(job.ID()))
+			}
+		})
 	})
 
 	Context("Job serialization", func() {
@@ -65,6 +106,29 @@ var _ = Describe("Test jobs", func() {
 			Expect(j.TriggerAt().Unix()).To(Equal(jj.TriggerAt().Unix()))
 		})
 
+		It("serde headers and decodes jobs encoded without them", func() {
+			j := NewJob("headers", time.Now(), []byte("body"))
+			j.SetHeaders(map[string]string{"type": "email", "locale": "de"})
+			encoded, err := j.GobEncode()
+			Expect(err).To(BeNil())
+			jj := &Job{}
+			Expect(jj.GobDecode(encoded)).To(Succeed())
+			Expect(jj.Headers()).To(Equal(map[string]string{"type": "email", "locale": "de"}))
+
+			// Jobs persisted by older versions end after the body
+			buf := new(bytes.Buffer)
+			enc := gob.NewEncoder(buf)
+			for _, field := range []interface{}{"old", int32(3), time.Now().UnixNano(), time.Minute, []byte("old")} {
+				Expect(enc.Encode(field)).To(Succeed())
+			}
+			old := &Job{}
+			Expect(old.GobDecode(buf.Bytes())).To(Succeed())
+			Expect(old.ID()).To(Equal("old"))
+			Expect(old.Pri()).To(Equal(int32(3)))
+			Expect(old.TTR()).To(Equal(time.Minute))
+			Expect(old.Headers()).To(BeEmpty())
+		})
+
 		It("use a persister to save a job", func() {
 			j := NewJobAutoID(time.Now(), []byte("This is a test job"))
 			store, err := persistence.InMemStorage()
@@ -0,0 +1,152 @@
+package chronomq
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultQueue is the queue jobs go to when no queue name is given
+const DefaultQueue = "default"
+
+// ErrInvalidQueueName is returned for queue names that cannot be used to store the queue's data
+var ErrInvalidQueueName = errors.New("Queue names must be 1-128 letters, digits, '_', '-' or '.' and cannot start with '.'")
+
+// ErrUnknownQueue is returned when a queue does not exist and cannot be created
+var ErrUnknownQueue = errors.New("Queue does not exist")
+
+var queueNameRe = regexp.MustCompile(`^[a-zA-Z0-9_\-][a-zA-Z0-9_\-.]{0,127}$`)
+
+// ValidateQueueName checks that a queue name is safe to use in storage paths
+func ValidateQueueName(name string) error {
+	if !queueNameRe.MatchString(name) {
+		return ErrInvalidQueueName
+	}
+	return nil
+}
+
+// HubFactory creates the hub serving a named queue
+type HubFactory func(queue string) (*Hub, error)
+
+// QueueSet holds one hub per named queue. Hubs are created with the factory the first time
+// a job is put into their queue. It is safe to call methods on QueueSet from multiple goroutines
+type QueueSet struct {
+	hubs    map[string]*Hub
+	factory HubFactory
+	created chan struct{} // Closed and replaced whenever a queue is added. See Created
+	lock    *sync.RWMutex
+}
+
+// NewQueueSet creates an empty queue set. If factory is nil, only queues added with Add exist
+func NewQueueSet(factory HubFactory) *QueueSet {
+	return &QueueSet{
+		hubs:    make(map[string]*Hub),
+		factory: factory,
+		created: make(chan struct{}),
+		lock:    &sync.RWMutex{},
+	}
+}
+
+// Add registers an existing hub as the given queue
+func (qs *QueueSet) Add(queue string, h *Hub) error {
+	queue = queueName(queue)
+	if err := ValidateQueueName(queue); err != nil {
+		return err
+	}
+	qs.lock.Lock()
+	defer qs.lock.Unlock()
+	if _, ok := qs.hubs[queue]; ok {
+		return errors.Errorf("Queue %s already exists", queue)
+	}
+	qs.add(queue, h)
+	return nil
+}
+
+// Hub returns the hub of the given queue, creating it if needed. An empty name means the default queue
+func (qs *QueueSet) Hub(queue string) (*Hub, error) {
+	if h := qs.Lookup(queue); h != nil {
+		return h, nil
+	}
+	queue = queueName(queue)
+	if err := ValidateQueueName(queue); err != nil {
+		return nil, err
+	}
+
+	qs.lock.Lock()
+	defer qs.lock.Unlock()
+	// Another goroutine may have created it while the lock was released
+	if h, ok := qs.hubs[queue]; ok {
+		return h, nil
+	}
+	if qs.factory == nil {
+		return nil, ErrUnknownQueue
+	}
+	h, err := qs.factory(queue)
+	if err != nil {
+		return nil, errors.Wrapf(err, "QueueSet: Cannot create hub for queue %s", queue)
+	}
+	log.Info().Str("queue", queue).Msg("QueueSet: Created queue")
+	qs.add(queue, h)
+	return h, nil
+}
+
+// add registers the hub and wakes up everyone waiting for new queues. Lock the queue set before calling this
+func (qs *QueueSet) add(queue string, h *Hub) {
+	qs.hubs[queue] = h
+	close(qs.created)
+	qs.created = make(chan struct{})
+}
+
+// Created returns a channel that is closed once the next queue is added.
+// Take the channel before looking a queue up, otherwise a queue created in between is missed
+func (qs *QueueSet) Created() <-chan struct{} {
+	qs.lock.RLock()
+	defer qs.lock.RUnlock()
+	return qs.created
+}
+
+// Lookup returns the hub of the given queue or nil if the queue doesn't exist yet.
+// An empty name means the default queue
+func (qs *QueueSet) Lookup(queue string) *Hub {
+	qs.lock.RLock()
+	defer qs.lock.RUnlock()
+	return qs.hubs[queueName(queue)]
+}
+
+// Names returns the names of all existing queues in sorted order
+func (qs *QueueSet) Names() []string {
+	qs.lock.RLock()
+	defer qs.lock.RUnlock()
+	names := make([]string, 0, len(qs.hubs))
+	for name := range qs.hubs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stop stops the hubs of all queues. See Hub.Stop
+func (qs *QueueSet) Stop(persist bool) {
+	qs.lock.Lock()
+	defer qs.lock.Unlock()
+	wg := sync.WaitGroup{}
+	for name, h := range qs.hubs {
+		wg.Add(1)
+		go func(name string, h *Hub) {
+			defer wg.Done()
+			log.Info().Str("queue", name).Msg("QueueSet: Stopping queue")
+			h.Stop(persist)
+		}(name, h)
+	}
+	wg.Wait()
+}
+
+func queueName(queue string) string {
+	if queue == "" {
+		return DefaultQueue
+	}
+	return queue
+}
@@ -0,0 +1,75 @@
+package chronomq_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/chronomq/chronomq/pkg/chronomq"
+)
+
+var _ = Describe("Test queue set", func() {
+	newHub := func(queue string) (*Hub, error) {
+		return NewHub(&HubOpts{SpokeSpan: time.Second, Persister: persister, Queue: queue}), nil
+	}
+
+	It("validates queue names", func() {
+		for _, name := range []string{"default", "emails", "cart-abandonment_v2", "a.b"} {
+			Expect(ValidateQueueName(name)).To(Succeed(), name)
+		}
+		for _, name := range []string{"", ".hidden", "a/b", "../x", "white space", string(make([]byte, 129))} {
+			Expect(ValidateQueueName(name)).To(Equal(ErrInvalidQueueName), name)
+		}
+	})
+
+	It("creates hubs lazily and only once", func() {
+		created := 0
+		qs := NewQueueSet(func(queue string) (*Hub, error) {
+			created++
+			return newHub(queue)
+		})
+		defer qs.Stop(false)
+
+		Expect(qs.Lookup("emails")).To(BeNil())
+		h, err := qs.Hub("emails")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(h.Queue()).To(Equal("emails"))
+		Expect(qs.Hub("emails")).To(BeIdenticalTo(h))
+		Expect(qs.Lookup("emails")).To(BeIdenticalTo(h))
+
+		// An empty name is the default queue
+		d, err := qs.Hub("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.Queue()).To(Equal(DefaultQueue))
+		Expect(qs.Lookup(DefaultQueue)).To(BeIdenticalTo(d))
+
+		Expect(created).To(Equal(2))
+		Expect(qs.Names()).To(Equal([]string{DefaultQueue, "emails"}))
+
+		_, err = qs.Hub("bad/name")
+		Expect(err).To(Equal(ErrInvalidQueueName))
+	})
+
+	It("only serves added queues without a factory", func() {
+		qs := NewQueueSet(nil)
+		defer qs.Stop(false)
+		h, _ := newHub(DefaultQueue)
+		Expect(qs.Add("", h)).To(Succeed())
+		Expect(qs.Add(DefaultQueue, h)).ToNot(Succeed())
+		Expect(qs.Hub(DefaultQueue)).To(BeIdenticalTo(h))
+
+		_, err := qs.Hub("emails")
+		Expect(err).To(Equal(ErrUnknownQueue))
+	})
+
+	It("reports factory errors", func() {
+		qs := NewQueueSet(func(queue string) (*Hub, error) {
+			return nil, errors.New("no space left")
+		})
+		_, err := qs.Hub("emails")
+		Expect(err).To(MatchError(ContainSubstring("no space left")))
+		Expect(qs.Names()).To(BeEmpty())
+	})
+})
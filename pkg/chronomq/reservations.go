@@ -0,0 +1,102 @@
+package chronomq
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/chronomq/chronomq/internal/queue"
+)
+
+// reservations holds jobs that were handed out to consumers but haven't been acknowledged yet.
+// Reservations are ordered by their time-to-run deadline so that expired ones are found quickly.
+// It is not safe for concurrent use - Lock the hub before calling any of its methods
+type reservations struct {
+	jobMap    map[string]*queue.Item
+	deadlines queue.PriorityQueue
+}
+
+func newReservations() *reservations {
+	r := &reservations{
+		jobMap:    make(map[string]*queue.Item),
+		deadlines: queue.PriorityQueue{},
+	}
+	heap.Init(&r.deadlines)
+	return r
+}
+
+// add reserves job j till its time-to-run runs out
+func (r *reservations) add(j *Job) {
+	item := queue.NewItem(j, time.Now().Add(j.ttr))
+	r.jobMap[j.ID()] = item
+	heap.Push(&r.deadlines, item)
+}
+
+// remove deletes the reservation for the given job id and returns the job if it was reserved
+func (r *reservations) remove(id string) *Job {
+	item, ok := r.jobMap[id]
+	if !ok {
+		return nil
+	}
+	delete(r.jobMap, id)
+	heap.Remove(&r.deadlines, item.Index())
+	return item.Value().(*Job)
+}
+
+// touch restarts the time-to-run of a reserved job. Returns false if the job is not reserved
+func (r *reservations) touch(id string) bool {
+	j := r.remove(id)
+	if j == nil {
+		return false
+	}
+	r.add(j)
+	return true
+}
+
+// get returns the reserved job with the given id or nil
+func (r *reservations) get(id string) *Job {
+	item, ok := r.jobMap[id]
+	if !ok {
+		return nil
+	}
+	return item.Value().(*Job)
+}
+
+// owns returns true if a job by the given id is reserved
+func (r *reservations) owns(id string) bool {
+	_, ok := r.jobMap[id]
+	return ok
+}
+
+// expired removes and returns all reservations whose deadline is in the past
+func (r *reservations) expired() []*Job {
+	var jobs []*Job
+	now := time.Now()
+	for r.deadlines.Len() > 0 && r.deadlines.AtIdx(0).Priority().Before(now) {
+		j := heap.Pop(&r.deadlines).(*queue.Item).Value().(*Job)
+		delete(r.jobMap, j.ID())
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
+
+// nextDeadline returns the deadline of the reservation that expires first or false if no job is reserved
+func (r *reservations) nextDeadline() (time.Time, bool) {
+	if r.deadlines.Len() == 0 {
+		return time.Time{}, false
+	}
+	return r.deadlines.AtIdx(0).Priority(), true
+}
+
+// jobs returns all currently reserved jobs
+func (r *reservations) jobs() []*Job {
+	jobs := make([]*Job, 0, r.deadlines.Len())
+	for i := 0; i < r.deadlines.Len(); i++ {
+		jobs = append(jobs, r.deadlines.AtIdx(i).Value().(*Job))
+	}
+	return jobs
+}
+
+// len returns the number of reserved jobs
+func (r *reservations) len() int {
+	return r.deadlines.Len()
+}
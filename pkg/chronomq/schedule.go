@@ -0,0 +1,133 @@
+package chronomq
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronomq/chronomq/pkg/metrics"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+// ErrNoOccurrence is returned when a schedule ends before its first occurrence
+var ErrNoOccurrence = errors.New("Schedule has no occurrence before its end")
+
+// Schedule makes a job recur. After every occurrence is dequeued - or acknowledged if the job has a TTR -
+// the hub schedules the job again at the next occurrence
+type Schedule struct {
+	spec     string
+	location *time.Location
+	until    time.Time
+	cron     cron.Schedule
+}
+
+// NewSchedule parses a standard 5 field cron expression or a descriptor like @daily or @every 1h.
+// Occurrences are computed in the given IANA timezone, UTC if empty. The schedule ends after until unless it is zero
+func NewSchedule(spec string, timezone string, until time.Time) (*Schedule, error) {
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid cron expression %q", spec)
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid timezone %q", timezone)
+	}
+	return &Schedule{spec: spec, location: location, until: until, cron: sched}, nil
+}
+
+// Spec returns the cron expression of the schedule
+func (s *Schedule) Spec() string {
+	return s.spec
+}
+
+// Timezone returns the name of the timezone occurrences are computed in
+func (s *Schedule) Timezone() string {
+	return s.location.String()
+}
+
+// Until returns when the schedule ends or the zero time if it never ends
+func (s *Schedule) Until() time.Time {
+	return s.until
+}
+
+// Next returns the first occurrence after the given time. Returns false if the schedule ends before that
+func (s *Schedule) Next(after time.Time) (time.Time, bool) {
+	next := s.cron.Next(after.In(s.location))
+	if next.IsZero() || (!s.until.IsZero() && next.After(s.until)) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// SetSchedule makes the job recur on the given schedule. Its trigger time is moved to the first occurrence after it
+func (j *Job) SetSchedule(s *Schedule) error {
+	first, ok := s.Next(j.triggerAt)
+	if !ok {
+		return ErrNoOccurrence
+	}
+	j.schedule = s
+	j.triggerAt = first
+	return nil
+}
+
+// Schedule returns the schedule of a recurring job or nil
+func (j *Job) Schedule() *Schedule {
+	return j.schedule
+}
+
+// IsRecurring returns true if the job is scheduled again after it is consumed.
+// The occurrences of a recurring job handed out by the hub are copies - the hub holds on to the job itself
+func (j *Job) IsRecurring() bool {
+	return j.schedule != nil
+}
+
+// Occurrences returns the job's trigger time followed by its next occurrences, up to n times in total
+func (j *Job) Occurrences(n int) []time.Time {
+	if n < 1 {
+		return nil
+	}
+	occurrences := []time.Time{j.triggerAt}
+	for j.schedule != nil && len(occurrences) < n {
+		next, ok := j.schedule.Next(occurrences[len(occurrences)-1])
+		if !ok || j.isExpiredAt(next) {
+			break
+		}
+		occurrences = append(occurrences, next)
+	}
+	return occurrences
+}
+
+// recur schedules a recurring job again at its next occurrence once the current one is consumed.
+// Returns a copy of the consumed occurrence or nil if the job isn't recurring or has no occurrences left,
+// in which case the job stops recurring and has to be consumed. Lock the hub before calling this
+func (h *Hub) recur(j *Job) *Job {
+	if j.schedule == nil {
+		return nil
+	}
+	occurrence := *j
+
+	after := time.Now()
+	if j.triggerAt.After(after) {
+		after = j.triggerAt
+	}
+	// Occurrences missed while the job was pending or reserved are skipped
+	next, ok := j.schedule.Next(after)
+	if !ok || j.isExpiredAt(next) {
+		log.Debug().Str("jobID", j.ID()).Msg("Recurring job has no occurrences left")
+		j.schedule = nil
+		return nil
+	}
+	j.triggerAt = next
+	j.attempts = 0
+	if err := h.addJob(j); err != nil {
+		log.Error().Err(err).Str("jobID", j.ID()).Msg("Failed to schedule next occurrence of recurring job")
+		j.schedule = nil
+		return nil
+	}
+	h.journal(persistence.OpPut, j)
+	h.stats.IncrJob()
+	go metrics.Incr("hub.job.recur")
+	return &occurrence
+}
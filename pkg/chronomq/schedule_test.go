@@ -0,0 +1,144 @@
+package chronomq_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+var _ = Describe("Test recurring jobs", func() {
+	var p persistence.Persister
+
+	BeforeEach(func() {
+		store, err := persistence.InMemStorage()
+		Expect(err).NotTo(HaveOccurred())
+		p = persistence.NewJournalPersister(store)
+	})
+
+	It("computes occurrences in the schedule's timezone", func() {
+		s, err := NewSchedule("0 9 * * *", "America/New_York", time.Date(2030, 1, 3, 14, 0, 0, 0, time.UTC))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Timezone()).To(Equal("America/New_York"))
+
+		next, ok := s.Next(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+		Expect(ok).To(BeTrue())
+		Expect(next).To(BeTemporally("==", time.Date(2030, 1, 1, 14, 0, 0, 0, time.UTC)))
+		_, ok = s.Next(time.Date(2030, 1, 3, 14, 0, 0, 0, time.UTC))
+		Expect(ok).To(BeFalse())
+
+		j := NewJob("daily", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), nil)
+		Expect(j.SetSchedule(s)).To(Succeed())
+		Expect(j.IsRecurring()).To(BeTrue())
+		Expect(j.TriggerAt()).To(BeTemporally("==", next))
+		occurrences := j.Occurrences(5)
+		Expect(occurrences).To(HaveLen(3))
+		Expect(occurrences[2]).To(BeTemporally("==", time.Date(2030, 1, 3, 14, 0, 0, 0, time.UTC)))
+
+		utc, err := NewSchedule("@daily", "", time.Time{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utc.Timezone()).To(Equal("UTC"))
+		Expect(NewJob("once", time.Now(), nil).Occurrences(5)).To(HaveLen(1))
+	})
+
+	It("rejects invalid schedules", func() {
+		_, err := NewSchedule("every day", "", time.Time{})
+		Expect(err).To(HaveOccurred())
+		_, err = NewSchedule("@daily", "Mars/Olympus_Mons", time.Time{})
+		Expect(err).To(HaveOccurred())
+
+		s, err := NewSchedule("@daily", "", time.Now().Add(-time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		j := NewJob("ended", time.Now(), nil)
+		Expect(j.SetSchedule(s)).To(Equal(ErrNoOccurrence))
+		Expect(j.IsRecurring()).To(BeFalse())
+	})
+
+	It("schedules recurring jobs again after every dequeue", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+		defer h.Stop(false)
+
+		s, err := NewSchedule("@every 1s", "", time.Time{})
+		Expect(err).NotTo(HaveOccurred())
+		j := NewJob("tick", time.Now(), []byte("tick"))
+		Expect(j.SetSchedule(s)).To(Succeed())
+		Expect(h.AddJobLocked(j)).To(Succeed())
+		Expect(h.AddJobLocked(NewJob("tick", time.Now(), nil))).NotTo(Succeed())
+
+		var first *Job
+		Eventually(func() *Job { first = h.NextLocked(); return first }, 2).ShouldNot(BeNil())
+		Expect(first.ID()).To(Equal("tick"))
+		Expect(first.IsRecurring()).To(BeTrue())
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(1)))
+
+		var second *Job
+		Eventually(func() *Job { second = h.NextLocked(); return second }, 2).ShouldNot(BeNil())
+		Expect(second.TriggerAt()).To(BeTemporally("==", first.TriggerAt().Add(time.Second)))
+		Expect(string(second.Body())).To(Equal("tick"))
+
+		canceled, err := h.CancelJobLocked("tick")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(canceled).NotTo(BeNil())
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(0)))
+		Consistently(h.NextLocked, 1.2).Should(BeNil())
+	}, 8)
+
+	It("schedules reserved recurring jobs again once they are acknowledged", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+		defer h.Stop(false)
+
+		s, err := NewSchedule("@every 1s", "", time.Now().Add(time.Second*2))
+		Expect(err).NotTo(HaveOccurred())
+		j := NewJob("reserved", time.Now(), nil)
+		j.SetOpts(0, time.Minute)
+		Expect(j.SetSchedule(s)).To(Succeed())
+		Expect(h.AddJobLocked(j)).To(Succeed())
+
+		Eventually(h.NextLocked, 2).ShouldNot(BeNil())
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(0)))
+		occurrence, err := h.AckLocked("reserved")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(occurrence.IsRecurring()).To(BeTrue())
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(1)))
+
+		// The schedule ends after the next occurrence
+		Eventually(h.NextLocked, 2).ShouldNot(BeNil())
+		last, err := h.AckLocked("reserved")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(last.IsRecurring()).To(BeFalse())
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(0)))
+		Expect(h.AddJobLocked(NewJob("reserved", time.Now(), nil))).To(Succeed())
+	}, 8)
+
+	It("persists the schedule of recurring jobs", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+
+		until := time.Now().Add(time.Hour * 24 * 30)
+		s, err := NewSchedule("30 8 * * 1-5", "Europe/Berlin", until)
+		Expect(err).NotTo(HaveOccurred())
+		j := NewJob("weekdays", time.Now(), nil)
+		Expect(j.SetSchedule(s)).To(Succeed())
+		Expect(h.AddJobLocked(j)).To(Succeed())
+		h.Stop(true)
+
+		restored := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+		defer restored.Stop(false)
+		Expect(restored.Restore()).To(Succeed())
+		jobs := []*Job{}
+		for j := range restored.GetNJobs(1) {
+			jobs = append(jobs, j)
+		}
+		Expect(jobs).To(HaveLen(1))
+		Expect(jobs[0].Schedule().Spec()).To(Equal("30 8 * * 1-5"))
+		Expect(jobs[0].Schedule().Timezone()).To(Equal("Europe/Berlin"))
+		Expect(jobs[0].Schedule().Until()).To(BeTemporally("==", until))
+		Expect(jobs[0].TriggerAt()).To(BeTemporally("==", j.TriggerAt()))
+		Expect(jobs[0].Occurrences(3)[2]).To(BeTemporally("==", j.Occurrences(3)[2]))
+	}, 5)
+})
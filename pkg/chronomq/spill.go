@@ -0,0 +1,283 @@
+package chronomq
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	cuckoo "github.com/seiflotfy/cuckoofilter"
+
+	"github.com/chronomq/chronomq/internal/queue"
+	"github.com/chronomq/chronomq/internal/temporal"
+	"github.com/chronomq/chronomq/pkg/metrics"
+)
+
+// DefaultSpillInterval is how often spokes are spilled and paged back in, unless the spill horizon is shorter than twice that
+const DefaultSpillInterval = time.Minute
+
+// spilledSpoke is a future spoke whose jobs were offloaded to the hub's spill store. Only filters of the ids
+// of its jobs are kept in memory, so that a job looked up by id is paged back in along with its spoke
+type spilledSpoke struct {
+	temporal.Bound
+	segments []spillSegment // Every spill of the spoke adds a segment
+}
+
+type spillSegment struct {
+	key         string
+	ids         *cuckoo.Filter
+	count       int
+	first, last string // Lowest and highest id of the segment's jobs
+}
+
+// owns returns true if the spoke may hold the job with the given id
+func (ss *spilledSpoke) owns(id []byte) bool {
+	for _, seg := range ss.segments {
+		if seg.ids.Lookup(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ss *spilledSpoke) count() int {
+	n := 0
+	for _, seg := range ss.segments {
+		n += seg.count
+	}
+	return n
+}
+
+// SpillLocked offloads the jobs of spokes that start later than the spill horizon from now to the spill store
+// and pages spilled spokes that came within the horizon back in. The hub is locked while the jobs are written
+// and read. Returns the number of jobs spilled and paged in. Noop if the hub has no spill store
+func (h *Hub) SpillLocked() (int, int, error) {
+	if h.spill == nil {
+		return 0, 0, nil
+	}
+	// Segments of spokes paged in since the last pass may still be read by a snapshot. No snapshot runs while
+	// this pass holds the snapshot lock, so they are deleted now
+	h.snapshotLock.Lock()
+	defer h.snapshotLock.Unlock()
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var firstErr error
+	fail := func(err error) {
+		log.Error().Err(err).Str("queue", h.queue).Msg("Hub:spill")
+		go metrics.Incr("hub.spill.error")
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, key := range h.spillGarbage {
+		if err := h.spill.Delete(key); err != nil {
+			fail(err)
+		}
+	}
+	h.spillGarbage = nil
+
+	horizon := time.Now().Add(h.spillHorizon)
+	pagedIn := 0
+	for _, ss := range h.spilled {
+		if ss.Start().After(horizon) {
+			continue
+		}
+		n, err := h.pageIn(ss)
+		if err != nil {
+			fail(err)
+		}
+		pagedIn += n
+	}
+
+	spilled := 0
+	for _, s := range h.spokeMap {
+		if s == h.currentSpoke || !s.Start().After(horizon) {
+			continue
+		}
+		n, err := h.spillSpoke(s)
+		if err != nil {
+			fail(err)
+		}
+		spilled += n
+	}
+	if spilled > 0 {
+		// Spilled spokes left the map, drop them from the spoke order as well
+		spokes := queue.PriorityQueue{}
+		for i := 0; i < h.spokes.Len(); i++ {
+			item := h.spokes.AtIdx(i)
+			if s := item.Value().(*Spoke); h.spokeMap[s.Bound] == s {
+				spokes = append(spokes, item)
+			}
+		}
+		heap.Init(&spokes)
+		h.spokes = &spokes
+	}
+
+	go metrics.GaugeInt("hub.job.spilled.count", int(h.stats.Read().SpilledJobs))
+	return spilled, pagedIn, firstErr
+}
+
+// spillSpoke writes the jobs of a spoke to a new segment and removes the spoke. Lock the hub before calling this
+func (h *Hub) spillSpoke(s *Spoke) (int, error) {
+	jobs := s.JobsLocked(func(j *Job) bool { return true })
+	if len(jobs) == 0 {
+		return 0, nil
+	}
+	// Twice the size keeps inserts from failing. A failed insert may have evicted another id, so the
+	// spoke is kept in memory then
+	ids := cuckoo.NewFilter(uint(len(jobs) * 2))
+	data := make([][]byte, 0, len(jobs))
+	first, last := jobs[0].ID(), jobs[0].ID()
+	for _, j := range jobs {
+		if j.ID() < first {
+			first = j.ID()
+		}
+		if j.ID() > last {
+			last = j.ID()
+		}
+		if !ids.Insert([]byte(j.ID())) {
+			return 0, fmt.Errorf("Cannot spill spoke starting at %s. Job id filter is full", s.Start())
+		}
+		d, err := h.codec.Encode(j)
+		if err != nil {
+			return 0, err
+		}
+		data = append(data, d)
+	}
+
+	h.spillSeq++
+	key := fmt.Sprintf("%d.%d", s.Start().UnixNano(), h.spillSeq)
+	if err := h.spill.Write(key, data); err != nil {
+		return 0, err
+	}
+	ss, ok := h.spilled[s.Bound]
+	if !ok {
+		ss = &spilledSpoke{Bound: s.Bound}
+		h.spilled[s.Bound] = ss
+	}
+	ss.segments = append(ss.segments, spillSegment{key: key, ids: ids, count: len(jobs), first: first, last: last})
+	h.deleteSpokeFromMap(s)
+	h.stats.AddSpilled(int64(len(jobs)))
+	if h.onSpilled != nil {
+		for _, j := range jobs {
+			h.onSpilled(j)
+		}
+	}
+	go metrics.Count("hub.job.spilled", len(jobs))
+	return len(jobs), nil
+}
+
+// pageIn reads the jobs of a spilled spoke back into memory. Its segments are deleted by the next spill pass,
+// a snapshot that started before may still be reading them. Lock the hub before calling this
+func (h *Hub) pageIn(ss *spilledSpoke) (int, error) {
+	var jobs []*Job
+	for _, seg := range ss.segments {
+		js, err := h.readSegment(seg.key)
+		if err != nil {
+			// Try again with the next pass or lookup
+			return 0, err
+		}
+		jobs = append(jobs, js...)
+	}
+
+	delete(h.spilled, ss.Bound)
+	for _, seg := range ss.segments {
+		h.spillGarbage = append(h.spillGarbage, seg.key)
+	}
+	h.stats.AddSpilled(-int64(ss.count()))
+	for _, j := range jobs {
+		if err := h.addJob(j); err != nil {
+			log.Error().Err(err).Str("jobID", j.ID()).Msg("Failed to page in spilled job")
+			h.forget(j)
+			h.stats.DecrJob()
+			continue
+		}
+		if h.onPagedIn != nil {
+			h.onPagedIn(j)
+		}
+	}
+	go metrics.Count("hub.job.pagedin", len(jobs))
+	return len(jobs), nil
+}
+
+// pageInJob pages in the spilled spokes that may hold the job with the given id. Returns true if any spoke
+// was paged in. Lock the hub before calling this
+func (h *Hub) pageInJob(jobID string) bool {
+	id := []byte(jobID)
+	pagedIn := false
+	for _, ss := range h.spilled {
+		if !ss.owns(id) {
+			continue
+		}
+		if _, err := h.pageIn(ss); err != nil {
+			log.Error().Err(err).Str("jobID", jobID).Msg("Failed to page in spoke of job")
+			continue
+		}
+		pagedIn = true
+	}
+	return pagedIn
+}
+
+// readSegment reads the jobs of a spill segment. Jobs that cannot be decoded are logged and skipped
+func (h *Hub) readSegment(key string) ([]*Job, error) {
+	data, err := h.spill.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(data))
+	for _, d := range data {
+		j := new(Job)
+		if err := h.codec.Decode(d, j); err != nil {
+			log.Error().Err(err).Str("segment", key).Msg("Failed to decode spilled job")
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// spilledJobs reads the jobs of all spilled spokes without paging them in. Lock the hub before calling this
+func (h *Hub) spilledJobs() []*Job {
+	var jobs []*Job
+	for _, key := range h.spilledSegments() {
+		js, err := h.readSegment(key)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read spilled jobs")
+			continue
+		}
+		jobs = append(jobs, js...)
+	}
+	return jobs
+}
+
+// spilledSegments returns the keys of the segments of all spilled spokes. Lock the hub before calling this
+func (h *Hub) spilledSegments() []string {
+	var keys []string
+	for _, ss := range h.spilled {
+		for _, seg := range ss.segments {
+			keys = append(keys, seg.key)
+		}
+	}
+	return keys
+}
+
+// spiller spills and pages in spokes at every interval till the hub is stopped
+func (h *Hub) spiller(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-t.C:
+			spilled, pagedIn, err := h.SpillLocked()
+			if err != nil {
+				log.Error().Err(err).Msg("Hub:spiller")
+			}
+			if spilled > 0 || pagedIn > 0 {
+				log.Info().Str("queue", h.queue).Int("spilled", spilled).Int("pagedIn", pagedIn).Msg("Hub:spiller moved jobs")
+			}
+		}
+	}
+}
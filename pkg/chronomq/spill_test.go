@@ -0,0 +1,162 @@
+package chronomq_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+var _ = Describe("Test spilling far-future jobs", func() {
+	var p persistence.Persister
+	var spill persistence.SpillStore
+	var spilled, pagedIn []string
+	var h *Hub
+
+	BeforeEach(func() {
+		store, err := persistence.InMemStorage()
+		Expect(err).NotTo(HaveOccurred())
+		p = persistence.NewJournalPersister(store)
+		spill, err = persistence.InMemSpillStore()
+		Expect(err).NotTo(HaveOccurred())
+		spilled, pagedIn = nil, nil
+		h = NewHub(&HubOpts{
+			SpokeSpan:     time.Millisecond * 100,
+			Persister:     p,
+			Spill:         spill,
+			SpillHorizon:  time.Second,
+			SpillInterval: time.Hour, // Passes are run by the specs
+			OnSpilled:     func(j *Job) { spilled = append(spilled, j.ID()) },
+			OnPagedIn:     func(j *Job) { pagedIn = append(pagedIn, j.ID()) },
+		})
+	})
+
+	AfterEach(func() {
+		h.Stop(false)
+	})
+
+	add := func(id string, at time.Time) {
+		j := NewJob(id, at, []byte(id))
+		j.SetTags("t-" + id)
+		Expect(h.AddJobLocked(j)).To(Succeed())
+	}
+
+	It("offloads spokes beyond the horizon and pages them in as they approach", func() {
+		add("near", time.Now().Add(time.Millisecond*100))
+		add("far", time.Now().Add(time.Millisecond*1500))
+		add("later", time.Now().Add(time.Hour))
+
+		n, in, err := h.SpillLocked()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(2))
+		Expect(in).To(BeZero())
+		Expect(spilled).To(ConsistOf("far", "later"))
+		Expect(h.Stats().SpilledJobs).To(Equal(int64(2)))
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(3)))
+
+		Eventually(func() int {
+			_, in, err := h.SpillLocked()
+			Expect(err).NotTo(HaveOccurred())
+			return in
+		}, 2).Should(Equal(1))
+		Expect(pagedIn).To(Equal([]string{"far"}))
+		Expect(h.Stats().SpilledJobs).To(Equal(int64(1)))
+
+		for _, id := range []string{"near", "far"} {
+			var j *Job
+			Eventually(func() *Job { j = h.NextLocked(); return j }, 2).ShouldNot(BeNil())
+			Expect(j.ID()).To(Equal(id))
+			Expect(j.Body()).To(Equal([]byte(id)))
+			Expect(j.Tags()).To(Equal([]string{"t-" + id}))
+		}
+		Expect(h.NextLocked()).To(BeNil())
+	})
+
+	It("returns pending jobs in pages of ids from memory and spilled spokes", func() {
+		add("b", time.Now().Add(time.Hour))
+		add("d", time.Now().Add(time.Hour*2))
+		n, _, err := h.SpillLocked()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(2))
+		add("a", time.Now().Add(time.Minute))
+		add("c", time.Now().Add(time.Hour))
+		add("e", time.Now().Add(time.Minute))
+
+		all := func(j *Job) bool { return true }
+		page := func(after string, n int) []string {
+			ids := []string{}
+			for _, j := range h.PendingJobsLocked(after, all, n) {
+				ids = append(ids, j.ID())
+			}
+			return ids
+		}
+		Expect(page("", 2)).To(Equal([]string{"a", "b"}))
+		Expect(page("b", 2)).To(Equal([]string{"c", "d"}))
+		Expect(page("d", 2)).To(Equal([]string{"e"}))
+		Expect(page("e", 2)).To(BeEmpty())
+		Expect(h.PendingJobsLocked("", func(j *Job) bool { return j.ID() != "b" }, 2)).To(HaveLen(2))
+		Expect(h.Stats().SpilledJobs).To(Equal(int64(2)))
+	})
+
+	It("pages in spilled jobs looked up by id", func() {
+		later := time.Now().Add(time.Hour)
+		add("a", later)
+		add("b", later)
+		add("c", later.Add(time.Minute))
+		add("d", later.Add(time.Minute*2))
+		add("e", later.Add(time.Minute*3))
+		n, _, err := h.SpillLocked()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(5))
+
+		// Only the spoke of a is paged in
+		Expect(h.AddJobLocked(NewJob("a", later, nil))).To(MatchError(ContainSubstring(ErrJobExists.Error())))
+		Expect(pagedIn).To(ConsistOf("a", "b"))
+		Expect(h.Stats().SpilledJobs).To(Equal(int64(3)))
+
+		j, state, err := h.GetJobLocked("c")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(JobPending))
+		Expect(j.Body()).To(Equal([]byte("c")))
+		Expect(h.RescheduleLocked("d", time.Now())).To(Succeed())
+		Eventually(func() *Job { return h.NextLocked() }, 2).ShouldNot(BeNil())
+		Expect(h.CancelByTagLocked("t-e")).To(HaveLen(1))
+		Expect(h.Stats().SpilledJobs).To(BeZero())
+
+		n, _, err = h.SpillLocked()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(h.CancelByPrefixLocked("")).To(BeEmpty())
+		canceled := h.CancelByPrefixLocked("b")
+		Expect(canceled).To(HaveLen(1))
+		Expect(canceled[0].ID()).To(Equal("b"))
+		j, err = h.CancelJobLocked("a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.ID()).To(Equal("a"))
+		Expect(h.PendingJobsLocked("", func(j *Job) bool { return true }, 10)).To(HaveLen(1))
+		Expect(h.JobsLocked()).To(HaveLen(1))
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(1)))
+	})
+
+	It("persists spilled jobs in snapshots", func() {
+		add("near", time.Now().Add(time.Millisecond*500))
+		add("later", time.Now().Add(time.Hour))
+		n, _, err := h.SpillLocked()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+		for err := range h.Snapshot() {
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		restored := NewHub(&HubOpts{SpokeSpan: time.Millisecond * 100, Persister: p})
+		defer restored.Stop(false)
+		Expect(restored.Restore()).To(Succeed())
+		for _, id := range []string{"near", "later"} {
+			_, _, err := restored.GetJobLocked(id)
+			Expect(err).NotTo(HaveOccurred(), id)
+		}
+	})
+})
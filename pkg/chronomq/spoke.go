@@ -4,6 +4,7 @@ import (
 	"container/heap"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,7 +21,7 @@ type Spoke struct {
 	id uuid.UUID
 	temporal.Bound
 	jobMap   map[string]*queue.Item // Provides quicker lookup of jobs owned by this spoke
-	jobQueue queue.PriorityQueue    // Orders the jobs by trigger priority
+	jobQueue queue.Queue            // Orders the jobs by trigger priority
 
 	lock *sync.Mutex
 }
@@ -40,8 +41,17 @@ func NewSpokeFromNow(duration time.Duration) *Spoke {
 
 // NewSpoke creates a new spoke to hold jobs
 func NewSpoke(start, end time.Time) *Spoke {
-	jq := queue.PriorityQueue{}
-	heap.Init(&jq)
+	return newSpokeWithQueue(start, end, &queue.PriorityQueue{})
+}
+
+// newPastSpoke creates a spoke to hold jobs that are already ready. Since all of its jobs
+// can be dequeued right away, they are ordered by job priority before trigger time
+func newPastSpoke(start, end time.Time) *Spoke {
+	return newSpokeWithQueue(start, end, &queue.ReadyQueue{})
+}
+
+func newSpokeWithQueue(start, end time.Time, jq queue.Queue) *Spoke {
+	heap.Init(jq)
 	return &Spoke{id: uuid.NewV4(),
 		jobMap:   make(map[string]*queue.Item),
 		jobQueue: jq,
@@ -97,7 +107,7 @@ func (s *Spoke) AddJobLocked(j *Job) error {
 
 	item := j.AsPriorityItem()
 	s.jobMap[j.ID()] = item
-	heap.Push(&s.jobQueue, item)
+	heap.Push(s.jobQueue, item)
 	return nil
 }
 
@@ -120,13 +130,35 @@ func (s *Spoke) NextLocked() *Job {
 	case temporal.Past, temporal.Current:
 		// pop from queue
 		delete(s.jobMap, j.ID())
-		heap.Pop(&s.jobQueue)
+		heap.Pop(s.jobQueue)
 		return j
 	default:
 		return nil
 	}
 }
 
+// NextTriggerAfterLocked returns the earliest trigger time of the spoke's jobs that is after the given time or false
+// if there is none. Only the job that is dequeued next is looked at unless it triggers at or before that time
+func (s *Spoke) NextTriggerAfterLocked(after time.Time) (time.Time, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.jobQueue.Len() == 0 {
+		return time.Time{}, false
+	}
+	if at := s.JobAtIdx(0).TriggerAt(); at.After(after) {
+		return at, true
+	}
+	// Ready jobs that weren't taken yet hide the later ones behind them
+	var next time.Time
+	for _, item := range s.jobMap {
+		if at := item.Value().(*Job).TriggerAt(); at.After(after) && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next, !next.IsZero()
+}
+
 // CancelJobLocked will try to delete a job that hasn't been consumed yet
 func (s *Spoke) CancelJobLocked(id string) (*Job, error) {
 	s.lock.Lock()
@@ -134,13 +166,52 @@ func (s *Spoke) CancelJobLocked(id string) (*Job, error) {
 
 	if item, ok := s.jobMap[id]; ok {
 		delete(s.jobMap, id)
-		heap.Remove(&s.jobQueue, item.Index())
+		heap.Remove(s.jobQueue, item.Index())
 		return item.Value().(*Job), nil
 	}
 
 	return nil, fmt.Errorf("Cannot find job")
 }
 
+// GetJobLocked returns the job with the given id if it is owned by this spoke or nil
+func (s *Spoke) GetJobLocked(id string) *Job {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if item, ok := s.jobMap[id]; ok {
+		return item.Value().(*Job)
+	}
+	return nil
+}
+
+// IDsWithPrefixLocked returns the ids of the jobs of this spoke that start with the given prefix
+func (s *Spoke) IDsWithPrefixLocked(prefix string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var ids []string
+	for id := range s.jobMap {
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// JobsLocked returns the jobs of this spoke that match
+func (s *Spoke) JobsLocked(match func(j *Job) bool) []*Job {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var jobs []*Job
+	for _, item := range s.jobMap {
+		if j := item.Value().(*Job); match(j) {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs
+}
+
 // OwnsJobLocked returns true if a job by given id is owned by this spoke
 func (s *Spoke) OwnsJobLocked(id string) bool {
 	s.lock.Lock()
@@ -0,0 +1,156 @@
+package chronomq
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronomq/chronomq/pkg/metrics"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+// Hubs with a job store keep their pending jobs in the store instead of spokes. Reserved and dead-lettered jobs,
+// the id filter and the tag index stay in memory. Every job is stored under its id through the hub's journal,
+// the pending index of the store replaces the spokes
+
+// storedJob returns the job with the given id from the store or nil if it isn't stored. Lock the hub before calling this
+func (h *Hub) storedJob(jobID string) *Job {
+	data, err := h.store.Get(jobID)
+	if err != nil {
+		log.Error().Err(err).Str("jobID", jobID).Msg("Failed to read stored job")
+		return nil
+	}
+	if data == nil {
+		return nil
+	}
+	j := new(Job)
+	if err := h.codec.Decode(data, j); err != nil {
+		log.Error().Err(err).Str("jobID", jobID).Msg("Failed to decode stored job")
+		return nil
+	}
+	return j
+}
+
+// storedPendingJob returns the pending job with the given id from the store or nil. Lock the hub before calling this
+func (h *Hub) storedPendingJob(jobID string) *Job {
+	if h.reserved.owns(jobID) || h.dead.get(jobID) != nil {
+		return nil
+	}
+	return h.storedJob(jobID)
+}
+
+// unscheduleStored removes a pending job from the store's pending index and returns it or nil if the job
+// isn't pending. The job stays stored till its removal is journaled. Lock the hub before calling this
+func (h *Hub) unscheduleStored(jobID string) (*Job, error) {
+	j := h.storedPendingJob(jobID)
+	if j == nil {
+		return nil, nil
+	}
+	if err := h.store.Unschedule(jobID, j.TriggerAt(), j.Pri()); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// nextStored dequeues the ready stored job of the highest priority, like the past spoke does with ready jobs.
+// Lock the hub before calling this
+func (h *Hub) nextStored() *Job {
+	for {
+		id, at, pri, ok, err := h.store.Ready(time.Now())
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read next stored job")
+			return nil
+		}
+		if !ok {
+			return nil
+		}
+		if err := h.store.Unschedule(id, at, pri); err != nil {
+			log.Error().Err(err).Str("jobID", id).Msg("Failed to dequeue stored job")
+			return nil
+		}
+		if j := h.storedJob(id); j != nil {
+			h.stats.DecrJob()
+			return j
+		}
+		// The job is gone, only its index entry was left
+		log.Error().Str("jobID", id).Msg("Dropped pending index entry of missing job")
+	}
+}
+
+// storedJobs reads the pending jobs of the store that match in the order they are taken. Returns nil if the hub has no store.
+// Lock the hub before calling this
+func (h *Hub) storedJobs(match func(j *Job) bool) []*Job {
+	if h.store == nil {
+		return nil
+	}
+	var jobs []*Job
+	err := h.store.Pending(func(data []byte) bool {
+		j := new(Job)
+		if err := h.codec.Decode(data, j); err != nil {
+			log.Error().Err(err).Msg("Failed to decode stored job")
+			return true
+		}
+		if match(j) {
+			jobs = append(jobs, j)
+		}
+		return true
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read stored jobs")
+	}
+	return jobs
+}
+
+// recover indexes the jobs of the hub's store again, e.g. after a crash. Reserved jobs are pending again
+// and dead-lettered jobs go back to the dead-letter store
+func (h *Hub) recover() error {
+	start := time.Now()
+	records, err := h.store.Recover()
+	if err != nil {
+		return err
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	errDecodeCount := 0
+	errAddCount := 0
+	recoverCount := 0
+	expiredCount := 0
+	for r := range records {
+		j := new(Job)
+		if err := h.codec.Decode(r.Data, j); err != nil {
+			errDecodeCount++
+			log.Error().Err(err).Str("jobID", r.ID).Send()
+			continue
+		}
+		// Jobs that expired while the hub was down are not worth delivering anymore
+		if j.deadAt.IsZero() && j.IsExpired() {
+			expiredCount++
+			h.stats.IncrExpired()
+			if err := h.store.Append(persistence.OpConsume, j.ID(), nil); err != nil {
+				log.Error().Err(err).Send()
+			}
+			continue
+		}
+		if !j.deadAt.IsZero() {
+			h.dead.add(j)
+			h.jobFilter.Insert([]byte(j.ID()))
+			h.tags.add(j)
+			h.stats.IncrDead()
+		} else if err := h.insert(j); err != nil {
+			errAddCount++
+			log.Error().Err(err).Send()
+			continue
+		}
+		recoverCount++
+	}
+	go metrics.Time("hub.store.recover.duration", start)
+	log.Info().Int("recoverCount", recoverCount).Int("expiredCount", expiredCount).
+		Dur("duration", time.Since(start)).Msg("Hub:recover recovered stored jobs")
+
+	if errAddCount == 0 && errDecodeCount == 0 {
+		return nil
+	}
+	return errors.Errorf("Hub:recover encountered %d errors decoding and %d errors adding stored jobs", errDecodeCount, errAddCount)
+}
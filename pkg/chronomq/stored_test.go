@@ -0,0 +1,185 @@
+package chronomq_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	. "github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+var _ = Describe("Test hubs keeping jobs in a job store", func() {
+	var dir string
+	var h *Hub
+
+	open := func() *Hub {
+		store, err := persistence.NewJobStore(persistence.JobStoreConfig{Dir: dir})
+		Expect(err).NotTo(HaveOccurred())
+		p, err := persistence.InMemStorage()
+		Expect(err).NotTo(HaveOccurred())
+		return NewHub(&HubOpts{
+			SpokeSpan: time.Millisecond * 100,
+			Persister: persistence.NewJournalPersister(p),
+			Store:     store,
+			Backoff:   BackoffPolicy{MaxAttempts: 1},
+		})
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "chronomq-jobstore")
+		Expect(err).NotTo(HaveOccurred())
+		h = open()
+	})
+
+	AfterEach(func() {
+		h.Stop(false)
+		os.RemoveAll(dir)
+	})
+
+	add := func(id string, at time.Time) {
+		j := NewJob(id, at, []byte(id))
+		j.SetTags("t-" + id)
+		j.SetOpts(0, time.Minute)
+		Expect(h.AddJobLocked(j)).To(Succeed())
+	}
+
+	next := func() *Job {
+		var j *Job
+		Eventually(func() *Job { j = h.NextLocked(); return j }, 2).ShouldNot(BeNil())
+		return j
+	}
+
+	It("hands out stored jobs in trigger order", func() {
+		now := time.Now()
+		add("c", now.Add(time.Millisecond*300))
+		add("a", now.Add(time.Millisecond*100))
+		add("b", now.Add(time.Millisecond*200))
+		Expect(errors.Cause(h.AddJobLocked(NewJob("a", now, nil)))).To(Equal(ErrJobExists))
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(3)))
+
+		var ids []string
+		for j := range h.GetNJobs(2) {
+			ids = append(ids, j.ID())
+		}
+		Expect(ids).To(Equal([]string{"a", "b"}))
+
+		for _, id := range []string{"a", "b", "c"} {
+			j := next()
+			Expect(j.ID()).To(Equal(id))
+			Expect(j.Body()).To(Equal([]byte(id)))
+			Expect(j.Tags()).To(Equal([]string{"t-" + id}))
+		}
+		Expect(h.NextLocked()).To(BeNil())
+		Expect(h.Stats().CurrentJobs).To(BeZero())
+	})
+
+	It("cancels, looks up and reschedules stored jobs", func() {
+		later := time.Now().Add(time.Hour)
+		add("a-1", later)
+		add("a-2", later)
+		add("b", later)
+		add("c", later)
+
+		j, state, err := h.GetJobLocked("b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(JobPending))
+		Expect(j.Body()).To(Equal([]byte("b")))
+
+		canceled, err := h.CancelJobLocked("b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(canceled.ID()).To(Equal("b"))
+		_, _, err = h.GetJobLocked("b")
+		Expect(err).To(HaveOccurred())
+
+		Expect(h.CancelByPrefixLocked("a-")).To(HaveLen(2))
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(1)))
+
+		Expect(h.RescheduleLocked("c", time.Now())).To(Succeed())
+		Expect(next().ID()).To(Equal("c"))
+	})
+
+	It("wakes up waiters for stored jobs in turn", func(done Done) {
+		defer close(done)
+		soon := time.Now().Add(time.Millisecond * 150)
+		later := soon.Add(time.Millisecond * 150)
+		add("later", later)
+		add("soon", soon)
+
+		for _, id := range []string{"soon", "later"} {
+			ready := h.Ready()
+			Eventually(ready, time.Millisecond*300).Should(BeClosed())
+			j := h.NextLocked()
+			Expect(j).NotTo(BeNil())
+			Expect(j.ID()).To(Equal(id))
+		}
+	}, 2)
+
+	It("hands out ready stored jobs in priority order like the past spoke", func() {
+		past := time.Now().Add(-time.Minute)
+		pris := map[string]int32{"low": 0, "high": 2, "mid": 1}
+		for i, id := range []string{"low", "high", "mid"} {
+			j := NewJob(id, past.Add(time.Duration(i)*time.Second), []byte(id))
+			j.SetOpts(pris[id], time.Minute)
+			Expect(h.AddJobLocked(j)).To(Succeed())
+		}
+
+		for _, id := range []string{"high", "mid", "low"} {
+			Expect(next().ID()).To(Equal(id))
+		}
+		Expect(h.NextLocked()).To(BeNil())
+	})
+
+	It("recovers jobs from the store when it is opened again", func() {
+		now := time.Now()
+		for _, id := range []string{"acked", "reserved", "dead"} {
+			add(id, now)
+		}
+		add("canceled", now.Add(time.Hour))
+		add("pending", now.Add(time.Hour))
+
+		reserved := map[string]bool{}
+		for len(reserved) < 3 {
+			reserved[next().ID()] = true
+		}
+		Expect(h.CancelJobLocked("canceled")).NotTo(BeNil())
+		_, err := h.AckLocked("acked")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(h.NackLocked("dead")).To(BeTrue())
+
+		h.Stop(false)
+		h = open()
+
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(2)))
+		Expect(h.Stats().DeadJobs).To(Equal(int64(1)))
+		_, state, err := h.GetJobLocked("reserved")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(JobPending))
+		_, state, err = h.GetJobLocked("dead")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(JobDead))
+		for _, id := range []string{"acked", "canceled"} {
+			_, _, err = h.GetJobLocked(id)
+			Expect(err).To(HaveOccurred())
+		}
+		all := func(j *Job) bool { return true }
+		Expect(h.PendingJobsLocked("", all, 10)).To(HaveLen(2))
+		jobs := h.PendingJobsLocked("", all, 1)
+		Expect(jobs).To(HaveLen(1))
+		Expect(jobs[0].ID()).To(Equal("pending"))
+		jobs = h.PendingJobsLocked("pending", all, 1)
+		Expect(jobs).To(HaveLen(1))
+		Expect(jobs[0].ID()).To(Equal("reserved"))
+		Expect(h.PendingJobsLocked("reserved", all, 1)).To(BeEmpty())
+
+		Expect(next().ID()).To(Equal("reserved"))
+		Expect(h.NextLocked()).To(BeNil())
+		Expect(h.CancelByTagLocked("t-pending")).To(HaveLen(1))
+		Expect(h.Stats().CurrentJobs).To(BeZero())
+	})
+})
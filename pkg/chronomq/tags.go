@@ -0,0 +1,140 @@
+package chronomq
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronomq/chronomq/pkg/metrics"
+)
+
+// SetTags labels the job with the given tags, e.g. the id of the user the job belongs to.
+// Empty and repeated tags are ignored
+func (j *Job) SetTags(tags ...string) {
+	j.tags = nil
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		j.tags = append(j.tags, tag)
+	}
+}
+
+// Tags returns the tags of the job
+func (j *Job) Tags() []string {
+	return j.tags
+}
+
+// tagIndex maps tags to the ids of the jobs with that tag. It holds pending, reserved and dead-lettered jobs.
+// It is not safe for concurrent use - Lock the hub before calling any of its methods
+type tagIndex map[string]map[string]struct{}
+
+func (t tagIndex) add(j *Job) {
+	for _, tag := range j.tags {
+		ids, ok := t[tag]
+		if !ok {
+			ids = make(map[string]struct{})
+			t[tag] = ids
+		}
+		ids[j.ID()] = struct{}{}
+	}
+}
+
+func (t tagIndex) remove(j *Job) {
+	for _, tag := range j.tags {
+		ids := t[tag]
+		delete(ids, j.ID())
+		if len(ids) == 0 {
+			delete(t, tag)
+		}
+	}
+}
+
+// ids returns the ids of the jobs with the given tag in order
+func (t tagIndex) ids(tag string) []string {
+	ids := make([]string, 0, len(t[tag]))
+	for id := range t[tag] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// forget removes a job that left the hub from the id filter and the tag index. Lock the hub before calling this
+func (h *Hub) forget(j *Job) {
+	h.jobFilter.Delete([]byte(j.ID()))
+	h.tags.remove(j)
+}
+
+// CancelByTagLocked cancels all pending, reserved and dead-lettered jobs with the given tag.
+// Returns the canceled jobs
+func (h *Hub) CancelByTagLocked(tag string) []*Job {
+	defer metrics.Time("hub.cancel.tag.duration", time.Now())
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.cancelAll(h.tags.ids(tag))
+}
+
+// CancelByPrefixLocked cancels all pending, reserved and dead-lettered jobs whose id starts with the given prefix.
+// Unlike tags, this looks at every job of the hub. Nothing is canceled for an empty prefix. Returns the canceled jobs
+func (h *Hub) CancelByPrefixLocked(prefix string) []*Job {
+	defer metrics.Time("hub.cancel.prefix.duration", time.Now())
+	if prefix == "" {
+		return nil
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.cancelAll(h.idsWithPrefix(prefix))
+}
+
+// cancelAll cancels the jobs with the given ids and returns the ones that were found. Lock the hub before calling this
+func (h *Hub) cancelAll(jobIDs []string) []*Job {
+	var canceled []*Job
+	for _, jobID := range jobIDs {
+		j, err := h.cancel(jobID)
+		if err != nil {
+			log.Error().Err(err).Str("jobID", jobID).Msg("Failed to cancel job")
+			continue
+		}
+		if j != nil {
+			canceled = append(canceled, j)
+		}
+	}
+	return canceled
+}
+
+// idsWithPrefix returns the ids of all jobs of the hub starting with the given prefix in order.
+// Lock the hub before calling this
+func (h *Hub) idsWithPrefix(prefix string) []string {
+	var ids []string
+	ids = append(ids, h.pastSpoke.IDsWithPrefixLocked(prefix)...)
+	for _, s := range h.spokeMap {
+		ids = append(ids, s.IDsWithPrefixLocked(prefix)...)
+	}
+	for _, j := range h.spilledJobs() {
+		if strings.HasPrefix(j.ID(), prefix) {
+			ids = append(ids, j.ID())
+		}
+	}
+	for _, j := range h.storedJobs(func(j *Job) bool { return strings.HasPrefix(j.ID(), prefix) }) {
+		ids = append(ids, j.ID())
+	}
+	for _, j := range h.reserved.jobs() {
+		if strings.HasPrefix(j.ID(), prefix) {
+			ids = append(ids, j.ID())
+		}
+	}
+	for _, j := range h.dead.jobs(-1) {
+		if strings.HasPrefix(j.ID(), prefix) {
+			ids = append(ids, j.ID())
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
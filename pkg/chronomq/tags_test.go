@@ -0,0 +1,117 @@
+package chronomq_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+var _ = Describe("Test canceling jobs by tag and prefix", func() {
+	var p persistence.Persister
+
+	BeforeEach(func() {
+		store, err := persistence.InMemStorage()
+		Expect(err).NotTo(HaveOccurred())
+		p = persistence.NewJournalPersister(store)
+	})
+
+	ids := func(jobs []*Job) []string {
+		var ids []string
+		for _, j := range jobs {
+			ids = append(ids, j.ID())
+		}
+		return ids
+	}
+
+	It("cancels jobs with a tag in every state", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p, Backoff: BackoffPolicy{MaxAttempts: 1}})
+		defer h.Stop(false)
+
+		tagged := func(id string, triggerAt time.Time, tags ...string) *Job {
+			j := NewJob(id, triggerAt, nil)
+			j.SetOpts(0, time.Minute)
+			j.SetTags(tags...)
+			Expect(j.Tags()).To(Equal(tags))
+			Expect(h.AddJobLocked(j)).To(Succeed())
+			return j
+		}
+		tagged("dead", time.Now(), "user-1")
+		Eventually(h.NextLocked, 2).ShouldNot(BeNil())
+		_, err := h.NackLocked("dead")
+		Expect(err).NotTo(HaveOccurred())
+		tagged("reserved", time.Now(), "user-1")
+		Eventually(h.NextLocked, 2).ShouldNot(BeNil())
+		tagged("pending", time.Now().Add(time.Hour), "user-1", "emails")
+		tagged("far", time.Now().Add(time.Hour*24*30), "user-1")
+		tagged("other", time.Now().Add(time.Hour), "user-2", "emails")
+
+		Expect(ids(h.CancelByTagLocked("user-1"))).To(Equal([]string{"dead", "far", "pending", "reserved"}))
+		Expect(h.CancelByTagLocked("user-1")).To(BeEmpty())
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(1)))
+		Expect(h.Stats().ReservedJobs).To(Equal(int64(0)))
+		Expect(h.Stats().DeadJobs).To(Equal(int64(0)))
+		Expect(ids(h.CancelByTagLocked("emails"))).To(Equal([]string{"other"}))
+		Expect(h.CancelByTagLocked("unknown")).To(BeEmpty())
+	}, 5)
+
+	It("keeps the tag index up to date", func(done Done) {
+		defer close(done)
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+		defer h.Stop(false)
+
+		j := NewJob("consumed", time.Now(), nil)
+		j.SetTags("a", "a", "")
+		Expect(j.Tags()).To(Equal([]string{"a"}))
+		Expect(h.AddJobLocked(j)).To(Succeed())
+		Eventually(h.NextLocked, 2).ShouldNot(BeNil())
+		Expect(h.CancelByTagLocked("a")).To(BeEmpty())
+
+		j = NewJob("replaced", time.Now().Add(time.Hour), nil)
+		j.SetTags("old")
+		Expect(h.AddJobLocked(j)).To(Succeed())
+		j = NewJob("replaced", time.Now().Add(time.Hour), nil)
+		j.SetTags("new")
+		_, err := h.PutJobLocked(j, ReplaceDuplicates)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(h.CancelByTagLocked("old")).To(BeEmpty())
+		Expect(ids(h.CancelByTagLocked("new"))).To(Equal([]string{"replaced"}))
+	}, 5)
+
+	It("cancels jobs by id prefix across spokes", func() {
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+		defer h.Stop(false)
+
+		for i, id := range []string{"user-1/a", "user-1/b", "user-10/a", "user-2/a"} {
+			Expect(h.AddJobLocked(NewJob(id, time.Now().Add(time.Hour*time.Duration(i+1)), nil))).To(Succeed())
+		}
+		Expect(h.CancelByPrefixLocked("")).To(BeEmpty())
+		Expect(ids(h.CancelByPrefixLocked("user-1/"))).To(Equal([]string{"user-1/a", "user-1/b"}))
+		Expect(ids(h.CancelByPrefixLocked("user-"))).To(Equal([]string{"user-10/a", "user-2/a"}))
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(0)))
+	})
+
+	It("persists tags", func() {
+		h := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+		j := NewJob("tagged", time.Now().Add(time.Hour), nil)
+		j.SetTags("user-1", "emails")
+		Expect(h.AddJobLocked(j)).To(Succeed())
+		Expect(h.AddJobLocked(NewJob("untagged", time.Now().Add(time.Hour), nil))).To(Succeed())
+		h.Stop(true)
+
+		restored := NewHub(&HubOpts{SpokeSpan: time.Second, Persister: p})
+		defer restored.Stop(false)
+		Expect(restored.Restore()).To(Succeed())
+		restoredJob, _, err := restored.GetJobLocked("tagged")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restoredJob.Tags()).To(Equal([]string{"user-1", "emails"}))
+		Expect(ids(restored.CancelByTagLocked("emails"))).To(Equal([]string{"tagged"}))
+		untagged, _, err := restored.GetJobLocked("untagged")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(untagged.Tags()).To(BeEmpty())
+	})
+})
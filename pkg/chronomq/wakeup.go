@@ -0,0 +1,81 @@
+package chronomq
+
+import (
+	"time"
+)
+
+// Ready returns a channel that is closed as soon as a job may have become ready to be dequeued -
+// when a ready job is added or released, a pending job reaches its trigger time or a reservation expires.
+// Take the channel before calling NextLocked, otherwise a job that becomes ready in between is missed.
+// Wakeups can be spurious, a closed channel does not guarantee that NextLocked returns a job
+func (h *Hub) Ready() <-chan struct{} {
+	h.readyLock.Lock()
+	defer h.readyLock.Unlock()
+	return h.ready
+}
+
+// notifyReady wakes up everyone waiting on the current Ready channel
+func (h *Hub) notifyReady() {
+	h.readyLock.Lock()
+	defer h.readyLock.Unlock()
+	close(h.ready)
+	h.ready = make(chan struct{})
+}
+
+// wakeAt makes sure waiters are woken up no later than at. Waiters are woken up right away if at is not in the future.
+// Lock the hub before calling this
+func (h *Hub) wakeAt(at time.Time) {
+	if !at.After(time.Now()) {
+		h.notifyReady()
+		return
+	}
+	if !h.wakeupAt.IsZero() && !at.Before(h.wakeupAt) {
+		// An earlier wakeup is already scheduled. It looks for the next one once it fires
+		return
+	}
+	h.wakeupAt = at
+	h.wakeup.Reset(time.Until(at))
+}
+
+// wake runs when the wakeup timer fires. Jobs or reservations removed since the timer was set make for early,
+// spurious wakeups, so the timer is set again for the earliest trigger time or reservation deadline still pending
+func (h *Hub) wake() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.wakeupAt = time.Time{}
+	h.notifyReady()
+	select {
+	case <-h.stop:
+		return
+	default:
+	}
+	if at, ok := h.nextWakeup(); ok {
+		h.wakeAt(at)
+	}
+}
+
+// nextWakeup returns the earliest trigger time or reservation deadline that is still in the future, including
+// trigger times of jobs behind ready jobs that weren't taken yet. Jobs in the past spoke are ready already so
+// they never need a wakeup. Lock the hub before calling this
+func (h *Hub) nextWakeup() (time.Time, bool) {
+	var next time.Time
+	now := time.Now()
+	consider := func(at time.Time, ok bool) {
+		if ok && at.After(now) && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	if h.currentSpoke != nil {
+		consider(h.currentSpoke.NextTriggerAfterLocked(now))
+	}
+	for i := 0; i < h.spokes.Len(); i++ {
+		consider(h.spokes.AtIdx(i).Value().(*Spoke).NextTriggerAfterLocked(now))
+	}
+	if h.store != nil {
+		if _, at, ok, err := h.store.Next(now); err == nil {
+			consider(at, ok)
+		}
+	}
+	consider(h.reserved.nextDeadline())
+	return next, !next.IsZero()
+}
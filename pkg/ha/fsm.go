@@ -0,0 +1,129 @@
+package ha
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"sync"
+
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+// command is a hub mutation replicated through the raft log. It is what the leader's hub appends to its write-ahead log
+type command struct {
+	Queue string
+	Op    persistence.Op
+	ID    string // ID of the job the mutation applies to
+	Data  []byte // Encoded job. Only set for OpPut
+}
+
+func (c *command) encode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(c); err != nil {
+		return nil, errors.Wrap(err, "HA: Failed to encode command")
+	}
+	return buf.Bytes(), nil
+}
+
+// fsm holds the encoded jobs of every queue as committed to the raft log. Every node keeps it up to date,
+// so that the hubs of a new leader can be restored from it. It is safe to call methods on fsm from multiple goroutines
+type fsm struct {
+	queues map[string]map[string][]byte // Encoded jobs by id by queue
+	lock   *sync.RWMutex
+}
+
+func newFSM() *fsm {
+	return &fsm{queues: make(map[string]map[string][]byte), lock: &sync.RWMutex{}}
+}
+
+// Apply applies a committed command. Returns an error if the command can't be decoded
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	var c command
+	if err := gob.NewDecoder(bytes.NewReader(l.Data)).Decode(&c); err != nil {
+		err = errors.Wrap(err, "HA: Failed to decode command")
+		log.Error().Err(err).Uint64("index", l.Index).Send()
+		return err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	jobs, ok := f.queues[c.Queue]
+	if !ok {
+		jobs = make(map[string][]byte)
+		f.queues[c.Queue] = jobs
+	}
+	switch c.Op {
+	case persistence.OpPut:
+		jobs[c.ID] = c.Data
+	case persistence.OpCancel, persistence.OpConsume:
+		delete(jobs, c.ID)
+	}
+	return nil
+}
+
+// Snapshot captures the jobs of all queues. The encoded jobs are never modified, so only the maps are copied
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	queues := make(map[string]map[string][]byte, len(f.queues))
+	for queue, jobs := range f.queues {
+		queues[queue] = make(map[string][]byte, len(jobs))
+		for id, data := range jobs {
+			queues[queue][id] = data
+		}
+	}
+	return &fsmSnapshot{queues: queues}, nil
+}
+
+// Restore replaces all jobs with the jobs of a snapshot
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	queues := make(map[string]map[string][]byte)
+	if err := gob.NewDecoder(rc).Decode(&queues); err != nil {
+		return errors.Wrap(err, "HA: Failed to decode snapshot")
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.queues = queues
+	return nil
+}
+
+// queueNames returns the names of all queues that ever had jobs
+func (f *fsm) queueNames() []string {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	names := make([]string, 0, len(f.queues))
+	for name := range f.queues {
+		names = append(names, name)
+	}
+	return names
+}
+
+// records returns the jobs of a queue as write-ahead log records
+func (f *fsm) records(queue string) []persistence.Record {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	records := make([]persistence.Record, 0, len(f.queues[queue]))
+	for id, data := range f.queues[queue] {
+		records = append(records, persistence.Record{Op: persistence.OpPut, ID: id, Data: data})
+	}
+	return records
+}
+
+type fsmSnapshot struct {
+	queues map[string]map[string][]byte
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := gob.NewEncoder(sink).Encode(s.queues); err != nil {
+		sink.Cancel()
+		return errors.Wrap(err, "HA: Failed to write snapshot")
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
@@ -0,0 +1,285 @@
+// Package ha runs chronomq servers as a replicated cluster. Every hub mutation of the leader - puts, cancels
+// and consumes - is committed to a raft log before it is acknowledged and applied by all nodes. Only the leader
+// serves clients, followers keep the replicated jobs of every queue and restore the hubs from them once they
+// are elected. Reserved jobs are pending again after a fail-over, like after a restart of a single server.
+//
+// Membership is static: every node of a cluster is started with the same peers
+package ha
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+// ErrNotLeader is returned when a node that is not the leader is asked to serve clients
+var ErrNotLeader = errors.New("Not the leader")
+
+const (
+	applyTimeout   = time.Second * 10 // How long a mutation may take to be committed
+	barrierTimeout = time.Minute      // How long a new leader may take to apply the log before restoring its hubs
+	retainSnaps    = 2                // Number of raft snapshots kept in the node's dir
+	maxPool        = 3                // Connections kept open to every other node
+	spokeSpan      = time.Second * 10 // Spoke span of hubs created without options
+)
+
+// Peer is a node of a cluster
+type Peer struct {
+	ID       string // Unique id of the node. It must not change when the node restarts
+	RaftAddr string // Address the node replicates the log on
+	RPCAddr  string // Address the node serves rpc clients on. Followers redirect clients to the leader's RPCAddr
+}
+
+// Config configures a node
+type Config struct {
+	Peer         // This node
+	Peers []Peer // All nodes of the cluster including this one. A new cluster is bootstrapped with them
+	Dir   string // Local dir holding the raft log and snapshots
+	// Options of the hubs the node creates once it is the leader, called for every queue.
+	// Persistence options are set by the node. Hubs with a 10s spoke span are created if not set
+	HubOpts func(queue string) *chronomq.HubOpts
+	Codec   persistence.Codec // Encodes replicated jobs. persistence.GobCodec if not set
+
+	// Raft timing. The defaults of raft are used if not set
+	HeartbeatTimeout time.Duration
+	ElectionTimeout  time.Duration
+}
+
+// Node is a member of a replicated cluster. It is safe to call methods on Node from multiple goroutines
+type Node struct {
+	cfg       Config
+	codec     persistence.Codec
+	raft      *raft.Raft
+	fsm       *fsm
+	store     *store
+	transport *raft.NetworkTransport
+
+	queues *chronomq.QueueSet // Served queues. Only set while the node is the leader
+	lock   *sync.RWMutex
+
+	stop chan struct{}
+	done chan struct{} // Closed once the node stopped following leadership changes
+}
+
+// NewNode starts a node. A cluster is bootstrapped with the configured peers if the node has no state yet
+func NewNode(cfg Config) (*Node, error) {
+	if err := os.MkdirAll(cfg.Dir, os.ModeDir|os.FileMode(0755)); err != nil {
+		return nil, errors.Wrap(err, "HA: Failed to create dir")
+	}
+	n := &Node{
+		cfg:   cfg,
+		codec: cfg.Codec,
+		fsm:   newFSM(),
+		lock:  &sync.RWMutex{},
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if n.codec == nil {
+		n.codec = persistence.GobCodec
+	}
+
+	var err error
+	n.store, err = openStore(filepath.Join(cfg.Dir, "raft.db"))
+	if err != nil {
+		return nil, errors.Wrap(err, "HA: Failed to open raft log")
+	}
+	snaps, err := raft.NewFileSnapshotStore(cfg.Dir, retainSnaps, log.Logger)
+	if err != nil {
+		n.store.Close()
+		return nil, errors.Wrap(err, "HA: Failed to open snapshot store")
+	}
+	addr, err := net.ResolveTCPAddr("tcp", cfg.RaftAddr)
+	if err != nil {
+		n.store.Close()
+		return nil, errors.Wrap(err, "HA: Invalid raft address")
+	}
+	n.transport, err = raft.NewTCPTransport(cfg.RaftAddr, addr, maxPool, applyTimeout, log.Logger)
+	if err != nil {
+		n.store.Close()
+		return nil, errors.Wrap(err, "HA: Failed to listen for peers")
+	}
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(cfg.ID)
+	conf.LogOutput = log.Logger
+	conf.LogLevel = "INFO"
+	if cfg.HeartbeatTimeout > 0 {
+		conf.HeartbeatTimeout = cfg.HeartbeatTimeout
+		conf.LeaderLeaseTimeout = cfg.HeartbeatTimeout / 2
+	}
+	if cfg.ElectionTimeout > 0 {
+		conf.ElectionTimeout = cfg.ElectionTimeout
+	}
+	// Buffered so that raft never blocks on a leadership change
+	leaderC := make(chan bool, 1)
+	conf.NotifyCh = leaderC
+
+	hasState, err := raft.HasExistingState(n.store, n.store, snaps)
+	if err == nil && !hasState {
+		err = raft.BootstrapCluster(conf, n.store, n.store, snaps, n.transport, n.configuration())
+	}
+	if err != nil {
+		n.transport.Close()
+		n.store.Close()
+		return nil, errors.Wrap(err, "HA: Failed to bootstrap cluster")
+	}
+
+	n.raft, err = raft.NewRaft(conf, n.fsm, n.store, n.store, snaps, n.transport)
+	if err != nil {
+		n.transport.Close()
+		n.store.Close()
+		return nil, errors.Wrap(err, "HA: Failed to start raft")
+	}
+	go n.followLeadership(leaderC)
+
+	log.Info().Str("id", cfg.ID).Str("raftAddr", cfg.RaftAddr).Int("peers", len(cfg.Peers)).
+		Bool("existingState", hasState).Msg("HA: Started node")
+	return n, nil
+}
+
+// configuration returns the raft configuration of the configured peers
+func (n *Node) configuration() raft.Configuration {
+	var conf raft.Configuration
+	for _, p := range n.cfg.Peers {
+		conf.Servers = append(conf.Servers, raft.Server{
+			Suffrage: raft.Voter,
+			ID:       raft.ServerID(p.ID),
+			Address:  raft.ServerAddress(p.RaftAddr),
+		})
+	}
+	return conf
+}
+
+// followLeadership restores the hubs when the node becomes the leader and stops them when it isn't anymore
+func (n *Node) followLeadership(leaderC chan bool) {
+	defer close(n.done)
+	for {
+		select {
+		case isLeader := <-leaderC:
+			if isLeader {
+				n.lead()
+			} else {
+				n.follow()
+			}
+		case <-n.stop:
+			n.follow()
+			return
+		}
+	}
+}
+
+func (n *Node) lead() {
+	log.Info().Str("id", n.cfg.ID).Msg("HA: Elected leader. Restoring queues")
+	// Hubs are restored from the jobs the previous leader committed. Wait till all of them are applied
+	if err := n.raft.Barrier(barrierTimeout).Error(); err != nil {
+		log.Error().Err(err).Msg("HA: Cannot apply the raft log. Not serving as the leader")
+		return
+	}
+	queues := chronomq.NewQueueSet(n.newHub)
+	for _, queue := range n.fsm.queueNames() {
+		if _, err := queues.Hub(queue); err != nil {
+			log.Error().Err(err).Str("queue", queue).Msg("HA: Cannot restore queue")
+		}
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.queues = queues
+	log.Info().Str("id", n.cfg.ID).Strs("queues", queues.Names()).Msg("HA: Serving as the leader")
+}
+
+func (n *Node) follow() {
+	n.lock.Lock()
+	queues := n.queues
+	n.queues = nil
+	n.lock.Unlock()
+	if queues != nil {
+		log.Info().Str("id", n.cfg.ID).Msg("HA: Lost leadership. Stopping queues")
+		queues.Stop(false)
+	}
+}
+
+// newHub creates the hub of a queue and restores its jobs from the raft log
+func (n *Node) newHub(queue string) (*chronomq.Hub, error) {
+	opts := &chronomq.HubOpts{SpokeSpan: spokeSpan}
+	if n.cfg.HubOpts != nil {
+		opts = n.cfg.HubOpts(queue)
+	}
+	// The raft log is the only durable store of a replicated hub, snapshots to a store would be stale
+	// on any other node
+	store, err := persistence.InMemStorage()
+	if err != nil {
+		return nil, err
+	}
+	opts.Persister = persistence.NewJournalPersister(store)
+	opts.WAL = &replicatedWAL{node: n, queue: queue}
+	opts.Codec = n.codec
+	opts.Queue = queue
+	opts.AttemptRestore = false
+	opts.SnapshotInterval = 0
+
+	h := chronomq.NewHub(opts)
+	if err := h.Restore(); err != nil {
+		log.Error().Err(err).Str("queue", queue).Msg("HA: Restore error")
+	}
+	return h, nil
+}
+
+// Queues returns the queues to serve while the node is the leader. Otherwise it returns an ErrNotLeader
+// that names the rpc address of the leader if one is known
+func (n *Node) Queues() (*chronomq.QueueSet, error) {
+	n.lock.RLock()
+	queues := n.queues
+	n.lock.RUnlock()
+	if queues != nil {
+		return queues, nil
+	}
+	leader := n.LeaderRPCAddr()
+	// The leader may be this node, still restoring its queues
+	if leader == "" || leader == n.cfg.RPCAddr {
+		return nil, ErrNotLeader
+	}
+	return nil, errors.Wrapf(ErrNotLeader, "Leader at %s", leader)
+}
+
+// IsLeader returns true if the node is the leader and serves clients
+func (n *Node) IsLeader() bool {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.queues != nil
+}
+
+// LeaderRPCAddr returns the rpc address of the current leader or "" if there is no leader
+func (n *Node) LeaderRPCAddr() string {
+	addr := string(n.raft.Leader())
+	for _, p := range n.cfg.Peers {
+		if p.RaftAddr == addr {
+			return p.RPCAddr
+		}
+	}
+	return ""
+}
+
+// Shutdown stops serving and leaves the cluster. The node's state is kept in its dir
+func (n *Node) Shutdown() error {
+	close(n.stop)
+	<-n.done
+	err := n.raft.Shutdown().Error()
+	if cerr := n.transport.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := n.store.Close(); err == nil {
+		err = cerr
+	}
+	log.Info().Str("id", n.cfg.ID).Msg("HA: Stopped node")
+	return err
+}
@@ -0,0 +1,156 @@
+package ha_test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	api "github.com/chronomq/chronomq/api/rpc/chronomq"
+	"github.com/chronomq/chronomq/pkg/ha"
+	"github.com/chronomq/chronomq/pkg/protocol"
+)
+
+var _ = Describe("Test replicated cluster", func() {
+	var dir string
+	var peers []ha.Peer
+	var nodes []*ha.Node
+	var servers []io.Closer
+	port := 9301
+
+	start := func(i int) {
+		node, err := ha.NewNode(ha.Config{
+			Peer:             peers[i],
+			Peers:            peers,
+			Dir:              filepath.Join(dir, peers[i].ID),
+			HeartbeatTimeout: time.Millisecond * 200,
+			ElectionTimeout:  time.Millisecond * 200,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		srv, err := protocol.ServeReplicaRPC(node, peers[i].RPCAddr)
+		Expect(err).NotTo(HaveOccurred())
+		nodes[i], servers[i] = node, srv
+	}
+
+	stop := func(i int) {
+		Expect(servers[i].Close()).To(Succeed())
+		Expect(nodes[i].Shutdown()).To(Succeed())
+		nodes[i], servers[i] = nil, nil
+	}
+
+	leader := func() int {
+		for i, n := range nodes {
+			if n != nil && n.IsLeader() {
+				return i
+			}
+		}
+		return -1
+	}
+
+	follower := func() int {
+		for i, n := range nodes {
+			if n != nil && !n.IsLeader() {
+				return i
+			}
+		}
+		return -1
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "chronomq-ha")
+		Expect(err).NotTo(HaveOccurred())
+		peers = nil
+		for i := 0; i < 3; i++ {
+			peers = append(peers, ha.Peer{
+				ID:       fmt.Sprintf("node%d", i),
+				RaftAddr: fmt.Sprintf("127.0.0.1:%d", port),
+				RPCAddr:  fmt.Sprintf("127.0.0.1:%d", port+1),
+			})
+			port += 2
+		}
+		nodes = make([]*ha.Node, len(peers))
+		servers = make([]io.Closer, len(peers))
+		for i := range peers {
+			start(i)
+		}
+		Eventually(leader, "5s", "10ms").ShouldNot(Equal(-1))
+	})
+
+	AfterEach(func() {
+		for i, n := range nodes {
+			if n != nil {
+				stop(i)
+			}
+		}
+		os.RemoveAll(dir)
+	})
+
+	It("redirects clients of followers to the leader", func() {
+		client, err := api.NewClient(peers[follower()].RPCAddr)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		id, err := client.Put([]byte("Hello world"), 0)
+		Expect(err).NotTo(HaveOccurred())
+		rid, body, err := client.Next(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rid).To(Equal(id))
+		Expect(body).To(Equal([]byte("Hello world")))
+	})
+
+	It("serves committed jobs from a new leader after a fail-over", func() {
+		old := leader()
+		client, err := api.NewClient(peers[old].RPCAddr)
+		Expect(err).NotTo(HaveOccurred())
+		id, err := client.Use("emails").Put([]byte("Hello world"), 0)
+		Expect(err).NotTo(HaveOccurred())
+		canceled, err := client.Use("emails").Put([]byte("Canceled"), 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Use("emails").Cancel(canceled)).To(Succeed())
+		client.Close()
+
+		stop(old)
+		Eventually(leader, "5s", "10ms").ShouldNot(Equal(-1))
+		Expect(leader()).NotTo(Equal(old))
+
+		client, err = api.NewClient(peers[follower()].RPCAddr)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		queues, err := client.Queues()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queues).To(ContainElement("emails"))
+		jobs, err := client.Use("emails").NextN(10, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jobs).To(HaveLen(1))
+		Expect(jobs[0].ID).To(Equal(id))
+	})
+
+	It("restores jobs from the raft log when the cluster restarts", func() {
+		client, err := api.NewClient(peers[leader()].RPCAddr)
+		Expect(err).NotTo(HaveOccurred())
+		id, err := client.Put([]byte("Hello world"), time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		client.Close()
+
+		for i := range nodes {
+			stop(i)
+		}
+		for i := range peers {
+			start(i)
+		}
+		Eventually(leader, "5s", "10ms").ShouldNot(Equal(-1))
+
+		client, err = api.NewClient(peers[leader()].RPCAddr)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		j, err := client.Get(id)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.Body).To(Equal([]byte("Hello world")))
+	})
+})
@@ -0,0 +1,146 @@
+package ha
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Key prefixes of the raft log entries and the stable store values in the store's db
+var (
+	logPrefix    = []byte("l")
+	stablePrefix = []byte("s")
+)
+
+// errKeyNotFound is returned for missing stable store keys. raft checks for this exact message
+var errKeyNotFound = errors.New("not found")
+
+// store keeps the raft log and the raft stable store in a leveldb db
+type store struct {
+	db *leveldb.DB
+}
+
+func openStore(path string) (*store, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &store{db: db}, nil
+}
+
+func (s *store) Close() error {
+	return s.db.Close()
+}
+
+func logKey(index uint64) []byte {
+	key := make([]byte, len(logPrefix)+8)
+	copy(key, logPrefix)
+	binary.BigEndian.PutUint64(key[len(logPrefix):], index)
+	return key
+}
+
+// FirstIndex returns the index of the oldest log entry or 0 if the log is empty
+func (s *store) FirstIndex() (uint64, error) {
+	it := s.db.NewIterator(util.BytesPrefix(logPrefix), nil)
+	defer it.Release()
+	if !it.First() {
+		return 0, it.Error()
+	}
+	return binary.BigEndian.Uint64(it.Key()[len(logPrefix):]), nil
+}
+
+// LastIndex returns the index of the newest log entry or 0 if the log is empty
+func (s *store) LastIndex() (uint64, error) {
+	it := s.db.NewIterator(util.BytesPrefix(logPrefix), nil)
+	defer it.Release()
+	if !it.Last() {
+		return 0, it.Error()
+	}
+	return binary.BigEndian.Uint64(it.Key()[len(logPrefix):]), nil
+}
+
+// GetLog reads the log entry at the given index
+func (s *store) GetLog(index uint64, l *raft.Log) error {
+	data, err := s.db.Get(logKey(index), nil)
+	if err == leveldb.ErrNotFound {
+		return raft.ErrLogNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(l)
+}
+
+// StoreLog appends a log entry
+func (s *store) StoreLog(l *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{l})
+}
+
+// StoreLogs appends a batch of log entries atomically
+func (s *store) StoreLogs(logs []*raft.Log) error {
+	batch := new(leveldb.Batch)
+	for _, l := range logs {
+		buf := &bytes.Buffer{}
+		if err := gob.NewEncoder(buf).Encode(l); err != nil {
+			return err
+		}
+		batch.Put(logKey(l.Index), buf.Bytes())
+	}
+	return s.db.Write(batch, nil)
+}
+
+// DeleteRange deletes the log entries from min to max, both included
+func (s *store) DeleteRange(min, max uint64) error {
+	batch := new(leveldb.Batch)
+	it := s.db.NewIterator(&util.Range{Start: logKey(min), Limit: logKey(max + 1)}, nil)
+	for it.Next() {
+		batch.Delete(append([]byte{}, it.Key()...))
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return s.db.Write(batch, nil)
+}
+
+func stableKey(key []byte) []byte {
+	return append(append([]byte{}, stablePrefix...), key...)
+}
+
+// Set stores a value of the stable store
+func (s *store) Set(key []byte, val []byte) error {
+	return s.db.Put(stableKey(key), val, nil)
+}
+
+// Get reads a value of the stable store
+func (s *store) Get(key []byte) ([]byte, error) {
+	val, err := s.db.Get(stableKey(key), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, errKeyNotFound
+	}
+	return val, err
+}
+
+// SetUint64 stores a number in the stable store
+func (s *store) SetUint64(key []byte, val uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, val)
+	return s.Set(key, buf)
+}
+
+// GetUint64 reads a number of the stable store. Missing numbers are 0
+func (s *store) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err == errKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
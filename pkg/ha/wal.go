@@ -0,0 +1,72 @@
+package ha
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+// replicatedWAL is the write-ahead log of a queue's hub on the leader. Append returns once the record is
+// committed to the raft log, so puts are only accepted once a majority of the nodes has them.
+// Replay returns the jobs of the queue as committed, which is how the hubs of a new leader are restored
+type replicatedWAL struct {
+	node  *Node
+	queue string
+}
+
+// Append replicates a record of the queue
+func (w *replicatedWAL) Append(op persistence.Op, id string, e persistence.Entry) error {
+	c := command{Queue: w.queue, Op: op, ID: id}
+	if op == persistence.OpPut {
+		var err error
+		c.Data, err = w.node.codec.Encode(e)
+		if err != nil {
+			return err
+		}
+	}
+	data, err := c.encode()
+	if err != nil {
+		return err
+	}
+
+	f := w.node.raft.Apply(data, applyTimeout)
+	if err = f.Error(); err == raft.ErrNotLeader || err == raft.ErrLeadershipLost {
+		return errors.Wrapf(ErrNotLeader, "HA: Cannot replicate record of job %s", id)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "HA: Cannot replicate record of job %s", id)
+	}
+	if err, ok := f.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Rotate is a noop. The raft log is compacted by raft snapshots
+func (w *replicatedWAL) Rotate(min uint64) (uint64, error) {
+	return min, nil
+}
+
+// Truncate is a noop. The raft log is compacted by raft snapshots
+func (w *replicatedWAL) Truncate(seq uint64) error {
+	return nil
+}
+
+// Replay returns a put record for every job of the queue committed to the raft log
+func (w *replicatedWAL) Replay(from uint64) (chan persistence.Record, error) {
+	records := w.node.fsm.records(w.queue)
+	recordC := make(chan persistence.Record)
+	go func() {
+		defer close(recordC)
+		for _, r := range records {
+			recordC <- r
+		}
+	}()
+	return recordC, nil
+}
+
+// Close is a noop. The raft log is closed when the node shuts down
+func (w *replicatedWAL) Close() error {
+	return nil
+}
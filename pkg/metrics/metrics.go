@@ -47,3 +47,8 @@ func Gauge(name string, val float64) error {
 func GaugeInt(name string, val int) error {
 	return Client.Gauge(name, float64(val), nil, 1)
 }
+
+// Count adds val to the given metric name
+func Count(name string, val int) error {
+	return Client.Count(name, int64(val), nil, 1)
+}
@@ -3,9 +3,12 @@ package persistence
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,11 +25,22 @@ import (
 // StoreConfig - config for data store
 type StoreConfig struct {
 	Bucket *url.URL
+	Queue  string // Named queue whose data is stored. Empty for the default queue
 }
 
+// queuesKey prefixes the data of named queues. The default queue's data is stored at the root of the bucket
+var queuesKey = "queues/"
+
 var verifyAccessKey = "accesscheck"
+
+// dataKey is where unversioned snapshots were stored. Snapshots are now stored
+// as dataKey.<version> but an unversioned snapshot is still restored if it is the only one
 var dataKey = "jobs.snapshot"
 
+func snapshotKey(version uint64) string {
+	return fmt.Sprintf("%s.%d", dataKey, version)
+}
+
 type blobStore struct {
 	bucket *blob.Bucket
 	cfg    StoreConfig
@@ -39,8 +53,12 @@ func NewBlobStore(cfg StoreConfig) (Storage, error) {
 	if err != nil {
 		return nil, err
 	}
+	prefix := "journal/"
+	if cfg.Queue != "" {
+		prefix = queuesKey + cfg.Queue + "/" + prefix
+	}
 	s := &blobStore{
-		bucket: blob.PrefixedBucket(b, "journal/"),
+		bucket: blob.PrefixedBucket(b, prefix),
 		cfg:    cfg,
 	}
 
@@ -51,11 +69,30 @@ func NewBlobStore(cfg StoreConfig) (Storage, error) {
 	return s, nil
 }
 
+// Writer creates a snapshot with the version following the latest one.
+// The snapshot only becomes visible once the writer is closed
 func (b *blobStore) Writer() (io.WriteCloser, error) {
-	return b.bucket.NewWriter(context.Background(), dataKey, nil)
+	version, err := b.Version()
+	if err != nil {
+		return nil, err
+	}
+	key := snapshotKey(version + 1)
+	log.Info().Str("key", key).Msg("Store:blob:Writer creating snapshot")
+	return b.bucket.NewWriter(context.Background(), key, nil)
 }
 
+// Reader reads the latest snapshot
 func (b *blobStore) Reader() (io.ReadCloser, error) {
+	version, err := b.Version()
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 {
+		key := snapshotKey(version)
+		log.Info().Str("key", key).Msg("Store:blob:Reader reading snapshot")
+		return b.bucket.NewReader(context.Background(), key, nil)
+	}
+
 	exists, err := b.bucket.Exists(context.Background(), dataKey)
 	if err != nil {
 		return nil, err
@@ -67,7 +104,35 @@ func (b *blobStore) Reader() (io.ReadCloser, error) {
 	return b.bucket.NewReader(context.Background(), dataKey, nil)
 }
 
+// Version returns the latest snapshot version
+func (b *blobStore) Version() (uint64, error) {
+	versions, err := b.versions()
+	if err != nil || len(versions) == 0 {
+		return 0, err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// Reset deletes all snapshots
 func (b *blobStore) Reset() error {
+	return b.Truncate(^uint64(0))
+}
+
+// Truncate deletes all snapshots older than the given version
+func (b *blobStore) Truncate(version uint64) error {
+	versions, err := b.versions()
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if v >= version {
+			break
+		}
+		if err = b.bucket.Delete(context.Background(), snapshotKey(v)); err != nil {
+			return err
+		}
+	}
+
 	ok, err := b.bucket.Exists(context.Background(), dataKey)
 	if err != nil {
 		return err
@@ -78,10 +143,63 @@ func (b *blobStore) Reset() error {
 	return b.bucket.Delete(context.Background(), dataKey)
 }
 
+// versions lists the versions of all snapshots in ascending order
+func (b *blobStore) versions() ([]uint64, error) {
+	versions := []uint64{}
+	iter := b.bucket.List(&blob.ListOptions{Prefix: dataKey + "."})
+	for {
+		obj, err := iter.Next(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		v, err := strconv.ParseUint(strings.TrimPrefix(obj.Key, dataKey+"."), 10, 64)
+		if err != nil {
+			log.Warn().Str("key", obj.Key).Msg("Store:blob ignoring unknown snapshot key")
+			continue
+		}
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions, nil
+}
+
 func (b *blobStore) String() string {
+	if b.cfg.Queue != "" {
+		return b.cfg.Bucket.String() + " queue:" + b.cfg.Queue
+	}
 	return b.cfg.Bucket.String()
 }
 
+// Queues lists the named queues that have data in the bucket
+func (cfg StoreConfig) Queues() ([]string, error) {
+	ctx := context.Background()
+	b, err := blob.OpenBucket(ctx, cfg.Bucket.String())
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+
+	queues := []string{}
+	iter := b.List(&blob.ListOptions{Prefix: queuesKey, Delimiter: "/"})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if obj.IsDir {
+			queues = append(queues, strings.TrimSuffix(strings.TrimPrefix(obj.Key, queuesKey), "/"))
+		}
+	}
+	sort.Strings(queues)
+	return queues, nil
+}
+
 func (b *blobStore) verifyAccess() error {
 	wd := []byte(`access_check__` + time.Now().String())
 	err := b.bucket.WriteAll(context.Background(), verifyAccessKey, wd, nil)
@@ -0,0 +1,71 @@
+package persistence
+
+import (
+	"encoding/gob"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Entry is a value stored in snapshots and write-ahead logs, e.g. a job. It can be encoded with every codec
+type Entry interface {
+	gob.GobEncoder
+	gob.GobDecoder
+	proto.Marshaler
+	proto.Unmarshaler
+}
+
+// Codec encodes entries before they are written to snapshots and write-ahead logs and decodes them on restore
+type Codec interface {
+	// Name identifies the codec, see ParseCodec
+	Name() string
+	Encode(e Entry) ([]byte, error)
+	Decode(data []byte, e Entry) error
+}
+
+// GobCodec encodes entries with encoding/gob. Entries can only be read by Go programs
+var GobCodec Codec = gobCodec{}
+
+// ProtobufCodec encodes entries as protocol buffers. Entries can be read by any language with a protobuf library
+var ProtobufCodec Codec = protobufCodec{}
+
+var codecs = []Codec{GobCodec, ProtobufCodec}
+
+// ParseCodec returns the codec with the given name: gob or protobuf
+func ParseCodec(s string) (Codec, error) {
+	for _, c := range codecs {
+		if strings.EqualFold(s, c.Name()) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown codec: %s", s)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Encode(e Entry) ([]byte, error) {
+	return e.GobEncode()
+}
+
+func (gobCodec) Decode(data []byte, e Entry) error {
+	return e.GobDecode(data)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string {
+	return "protobuf"
+}
+
+func (protobufCodec) Encode(e Entry) ([]byte, error) {
+	return e.Marshal()
+}
+
+func (protobufCodec) Decode(data []byte, e Entry) error {
+	return e.Unmarshal(data)
+}
@@ -0,0 +1,46 @@
+package persistence_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+var _ = Describe("Test codecs", func() {
+
+	It("parses codec names", func() {
+		c, err := persistence.ParseCodec("gob")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(persistence.GobCodec))
+		c, err = persistence.ParseCodec("Protobuf")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(persistence.ProtobufCodec))
+		_, err = persistence.ParseCodec("json")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("decodes jobs encoded with any codec", func() {
+		j := chronomq.NewJobAutoID(time.Now(), testBody)
+		j.SetOpts(3, time.Minute)
+		j.SetTags("a", "b")
+		codecs := []persistence.Codec{persistence.GobCodec, persistence.ProtobufCodec}
+		for _, enc := range codecs {
+			data, err := enc.Encode(j)
+			Expect(err).ToNot(HaveOccurred())
+			for _, dec := range codecs {
+				jj := &chronomq.Job{}
+				Expect(dec.Decode(data, jj)).To(Succeed(), "%s decoding %s", dec.Name(), enc.Name())
+				Expect(jj.ID()).To(Equal(j.ID()))
+				Expect(jj.Body()).To(Equal(testBody))
+				Expect(jj.TriggerAt()).To(BeTemporally("==", j.TriggerAt()))
+				Expect(jj.Pri()).To(Equal(int32(3)))
+				Expect(jj.TTR()).To(Equal(time.Minute))
+				Expect(jj.Tags()).To(Equal([]string{"a", "b"}))
+			}
+		}
+	})
+})
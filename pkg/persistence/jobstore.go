@@ -0,0 +1,330 @@
+package persistence
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// JobStore keeps the jobs of a hub on disk instead of in memory. It is the hub's write-ahead log as well:
+// every job the hub holds is stored under its id as it is appended, and pending jobs are indexed by their
+// trigger time so that the hub can take them in order. Jobs that are ready move to an index by priority, so
+// that they are taken in the order of the hub's ready spoke. It is safe to call methods on JobStore from multiple goroutines
+type JobStore interface {
+	WAL
+	// Recover rebuilds the pending index from scratch. It clears the index and returns every stored job as a put
+	// record, the hub schedules the pending ones again. Index entries of mutations torn by a crash are dropped this way
+	Recover() (chan Record, error)
+	// Get returns the encoded job with the given id or nil if the job is not stored
+	Get(id string) ([]byte, error)
+	// Schedule adds a job of the given priority to the pending index at the given trigger time
+	Schedule(id string, at time.Time, pri int32) error
+	// Unschedule removes a job from the pending index
+	Unschedule(id string, at time.Time, pri int32) error
+	// Next returns the id and trigger time of the pending job that triggers first after the given time, e.g. to wait
+	// for it. ok is false if no such job is pending
+	Next(after time.Time) (id string, at time.Time, ok bool, err error)
+	// Ready moves the pending jobs that trigger at or before now to the ready index and returns the ready job
+	// with the highest priority, the one that triggers first among jobs of the same priority. ok is false if no job is ready
+	Ready(now time.Time) (id string, at time.Time, pri int32, ok bool, err error)
+	// Pending calls fn with every encoded pending job in the order they are taken till fn returns false:
+	// ready jobs in priority order first, then the other jobs in trigger order
+	Pending(fn func(data []byte) bool) error
+	// Stored calls fn with every stored job whose id is greater than after in id order till fn returns false.
+	// Stored jobs may be pending, reserved or dead-lettered
+	Stored(after string, fn func(id string, data []byte) bool) error
+}
+
+// JobStoreConfig configures a leveldb job store
+type JobStoreConfig struct {
+	Dir   string // Local directory holding the store's db
+	Queue string // Named queue whose jobs are stored. Empty for the default queue
+	Codec Codec  // Encodes the stored jobs. GobCodec if not set
+	// Fsync every write. Writes survive a process crash either way, only a machine crash can lose unsynced writes
+	Sync bool
+}
+
+// queueDir returns the directory holding the db of the configured queue
+func (cfg JobStoreConfig) queueDir() string {
+	if cfg.Queue == "" {
+		return cfg.Dir
+	}
+	return filepath.Join(cfg.Dir, walQueuesDir, cfg.Queue)
+}
+
+// Queues lists the named queues that have a db in the store dir
+func (cfg JobStoreConfig) Queues() ([]string, error) {
+	queues, err := listQueueDirs(cfg.Dir)
+	return queues, errors.Wrap(err, "Store:leveldb failed to list queues")
+}
+
+// Key prefixes of the jobs by id and the pending index in the db
+var (
+	jobPrefix     = []byte("j")
+	pendingPrefix = []byte("t")
+	readyPrefix   = []byte("r")
+)
+
+// levelJobStore keeps jobs in a leveldb db. A job is stored at j<id> and indexed as pending at t<trigger time><id>
+// with its priority as value. Ready jobs are indexed at r<priority><trigger time><id> instead
+type levelJobStore struct {
+	cfg JobStoreConfig
+	db  *leveldb.DB
+	wo  *opt.WriteOptions
+}
+
+// NewJobStore opens a leveldb job store in the configured directory
+func NewJobStore(cfg JobStoreConfig) (JobStore, error) {
+	if cfg.Codec == nil {
+		cfg.Codec = GobCodec
+	}
+	dir := cfg.queueDir()
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Store:leveldb failed to open db")
+	}
+	log.Info().Str("dir", dir).Bool("sync", cfg.Sync).Str("codec", cfg.Codec.Name()).Msg("Opened leveldb job store")
+	return &levelJobStore{cfg: cfg, db: db, wo: &opt.WriteOptions{Sync: cfg.Sync}}, nil
+}
+
+func jobKey(id string) []byte {
+	return append(append([]byte{}, jobPrefix...), id...)
+}
+
+// pendingKey orders jobs by trigger time and then id. The sign bit is flipped so that times before 1970 sort first
+func pendingKey(id string, at time.Time) []byte {
+	key := make([]byte, len(pendingPrefix)+8, len(pendingPrefix)+8+len(id))
+	copy(key, pendingPrefix)
+	binary.BigEndian.PutUint64(key[len(pendingPrefix):], uint64(at.UnixNano())^(1<<63))
+	return append(key, id...)
+}
+
+func parsePendingKey(key []byte) (string, time.Time) {
+	key = key[len(pendingPrefix):]
+	ns := int64(binary.BigEndian.Uint64(key) ^ (1 << 63))
+	return string(key[8:]), time.Unix(0, ns)
+}
+
+// readyKey orders jobs by descending priority, then trigger time and id. The bits of the priority are flipped
+// except for the sign bit, so that higher priorities sort first
+func readyKey(id string, at time.Time, pri int32) []byte {
+	key := make([]byte, len(readyPrefix)+4, len(readyPrefix)+12+len(id))
+	copy(key, readyPrefix)
+	binary.BigEndian.PutUint32(key[len(readyPrefix):], ^(uint32(pri) ^ (1 << 31)))
+	return append(key, pendingKey(id, at)[len(pendingPrefix):]...)
+}
+
+func parseReadyKey(key []byte) (string, time.Time, int32) {
+	key = key[len(readyPrefix):]
+	pri := int32(^binary.BigEndian.Uint32(key) ^ (1 << 31))
+	id, at := parsePendingKey(append(append([]byte{}, pendingPrefix...), key[4:]...))
+	return id, at, pri
+}
+
+func encodePri(pri int32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(pri))
+	return b
+}
+
+// decodePri returns 0 for index entries without a priority
+func decodePri(b []byte) int32 {
+	if len(b) < 4 {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+// Append stores the job of a put record and deletes the job of any other record
+func (s *levelJobStore) Append(op Op, id string, e Entry) error {
+	if op != OpPut {
+		return errors.Wrapf(s.db.Delete(jobKey(id), s.wo), "Store:leveldb failed to delete job %s", id)
+	}
+	data, err := s.cfg.Codec.Encode(e)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(s.db.Put(jobKey(id), data, s.wo), "Store:leveldb failed to store job %s", id)
+}
+
+// Rotate is a noop. The store holds the current jobs only, it has no segments
+func (s *levelJobStore) Rotate(min uint64) (uint64, error) {
+	return min, nil
+}
+
+// Truncate is a noop. The store holds the current jobs only, it has no segments
+func (s *levelJobStore) Truncate(seq uint64) error {
+	return nil
+}
+
+// Replay returns a put record for every stored job
+func (s *levelJobStore) Replay(from uint64) (chan Record, error) {
+	recC := make(chan Record)
+	go func() {
+		defer close(recC)
+		it := s.db.NewIterator(util.BytesPrefix(jobPrefix), nil)
+		defer it.Release()
+		for it.Next() {
+			recC <- Record{
+				Op:   OpPut,
+				ID:   string(it.Key()[len(jobPrefix):]),
+				Data: append([]byte{}, it.Value()...),
+			}
+		}
+		if err := it.Error(); err != nil {
+			log.Error().Err(err).Msg("Store:leveldb failed to read jobs")
+		}
+	}()
+	return recC, nil
+}
+
+func (s *levelJobStore) Recover() (chan Record, error) {
+	batch := new(leveldb.Batch)
+	for _, prefix := range [][]byte{pendingPrefix, readyPrefix} {
+		it := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+		for it.Next() {
+			batch.Delete(append([]byte{}, it.Key()...))
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return nil, errors.Wrap(err, "Store:leveldb failed to read pending index")
+		}
+	}
+	if err := s.db.Write(batch, s.wo); err != nil {
+		return nil, errors.Wrap(err, "Store:leveldb failed to clear pending index")
+	}
+	return s.Replay(0)
+}
+
+func (s *levelJobStore) Get(id string) ([]byte, error) {
+	data, err := s.db.Get(jobKey(id), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	return data, errors.Wrapf(err, "Store:leveldb failed to read job %s", id)
+}
+
+func (s *levelJobStore) Schedule(id string, at time.Time, pri int32) error {
+	err := s.db.Put(pendingKey(id, at), encodePri(pri), s.wo)
+	return errors.Wrapf(err, "Store:leveldb failed to schedule job %s", id)
+}
+
+// Unschedule removes the job from both indexes, it is in one of them
+func (s *levelJobStore) Unschedule(id string, at time.Time, pri int32) error {
+	batch := new(leveldb.Batch)
+	batch.Delete(pendingKey(id, at))
+	batch.Delete(readyKey(id, at, pri))
+	return errors.Wrapf(s.db.Write(batch, s.wo), "Store:leveldb failed to unschedule job %s", id)
+}
+
+func (s *levelJobStore) Next(after time.Time) (string, time.Time, bool, error) {
+	it := s.db.NewIterator(util.BytesPrefix(pendingPrefix), nil)
+	defer it.Release()
+	// Due jobs stay in the pending index till they are moved to the ready index, they are skipped
+	if !it.Seek(pendingKey("", after.Add(time.Nanosecond))) {
+		return "", time.Time{}, false, errors.Wrap(it.Error(), "Store:leveldb failed to read pending index")
+	}
+	id, at := parsePendingKey(it.Key())
+	return id, at, true, nil
+}
+
+func (s *levelJobStore) Ready(now time.Time) (string, time.Time, int32, bool, error) {
+	batch := new(leveldb.Batch)
+	it := s.db.NewIterator(util.BytesPrefix(pendingPrefix), nil)
+	for it.Next() {
+		id, at := parsePendingKey(it.Key())
+		if at.After(now) {
+			break
+		}
+		batch.Delete(append([]byte{}, it.Key()...))
+		batch.Put(readyKey(id, at, decodePri(it.Value())), nil)
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return "", time.Time{}, 0, false, errors.Wrap(err, "Store:leveldb failed to read pending index")
+	}
+	if batch.Len() > 0 {
+		if err := s.db.Write(batch, s.wo); err != nil {
+			return "", time.Time{}, 0, false, errors.Wrap(err, "Store:leveldb failed to move ready jobs")
+		}
+	}
+
+	it = s.db.NewIterator(util.BytesPrefix(readyPrefix), nil)
+	defer it.Release()
+	if !it.First() {
+		return "", time.Time{}, 0, false, errors.Wrap(it.Error(), "Store:leveldb failed to read ready index")
+	}
+	id, at, pri := parseReadyKey(it.Key())
+	return id, at, pri, true, nil
+}
+
+func (s *levelJobStore) Pending(fn func(data []byte) bool) error {
+	// Reads see the db as it was when they started
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return errors.Wrap(err, "Store:leveldb failed to read pending jobs")
+	}
+	defer snap.Release()
+	readyID := func(key []byte) string {
+		id, _, _ := parseReadyKey(key)
+		return id
+	}
+	pendingID := func(key []byte) string {
+		id, _ := parsePendingKey(key)
+		return id
+	}
+	more, err := s.pending(snap, readyPrefix, readyID, fn)
+	if err != nil || !more {
+		return err
+	}
+	_, err = s.pending(snap, pendingPrefix, pendingID, fn)
+	return err
+}
+
+// pending calls fn with the jobs of the index at prefix, whose keys hold ids that idOf parses. Returns false if fn did
+func (s *levelJobStore) pending(snap *leveldb.Snapshot, prefix []byte, idOf func(key []byte) string,
+	fn func(data []byte) bool) (bool, error) {
+	it := snap.NewIterator(util.BytesPrefix(prefix), nil)
+	defer it.Release()
+	for it.Next() {
+		id := idOf(it.Key())
+		data, err := snap.Get(jobKey(id), nil)
+		if err == leveldb.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "Store:leveldb failed to read job %s", id)
+		}
+		if !fn(data) {
+			return false, nil
+		}
+	}
+	return true, errors.Wrap(it.Error(), "Store:leveldb failed to read pending index")
+}
+
+func (s *levelJobStore) Stored(after string, fn func(id string, data []byte) bool) error {
+	it := s.db.NewIterator(util.BytesPrefix(jobPrefix), nil)
+	defer it.Release()
+	ok := it.Seek(jobKey(after))
+	if ok && string(it.Key()[len(jobPrefix):]) == after {
+		ok = it.Next()
+	}
+	for ; ok; ok = it.Next() {
+		if !fn(string(it.Key()[len(jobPrefix):]), append([]byte{}, it.Value()...)) {
+			return nil
+		}
+	}
+	return errors.Wrap(it.Error(), "Store:leveldb failed to read jobs")
+}
+
+func (s *levelJobStore) Close() error {
+	err := s.db.Close()
+	log.Info().Str("dir", s.cfg.queueDir()).Msg("Closed leveldb job store")
+	return err
+}
@@ -0,0 +1,166 @@
+package persistence_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+var _ = Describe("Test job stores", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "chronomq-jobstore")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("stores jobs by id and orders pending jobs by trigger time", func() {
+		s, err := persistence.NewJobStore(persistence.JobStoreConfig{Dir: dir})
+		Expect(err).ToNot(HaveOccurred())
+		defer s.Close()
+
+		now := time.Now()
+		times := map[string]time.Time{
+			"b":   now,
+			"a":   now,
+			"c":   now.Add(-time.Hour),
+			"old": time.Unix(-100, 0),
+			"new": now.Add(time.Hour),
+		}
+		for id, at := range times {
+			Expect(s.Append(persistence.OpPut, id, chronomq.NewJob(id, at, testBody))).To(Succeed())
+			Expect(s.Schedule(id, at, 0)).To(Succeed())
+		}
+		data, err := s.Get("missing")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(BeNil())
+
+		id, at, ok, err := s.Next(time.Unix(-200, 0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(id).To(Equal("old"))
+		Expect(at.Equal(times["old"])).To(BeTrue())
+		// Jobs triggering at or before the given time are skipped
+		id, _, ok, err = s.Next(now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(id).To(Equal("new"))
+
+		Expect(s.Unschedule("old", times["old"], 0)).To(Succeed())
+		Expect(s.Append(persistence.OpConsume, "old", nil)).To(Succeed())
+		data, err = s.Get("old")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(BeNil())
+
+		var ids []string
+		Expect(s.Pending(func(data []byte) bool {
+			j := new(chronomq.Job)
+			Expect(persistence.GobCodec.Decode(data, j)).To(Succeed())
+			Expect(j.Body()).To(Equal(testBody))
+			ids = append(ids, j.ID())
+			return true
+		})).To(Succeed())
+		Expect(ids).To(Equal([]string{"c", "a", "b", "new"}))
+
+		stored := func(after string, n int) []string {
+			ids := []string{}
+			Expect(s.Stored(after, func(id string, data []byte) bool {
+				Expect(data).ToNot(BeEmpty())
+				ids = append(ids, id)
+				return len(ids) < n
+			})).To(Succeed())
+			return ids
+		}
+		Expect(stored("", 10)).To(Equal([]string{"a", "b", "c", "new"}))
+		Expect(stored("a", 2)).To(Equal([]string{"b", "c"}))
+		Expect(stored("bb", 10)).To(Equal([]string{"c", "new"}))
+		Expect(stored("new", 10)).To(BeEmpty())
+	})
+
+	It("takes ready jobs in priority order", func() {
+		s, err := persistence.NewJobStore(persistence.JobStoreConfig{Dir: dir})
+		Expect(err).ToNot(HaveOccurred())
+		defer s.Close()
+
+		now := time.Now()
+		schedule := func(id string, at time.Time, pri int32) {
+			Expect(s.Append(persistence.OpPut, id, chronomq.NewJob(id, at, testBody))).To(Succeed())
+			Expect(s.Schedule(id, at, pri)).To(Succeed())
+		}
+		schedule("low", now.Add(-time.Hour), -1)
+		schedule("early", now.Add(-time.Hour), 0)
+		schedule("late", now.Add(-time.Minute), 0)
+		schedule("high", now, 5)
+		schedule("future", now.Add(time.Hour), 10)
+
+		var ids []string
+		Expect(s.Pending(func(data []byte) bool {
+			j := new(chronomq.Job)
+			Expect(persistence.GobCodec.Decode(data, j)).To(Succeed())
+			ids = append(ids, j.ID())
+			return true
+		})).To(Succeed())
+		Expect(ids).To(Equal([]string{"early", "low", "late", "high", "future"}))
+
+		ids = nil
+		for {
+			id, at, pri, ok, err := s.Ready(now)
+			Expect(err).ToNot(HaveOccurred())
+			if !ok {
+				break
+			}
+			next, _, ok, err := s.Next(now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(next).To(Equal("future"))
+
+			Expect(s.Unschedule(id, at, pri)).To(Succeed())
+			ids = append(ids, id)
+		}
+		Expect(ids).To(Equal([]string{"high", "early", "late", "low"}))
+
+		_, _, _, ok, err := s.Ready(now.Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+	})
+
+	It("clears the pending index when jobs are recovered", func() {
+		cfg := persistence.JobStoreConfig{Dir: dir, Queue: "emails"}
+		s, err := persistence.NewJobStore(cfg)
+		Expect(err).ToNot(HaveOccurred())
+		at := time.Now()
+		for _, id := range []string{"a", "b"} {
+			Expect(s.Append(persistence.OpPut, id, chronomq.NewJob(id, at, testBody))).To(Succeed())
+		}
+		// Index entry of a job whose removal was journaled before a crash
+		Expect(s.Schedule("gone", at, 0)).To(Succeed())
+		Expect(s.Close()).To(Succeed())
+
+		Expect(cfg.Queues()).To(Equal([]string{"emails"}))
+		s, err = persistence.NewJobStore(cfg)
+		Expect(err).ToNot(HaveOccurred())
+		defer s.Close()
+		records, err := s.Recover()
+		Expect(err).ToNot(HaveOccurred())
+		var ids []string
+		for r := range records {
+			Expect(r.Op).To(Equal(persistence.OpPut))
+			ids = append(ids, r.ID)
+		}
+		Expect(ids).To(Equal([]string{"a", "b"}))
+		_, _, ok, err := s.Next(time.Unix(0, 0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+})
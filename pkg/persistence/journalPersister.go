@@ -1,7 +1,6 @@
 package persistence
 
 import (
-	"encoding/gob"
 	"io"
 	"io/ioutil"
 
@@ -12,8 +11,9 @@ import (
 
 // JournalPersister saves data in an embedded Journal store
 type JournalPersister struct {
-	stream  chan gob.GobEncoder // Internal stream so that all writes are ordered
+	stream  chan Entry // Internal stream so that all writes are ordered
 	storage Storage
+	codec   Codec
 	writer  *journal.Writer
 
 	// leveldb journal Writer sadly doesn't propage close to the underlying writer
@@ -22,15 +22,21 @@ type JournalPersister struct {
 	storeWriter io.Closer
 }
 
-// NewJournalPersister initializes a Journal backed persister
+// NewJournalPersister initializes a Journal backed persister that encodes entries with GobCodec
 func NewJournalPersister(s Storage) Persister {
+	return NewJournalPersisterWithCodec(s, GobCodec)
+}
+
+// NewJournalPersisterWithCodec initializes a Journal backed persister that encodes entries with the given codec
+func NewJournalPersisterWithCodec(s Storage, c Codec) Persister {
 	lp := &JournalPersister{
-		stream:  make(chan gob.GobEncoder, 10),
+		stream:  make(chan Entry, 10),
 		storage: s,
+		codec:   c,
 		writer:  nil,
 	}
 
-	log.Info().Str("store", s.String()).Msg("Created Journal persister with store")
+	log.Info().Str("store", s.String()).Str("codec", c.Name()).Msg("Created Journal persister with store")
 	return lp
 }
 
@@ -39,8 +45,35 @@ func (lp *JournalPersister) ResetDataDir() error {
 	return lp.storage.Reset()
 }
 
+// Begin starts a new snapshot if one isn't in progress already
+func (lp *JournalPersister) Begin() error {
+	if lp.writer != nil {
+		return nil
+	}
+	log.Info().Msg("JournalPersister:Begin starting persistence")
+	sw, err := lp.storage.Writer()
+	if err != nil {
+		err = errors.Wrap(err, "JournalPersister:Begin Failed to open store")
+		log.Error().Err(err).Send()
+		return err
+	}
+	lp.storeWriter = sw
+	lp.writer = journal.NewWriter(sw)
+	return nil
+}
+
+// Version returns the version of the latest finalized snapshot
+func (lp *JournalPersister) Version() (uint64, error) {
+	return lp.storage.Version()
+}
+
+// Truncate deletes finalized snapshots older than the given version
+func (lp *JournalPersister) Truncate(version uint64) error {
+	return lp.storage.Truncate(version)
+}
+
 // Finalize tells persister that it can finalize and close writes
-// It is an error to send new items to persist once Finalize has been called
+// Persisting new items after Finalize has been called begins a new snapshot
 func (lp *JournalPersister) Finalize() {
 	log.Info().Msg("JournalPersister:Finalize finalizing persister")
 
@@ -64,13 +97,15 @@ func (lp *JournalPersister) Finalize() {
 			log.Error().Err(err).Msg("JournalPersister:Finalize error closing store writer")
 		}
 	}
+	lp.writer = nil
+	lp.storeWriter = nil
 	log.Info().Msg("JournalPersister:Finalize done")
 }
 
 // Persist stores an entry to given storage
-func (lp *JournalPersister) Persist(enc gob.GobEncoder) error {
+func (lp *JournalPersister) Persist(e Entry) error {
 	log.Debug().Msg("JournalPersister:Persist persisting an entry")
-	err := lp.write(enc)
+	err := lp.write(e)
 	if err != nil {
 		log.Error().Err(err).Send()
 	}
@@ -78,7 +113,7 @@ func (lp *JournalPersister) Persist(enc gob.GobEncoder) error {
 }
 
 // PersistStream listens to the input channel and persists entries to storage
-func (lp *JournalPersister) PersistStream(encC chan gob.GobEncoder) chan error {
+func (lp *JournalPersister) PersistStream(encC chan Entry) chan error {
 	errC := make(chan error)
 	go func() {
 		defer close(errC)
@@ -143,19 +178,10 @@ func (lp *JournalPersister) Recover() (chan []byte, error) {
 	return bufC, nil
 }
 
-func (lp *JournalPersister) write(enc gob.GobEncoder) error {
+func (lp *JournalPersister) write(e Entry) error {
 	// lazy init journal writer
-	if lp.writer == nil {
-		var err error
-		log.Info().Msg("JournalPersister:writer starting persistence")
-		sw, err := lp.storage.Writer()
-		if err != nil {
-			err = errors.Wrap(err, "JournalPersister:writer Failed to open store")
-			log.Error().Err(err).Send()
-			return err
-		}
-		lp.storeWriter = sw
-		lp.writer = journal.NewWriter(sw)
+	if err := lp.Begin(); err != nil {
+		return err
 	}
 
 	w, err := lp.writer.Next()
@@ -165,7 +191,7 @@ func (lp *JournalPersister) write(enc gob.GobEncoder) error {
 		return err
 	}
 
-	buf, err := enc.GobEncode()
+	buf, err := lp.codec.Encode(e)
 	if err != nil {
 		return err
 	}
@@ -1,16 +1,21 @@
 package persistence
 
-import (
-	"encoding/gob"
-)
-
 // Persister saves the data given to it to a durable data store like a disk, S3 buckets, durable streams etc
 type Persister interface {
 	ResetDataDir() error
 
-	Persist(gob.GobEncoder) error
-	PersistStream(chan gob.GobEncoder) chan error
+	// Begin starts a new snapshot. The first Persist call also begins a snapshot
+	// but Begin ensures a snapshot is created even if nothing is persisted before Finalize
+	Begin() error
+	Persist(Entry) error
+	PersistStream(chan Entry) chan error
+	// Finalize completes the current snapshot. Persisting again begins a new snapshot
 	Finalize()
 
+	// Version returns the version of the latest finalized snapshot
+	Version() (uint64, error)
+	// Truncate deletes finalized snapshots older than the given version
+	Truncate(version uint64) error
+
 	Recover() (chan []byte, error)
 }
@@ -0,0 +1,119 @@
+package persistence
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"gocloud.dev/blob"
+)
+
+// SpillStore holds the jobs a hub offloaded from memory. Jobs are written in segments that are read back
+// and deleted once the hub needs them again. Segments are not durable - snapshots and the write-ahead log hold
+// the spilled jobs like any other, so a store is reset when its hub is created
+type SpillStore interface {
+	// Write stores a segment of encoded jobs under the given key
+	Write(key string, jobs [][]byte) error
+	// Read returns the encoded jobs of a segment
+	Read(key string) ([][]byte, error)
+	// Delete deletes a segment
+	Delete(key string) error
+	// Reset deletes all segments
+	Reset() error
+
+	fmt.Stringer
+}
+
+// spillKey prefixes the segments of a queue in the bucket
+var spillKey = "spill/"
+
+type blobSpillStore struct {
+	bucket *blob.Bucket
+	cfg    StoreConfig
+}
+
+// NewSpillStore creates a SpillStore keeping its segments in a bucket, e.g. a local dir
+func NewSpillStore(cfg StoreConfig) (SpillStore, error) {
+	b, err := blob.OpenBucket(context.Background(), cfg.Bucket.String())
+	if err != nil {
+		return nil, err
+	}
+	prefix := spillKey
+	if cfg.Queue != "" {
+		prefix = queuesKey + cfg.Queue + "/" + prefix
+	}
+	return &blobSpillStore{bucket: blob.PrefixedBucket(b, prefix), cfg: cfg}, nil
+}
+
+// InMemSpillStore for integration testing
+func InMemSpillStore() (SpillStore, error) {
+	return NewSpillStore(StoreConfig{Bucket: &url.URL{Scheme: "mem"}})
+}
+
+// Write stores the jobs as a sequence of length prefixed records
+func (s *blobSpillStore) Write(key string, jobs [][]byte) error {
+	w, err := s.bucket.NewWriter(context.Background(), key, nil)
+	if err != nil {
+		return errors.Wrapf(err, "Store:spill cannot write segment %s", key)
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, data := range jobs {
+		n := binary.PutUvarint(buf, uint64(len(data)))
+		if _, err = w.Write(buf[:n]); err == nil {
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			w.Close()
+			return errors.Wrapf(err, "Store:spill cannot write segment %s", key)
+		}
+	}
+	return errors.Wrapf(w.Close(), "Store:spill cannot write segment %s", key)
+}
+
+// Read returns the jobs of a segment in the order they were written
+func (s *blobSpillStore) Read(key string) ([][]byte, error) {
+	data, err := s.bucket.ReadAll(context.Background(), key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Store:spill cannot read segment %s", key)
+	}
+	var jobs [][]byte
+	for len(data) > 0 {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < size {
+			return nil, errors.Errorf("Store:spill segment %s is corrupt", key)
+		}
+		jobs = append(jobs, data[n:n+int(size)])
+		data = data[n+int(size):]
+	}
+	return jobs, nil
+}
+
+func (s *blobSpillStore) Delete(key string) error {
+	return errors.Wrapf(s.bucket.Delete(context.Background(), key), "Store:spill cannot delete segment %s", key)
+}
+
+func (s *blobSpillStore) Reset() error {
+	iter := s.bucket.List(nil)
+	for {
+		obj, err := iter.Next(context.Background())
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "Store:spill cannot list segments")
+		}
+		if err = s.Delete(obj.Key); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *blobSpillStore) String() string {
+	if s.cfg.Queue != "" {
+		return s.cfg.Bucket.String() + " spill queue:" + s.cfg.Queue
+	}
+	return s.cfg.Bucket.String() + " spill"
+}
@@ -0,0 +1,50 @@
+package persistence_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+var _ = Describe("Test spill stores", func() {
+
+	It("reads segments back in order till they are deleted", func() {
+		dir, err := ioutil.TempDir("", "chronomq-spill")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		cfg := persistence.StoreConfig{Bucket: &url.URL{Scheme: "file", Path: dir}}
+		spill, err := persistence.NewSpillStore(cfg)
+		Expect(err).ToNot(HaveOccurred())
+		cfg.Queue = "emails"
+		queueSpill, err := persistence.NewSpillStore(cfg)
+		Expect(err).ToNot(HaveOccurred())
+
+		jobs := [][]byte{testBody, {}, []byte("b")}
+		Expect(spill.Write("1.1", jobs)).To(Succeed())
+		Expect(spill.Write("1.2", jobs[:1])).To(Succeed())
+		Expect(queueSpill.Write("1.1", jobs[2:])).To(Succeed())
+
+		read, err := spill.Read("1.1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read).To(HaveLen(3))
+		for i := range jobs {
+			Expect(read[i]).To(BeEquivalentTo(jobs[i]))
+		}
+		Expect(spill.Delete("1.1")).To(Succeed())
+		_, err = spill.Read("1.1")
+		Expect(err).To(HaveOccurred())
+
+		// Only the segments of the store's queue are reset
+		Expect(spill.Reset()).To(Succeed())
+		_, err = spill.Read("1.2")
+		Expect(err).To(HaveOccurred())
+		read, err = queueSpill.Read("1.1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read).To(Equal([][]byte{[]byte("b")}))
+	})
+})
@@ -10,10 +10,14 @@ import (
 type Storage interface {
 	// Reset deletes any data stored in the storage
 	Reset() error
-	// Writer creates a new io.WriteCloser for the storage
+	// Writer creates a new io.WriteCloser for the next snapshot version in the storage
 	Writer() (io.WriteCloser, error)
-	// Reader creates a new io.ReadCloser for the storage
+	// Reader creates a new io.ReadCloser for the latest snapshot version in the storage
 	Reader() (io.ReadCloser, error)
+	// Version returns the latest snapshot version, 0 if there are no versioned snapshots
+	Version() (uint64, error)
+	// Truncate deletes all snapshots older than the given version
+	Truncate(version uint64) error
 
 	fmt.Stringer
 
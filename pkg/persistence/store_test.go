@@ -3,6 +3,7 @@ package persistence_test
 import (
 	"io/ioutil"
 	"net/url"
+	"os"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -59,5 +60,86 @@ var _ = Describe("Test stores", func() {
 			Expect(j.ID()).To(Equal(jj.ID()))
 			Expect(j.TriggerAt()).To(BeTemporally("==", jj.TriggerAt()))
 		})
+
+		It("versions snapshots and truncates older ones", func() {
+			write := func(data string) {
+				w, err := store.Writer()
+				Expect(err).ToNot(HaveOccurred())
+				_, err = w.Write([]byte(data))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(w.Close()).To(Succeed())
+			}
+			readLatest := func() string {
+				r, err := store.Reader()
+				Expect(err).ToNot(HaveOccurred())
+				defer r.Close()
+				b, err := ioutil.ReadAll(r)
+				Expect(err).ToNot(HaveOccurred())
+				return string(b)
+			}
+
+			v, err := store.Version()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v).To(BeZero())
+
+			write("first")
+			write("second")
+			v, err = store.Version()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v).To(Equal(uint64(2)))
+			Expect(readLatest()).To(Equal("second"))
+
+			Expect(store.Truncate(v)).To(Succeed())
+			v, err = store.Version()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v).To(Equal(uint64(2)))
+			Expect(readLatest()).To(Equal("second"))
+
+			// Versions keep increasing after older ones are deleted
+			write("third")
+			v, err = store.Version()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v).To(Equal(uint64(3)))
+			Expect(readLatest()).To(Equal("third"))
+		})
+	})
+
+	Context("Named queues", func() {
+		It("keeps the data of each queue apart and lists queues", func() {
+			dir, err := ioutil.TempDir("", "chronomqqueues")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			cfg := persistence.StoreConfig{Bucket: &url.URL{Scheme: "file", Path: dir}}
+
+			queues, err := cfg.Queues()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(queues).To(BeEmpty())
+
+			for _, queue := range []string{"", "emails", "carts"} {
+				qcfg := cfg
+				qcfg.Queue = queue
+				store, err := qcfg.Storage()
+				Expect(err).ToNot(HaveOccurred())
+				w, err := store.Writer()
+				Expect(err).ToNot(HaveOccurred())
+				_, err = w.Write([]byte("queue:" + queue))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(w.Close()).To(Succeed())
+			}
+
+			queues, err = cfg.Queues()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(queues).To(Equal([]string{"carts", "emails"}))
+
+			cfg.Queue = "emails"
+			store, err := cfg.Storage()
+			Expect(err).ToNot(HaveOccurred())
+			r, err := store.Reader()
+			Expect(err).ToNot(HaveOccurred())
+			defer r.Close()
+			b, err := ioutil.ReadAll(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(Equal("queue:emails"))
+		})
 	})
 })
@@ -0,0 +1,471 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/syndtr/goleveldb/leveldb/journal"
+)
+
+// Op identifies the hub mutation stored in a write-ahead log record
+type Op byte
+
+const (
+	// OpPut records a job that was added to the hub
+	OpPut Op = iota + 1
+	// OpCancel records a job that was canceled
+	OpCancel
+	// OpConsume records a job that was dequeued for good
+	OpConsume
+)
+
+// Record is a single hub mutation read back from the write-ahead log
+type Record struct {
+	Op   Op
+	ID   string // ID of the job this record applies to
+	Data []byte // Encoded job. Only set for OpPut records
+}
+
+// SyncPolicy decides how often the write-ahead log is fsync'ed to disk
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs after every record. No acknowledged write is lost even if the machine crashes
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs in the background at a fixed interval. A machine crash loses at most one interval of writes
+	SyncInterval
+	// SyncNone leaves flushing to disk to the operating system. Writes only survive a process crash
+	SyncNone
+)
+
+var syncPolicyNames = map[SyncPolicy]string{
+	SyncAlways:   "always",
+	SyncInterval: "interval",
+	SyncNone:     "none",
+}
+
+func (p SyncPolicy) String() string {
+	return syncPolicyNames[p]
+}
+
+// ParseSyncPolicy parses the name of a SyncPolicy: always, interval or none
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	for p, name := range syncPolicyNames {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+	return SyncAlways, fmt.Errorf("Unknown sync policy: %s", s)
+}
+
+// WALConfig configures a write-ahead log
+type WALConfig struct {
+	Dir          string        // Local directory holding the log segments
+	Sync         SyncPolicy    // How often the log is fsync'ed
+	SyncInterval time.Duration // Time between fsyncs when using SyncInterval. Has to be positive for that policy
+	Queue        string        // Named queue whose mutations are logged. Empty for the default queue
+	Codec        Codec         // Encodes the jobs of OpPut records. GobCodec if not set
+}
+
+// walQueuesDir holds the logs of named queues. The default queue's log is kept in the root of the log dir
+const walQueuesDir = "queues"
+
+// queueDir returns the directory holding the log segments of the configured queue
+func (cfg WALConfig) queueDir() string {
+	if cfg.Queue == "" {
+		return cfg.Dir
+	}
+	return filepath.Join(cfg.Dir, walQueuesDir, cfg.Queue)
+}
+
+// Queues lists the named queues that have a log in the log dir
+func (cfg WALConfig) Queues() ([]string, error) {
+	queues, err := listQueueDirs(cfg.Dir)
+	return queues, errors.Wrap(err, "WAL: Failed to list queues")
+}
+
+// listQueueDirs lists the named queues that have a dir under the queues dir of dir
+func listQueueDirs(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(dir, walQueuesDir))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	queues := []string{}
+	for _, info := range infos {
+		if info.IsDir() {
+			queues = append(queues, info.Name())
+		}
+	}
+	return queues, nil
+}
+
+// WAL is a write-ahead log of hub mutations split into numbered segments.
+// Replaying it on top of a snapshot rebuilds the hub state after a crash.
+// It is safe to call methods on WAL from multiple goroutines
+type WAL interface {
+	// Append writes a record to the current segment. e is only used for OpPut records
+	Append(op Op, id string, e Entry) error
+	// Rotate closes the current segment and starts a new one numbered min or higher, so that every record
+	// appended after Rotate returns is in a segment numbered min or higher. Returns the new segment's number
+	Rotate(min uint64) (uint64, error)
+	// Truncate deletes closed segments numbered lower than seq
+	Truncate(seq uint64) error
+	// Replay reads back the records of closed segments numbered from or higher, oldest first
+	Replay(from uint64) (chan Record, error)
+	// Close flushes and closes the log
+	Close() error
+}
+
+const walSegmentPrefix = "wal."
+
+// fileWAL keeps the log as a sequence of leveldb journal files (segments) in a local directory.
+// Every time a fileWAL is opened, it starts writing a new segment
+type fileWAL struct {
+	cfg WALConfig
+	dir string // directory of the configured queue's segments
+
+	segments []uint64 // closed segments in ascending order
+	seq      uint64   // segment currently being written to
+	records  int      // number of records in the current segment
+
+	file   *os.File
+	writer *journal.Writer
+	dirty  bool // true if there are writes that haven't been fsync'ed yet
+
+	lock *sync.Mutex
+	stop chan struct{}
+}
+
+// NewWAL opens a write-ahead log in the configured directory
+func NewWAL(cfg WALConfig) (WAL, error) {
+	if cfg.Sync == SyncInterval && cfg.SyncInterval <= 0 {
+		return nil, fmt.Errorf("WAL: Sync interval must be positive, got %s", cfg.SyncInterval)
+	}
+	dir := cfg.queueDir()
+	err := os.MkdirAll(dir, os.ModeDir|os.FileMode(0755))
+	if err != nil {
+		return nil, errors.Wrap(err, "WAL: Failed to create log dir")
+	}
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Codec == nil {
+		cfg.Codec = GobCodec
+	}
+	w := &fileWAL{
+		cfg:      cfg,
+		dir:      dir,
+		segments: segments,
+		lock:     &sync.Mutex{},
+		stop:     make(chan struct{}),
+	}
+	if len(segments) > 0 {
+		w.seq = segments[len(segments)-1] + 1
+	}
+	if err = w.openSegment(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Sync == SyncInterval {
+		go w.syncer()
+	}
+
+	log.Info().Str("dir", dir).
+		Str("sync", cfg.Sync.String()).
+		Str("codec", cfg.Codec.Name()).
+		Uint64("segment", w.seq).
+		Int("existingSegments", len(segments)).
+		Msg("Opened write-ahead log")
+	return w, nil
+}
+
+func (w *fileWAL) openSegment() error {
+	f, err := os.OpenFile(w.segmentPath(w.seq), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "WAL: Failed to create segment")
+	}
+	w.file = f
+	w.writer = journal.NewWriter(f)
+	w.records = 0
+	return nil
+}
+
+// closeSegment flushes, fsyncs and closes the current segment. Lock the WAL before calling this
+func (w *fileWAL) closeSegment() error {
+	err := w.writer.Close()
+	if err == nil {
+		w.dirty = true
+		err = w.sync()
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.file = nil
+	return err
+}
+
+func (w *fileWAL) segmentPath(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%s%d", walSegmentPrefix, seq))
+}
+
+// Append encodes and writes a record to the current segment
+func (w *fileWAL) Append(op Op, id string, e Entry) error {
+	var data []byte
+	if op == OpPut {
+		var err error
+		data, err = w.cfg.Codec.Encode(e)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	jw, err := w.writer.Next()
+	if err != nil {
+		return errors.Wrap(err, "WAL: Failed to get next journal writer")
+	}
+	if _, err = jw.Write(encodeRecord(op, id, data)); err != nil {
+		return errors.Wrap(err, "WAL: Failed to write record")
+	}
+	w.records++
+	// Always hand the record to the OS so that it survives a process crash
+	if err = w.writer.Flush(); err != nil {
+		return errors.Wrap(err, "WAL: Failed to flush record")
+	}
+	w.dirty = true
+	if w.cfg.Sync == SyncAlways {
+		return w.sync()
+	}
+	return nil
+}
+
+// sync fsyncs the current segment. Lock the WAL before calling this
+func (w *fileWAL) sync() error {
+	if !w.dirty {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return errors.Wrap(err, "WAL: Failed to sync segment")
+	}
+	w.dirty = false
+	return nil
+}
+
+// syncer periodically fsyncs the log till the WAL is closed
+func (w *fileWAL) syncer() {
+	t := time.NewTicker(w.cfg.SyncInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-t.C:
+			w.lock.Lock()
+			if err := w.sync(); err != nil {
+				log.Error().Err(err).Msg("WAL:syncer")
+			}
+			w.lock.Unlock()
+		}
+	}
+}
+
+// Rotate starts a new segment. It is a noop if the current segment is empty and already numbered min or higher
+func (w *fileWAL) Rotate(min uint64) (uint64, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return 0, errors.New("WAL: Cannot rotate closed log")
+	}
+	if w.records == 0 && w.seq >= min {
+		return w.seq, nil
+	}
+
+	if err := w.closeSegment(); err != nil {
+		return 0, err
+	}
+	w.segments = append(w.segments, w.seq)
+	w.seq++
+	if w.seq < min {
+		w.seq = min
+	}
+	if err := w.openSegment(); err != nil {
+		return 0, err
+	}
+	log.Info().Uint64("segment", w.seq).Msg("WAL:Rotate started new segment")
+	return w.seq, nil
+}
+
+// Truncate deletes closed segments numbered lower than seq
+func (w *fileWAL) Truncate(seq uint64) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	kept := []uint64{}
+	for _, s := range w.segments {
+		if s >= seq {
+			kept = append(kept, s)
+			continue
+		}
+		if err := os.Remove(w.segmentPath(s)); err != nil && !os.IsNotExist(err) {
+			kept = append(kept, s)
+			log.Error().Err(err).Uint64("segment", s).Msg("WAL:Truncate failed to delete segment")
+		}
+	}
+	log.Info().Int("deleted", len(w.segments)-len(kept)).Uint64("before", seq).Msg("WAL:Truncate deleted segments")
+	w.segments = kept
+	return nil
+}
+
+// Replay streams the records of closed segments numbered from or higher, oldest first
+func (w *fileWAL) Replay(from uint64) (chan Record, error) {
+	w.lock.Lock()
+	segments := []uint64{}
+	for _, seq := range w.segments {
+		if seq >= from {
+			segments = append(segments, seq)
+		}
+	}
+	w.lock.Unlock()
+	log.Info().Int("segments", len(segments)).Uint64("from", from).Msg("WAL:Replay starting replay")
+
+	recC := make(chan Record)
+	go func() {
+		defer close(recC)
+		count := 0
+		for _, seq := range segments {
+			n, err := w.replaySegment(seq, recC)
+			count += n
+			if err != nil {
+				log.Error().Err(err).Uint64("segment", seq).Msg("WAL:Replay failed to replay segment")
+			}
+		}
+		log.Info().Int("recordCount", count).Msg("WAL:Replay finished replay")
+	}()
+	return recC, nil
+}
+
+func (w *fileWAL) replaySegment(seq uint64, recC chan Record) (int, error) {
+	f, err := os.Open(w.segmentPath(seq))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	count := 0
+	r := journal.NewReader(f, nil, false, true)
+	for {
+		jr, err := r.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		buf, err := ioutil.ReadAll(jr)
+		if err != nil {
+			// Torn write at the end of a segment
+			log.Debug().Err(err).Uint64("segment", seq).Msg("WAL:Replay skipping unreadable record")
+			continue
+		}
+		rec, err := decodeRecord(buf)
+		if err != nil {
+			log.Error().Err(err).Uint64("segment", seq).Msg("WAL:Replay skipping undecodable record")
+			continue
+		}
+		recC <- rec
+		count++
+	}
+}
+
+// Close flushes, fsyncs and closes the current segment
+func (w *fileWAL) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	close(w.stop)
+
+	err := w.closeSegment()
+	log.Info().Str("dir", w.dir).Msg("Closed write-ahead log")
+	return err
+}
+
+// listSegments returns the sequence numbers of all segments in dir in ascending order
+func listSegments(dir string) ([]uint64, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "WAL: Failed to list segments")
+	}
+	segments := []uint64{}
+	for _, f := range files {
+		var seq uint64
+		if f.IsDir() || !strings.HasPrefix(f.Name(), walSegmentPrefix) {
+			continue
+		}
+		if _, err := fmt.Sscanf(f.Name(), walSegmentPrefix+"%d", &seq); err != nil {
+			log.Warn().Str("file", f.Name()).Msg("WAL: Ignoring unknown file in log dir")
+			continue
+		}
+		segments = append(segments, seq)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+// encodeRecord lays out a record as: op | uvarint id length | id | data
+func encodeRecord(op Op, id string, data []byte) []byte {
+	buf := make([]byte, 1+binary.MaxVarintLen64+len(id)+len(data))
+	buf[0] = byte(op)
+	n := 1 + binary.PutUvarint(buf[1:], uint64(len(id)))
+	n += copy(buf[n:], id)
+	n += copy(buf[n:], data)
+	return buf[:n]
+}
+
+func decodeRecord(buf []byte) (Record, error) {
+	r := bytes.NewReader(buf)
+	op, err := r.ReadByte()
+	if err != nil {
+		return Record{}, err
+	}
+	idLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Record{}, err
+	}
+	if idLen > uint64(r.Len()) {
+		return Record{}, errors.New("WAL: Record id overflows record")
+	}
+	rec := Record{Op: Op(op)}
+	id := make([]byte, idLen)
+	r.Read(id)
+	rec.ID = string(id)
+	if r.Len() > 0 {
+		rec.Data = make([]byte, r.Len())
+		r.Read(rec.Data)
+	}
+	switch rec.Op {
+	case OpPut, OpCancel, OpConsume:
+		return rec, nil
+	default:
+		return Record{}, fmt.Errorf("WAL: Unknown record op: %d", op)
+	}
+}
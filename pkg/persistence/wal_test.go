@@ -0,0 +1,156 @@
+package persistence_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+var _ = Describe("Test write-ahead log", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "chronomqwal")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	readFrom := func(w persistence.WAL, from uint64) []persistence.Record {
+		records, err := w.Replay(from)
+		Expect(err).ToNot(HaveOccurred())
+		all := []persistence.Record{}
+		for r := range records {
+			all = append(all, r)
+		}
+		return all
+	}
+	readAll := func(w persistence.WAL) []persistence.Record {
+		return readFrom(w, 0)
+	}
+
+	It("parses sync policies", func() {
+		for _, name := range []string{"always", "interval", "none"} {
+			p, err := persistence.ParseSyncPolicy(name)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.String()).To(Equal(name))
+		}
+		_, err := persistence.ParseSyncPolicy("sometimes")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects non-positive sync intervals for the interval sync policy", func() {
+		for _, interval := range []time.Duration{0, -time.Second} {
+			_, err := persistence.NewWAL(persistence.WALConfig{Dir: dir, Sync: persistence.SyncInterval, SyncInterval: interval})
+			Expect(err).To(HaveOccurred())
+		}
+		w, err := persistence.NewWAL(persistence.WALConfig{Dir: dir, Sync: persistence.SyncNone})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Close()).To(Succeed())
+	})
+
+	It("replays records written before it was opened", func(done Done) {
+		defer close(done)
+
+		for _, policy := range []persistence.SyncPolicy{persistence.SyncAlways, persistence.SyncInterval, persistence.SyncNone} {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+			cfg := persistence.WALConfig{Dir: dir, Sync: policy, SyncInterval: time.Millisecond}
+			w, err := persistence.NewWAL(cfg)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Nothing to replay in a new log
+			Expect(readAll(w)).To(BeEmpty())
+
+			j := chronomq.NewJobAutoID(time.Now(), testBody)
+			Expect(w.Append(persistence.OpPut, j.ID(), j)).To(Succeed())
+			Expect(w.Append(persistence.OpCancel, j.ID(), nil)).To(Succeed())
+			Expect(w.Append(persistence.OpConsume, "other", nil)).To(Succeed())
+			Expect(w.Close()).To(Succeed())
+
+			w, err = persistence.NewWAL(cfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.Append(persistence.OpConsume, "not replayed yet", nil)).To(Succeed())
+
+			records := readAll(w)
+			Expect(records).To(HaveLen(3))
+			Expect(records[0].Op).To(Equal(persistence.OpPut))
+			Expect(records[0].ID).To(Equal(j.ID()))
+			rj := &chronomq.Job{}
+			Expect(rj.GobDecode(records[0].Data)).To(Succeed())
+			Expect(rj.Body()).To(Equal(testBody))
+			Expect(records[1]).To(Equal(persistence.Record{Op: persistence.OpCancel, ID: j.ID()}))
+			Expect(records[2]).To(Equal(persistence.Record{Op: persistence.OpConsume, ID: "other"}))
+			Expect(w.Close()).To(Succeed())
+
+			// Records span segments
+			w, err = persistence.NewWAL(cfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readAll(w)).To(HaveLen(4))
+			Expect(w.Close()).To(Succeed())
+		}
+	}, 5)
+
+	It("rotates and truncates segments", func() {
+		w, err := persistence.NewWAL(persistence.WALConfig{Dir: dir, Sync: persistence.SyncNone})
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+
+		// Rotating an empty segment that is already numbered high enough is a noop
+		first, err := w.Rotate(0)
+		Expect(err).ToNot(HaveOccurred())
+		seq, err := w.Rotate(0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(seq).To(Equal(first))
+
+		Expect(w.Append(persistence.OpConsume, "a", nil)).To(Succeed())
+		second, err := w.Rotate(first + 5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(second).To(Equal(first + 5))
+
+		Expect(w.Append(persistence.OpConsume, "b", nil)).To(Succeed())
+		third, err := w.Rotate(0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(third).To(Equal(second + 1))
+
+		Expect(readAll(w)).To(HaveLen(2))
+		Expect(readFrom(w, second)).To(Equal([]persistence.Record{{Op: persistence.OpConsume, ID: "b"}}))
+
+		Expect(w.Truncate(second)).To(Succeed())
+		Expect(readAll(w)).To(Equal([]persistence.Record{{Op: persistence.OpConsume, ID: "b"}}))
+		segments, err := filepath.Glob(filepath.Join(dir, "wal.*"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(segments).To(HaveLen(2))
+	})
+
+	It("keeps the log of each queue apart and lists queues", func() {
+		queues, err := persistence.WALConfig{Dir: dir}.Queues()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(queues).To(BeEmpty())
+
+		for _, queue := range []string{"", "emails", "carts"} {
+			w, err := persistence.NewWAL(persistence.WALConfig{Dir: dir, Sync: persistence.SyncNone, Queue: queue})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.Append(persistence.OpConsume, "from "+queue, nil)).To(Succeed())
+			Expect(w.Close()).To(Succeed())
+		}
+
+		queues, err = persistence.WALConfig{Dir: dir}.Queues()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(queues).To(ConsistOf("carts", "emails"))
+
+		w, err := persistence.NewWAL(persistence.WALConfig{Dir: dir, Sync: persistence.SyncNone, Queue: "emails"})
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+		Expect(readAll(w)).To(Equal([]persistence.Record{{Op: persistence.OpConsume, ID: "from emails"}}))
+	})
+})
@@ -0,0 +1,247 @@
+package protocol
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/chronomq/chronomq/api/grpc/chronomq"
+	api "github.com/chronomq/chronomq/api/rpc/chronomq"
+	"github.com/chronomq/chronomq/pkg/chronomq"
+)
+
+// GRPCServer exposes the same operations as RPCServer over gRPC
+type GRPCServer struct {
+	rpc *RPCServer
+}
+
+func newGRPCServer(queues *chronomq.QueueSet) *GRPCServer {
+	return &GRPCServer{rpc: newRPCServer(queues)}
+}
+
+// Put accepts a new job with a generated id and stores it in the hub of the job's queue
+func (g *GRPCServer) Put(ctx context.Context, job *pb.Job) (*pb.PutReply, error) {
+	if job.Id != "" {
+		return nil, status.Error(codes.InvalidArgument, "Put generates job ids, use PutWithID to set one")
+	}
+	return g.put(job)
+}
+
+// PutWithID accepts a new job with the given id and stores it in the hub of the job's queue
+func (g *GRPCServer) PutWithID(ctx context.Context, job *pb.Job) (*pb.PutReply, error) {
+	if job.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "Job id is required")
+	}
+	return g.put(job)
+}
+
+func (g *GRPCServer) put(job *pb.Job) (*pb.PutReply, error) {
+	rpcJob, err := fromProtoJob(job)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	id := rpcJob.ID
+	if err = g.rpc.PutWithID(rpcJob, &id); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.PutReply{Id: id}, nil
+}
+
+// Cancel deletes a job. If the job doesn't exist, no error is returned so calls to Cancel are idempotent
+func (g *GRPCServer) Cancel(ctx context.Context, ref *pb.JobRef) (*pb.Empty, error) {
+	var ignoredReply int8
+	err := g.rpc.CancelIn(api.Job{ID: ref.Id, Queue: ref.Queue}, &ignoredReply)
+	return &pb.Empty{}, toStatus(err)
+}
+
+// Next returns a job that is ready in any of the requested queues. It waits at most the given timeout
+// for a job to become ready and fails with DeadlineExceeded if none did
+func (g *GRPCServer) Next(ctx context.Context, req *pb.NextRequest) (*pb.Job, error) {
+	var timeout time.Duration
+	if req.Timeout != nil {
+		var err error
+		if timeout, err = ptypes.Duration(req.Timeout); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	job := api.Job{}
+	if _, err := g.rpc.waitNext(ctx, api.NextArgs{Timeout: timeout, Queues: req.Queues}, &job); err != nil {
+		return nil, toStatus(err)
+	}
+	return toProtoJob(&job), nil
+}
+
+// Ack deletes a reserved job once the consumer has finished working on it
+func (g *GRPCServer) Ack(ctx context.Context, ref *pb.JobRef) (*pb.Empty, error) {
+	var ignoredReply int8
+	err := g.rpc.Ack(api.Job{ID: ref.Id, Queue: ref.Queue}, &ignoredReply)
+	return &pb.Empty{}, toStatus(err)
+}
+
+// Release puts a reserved job back into its queue to be ready again after the given delay
+func (g *GRPCServer) Release(ctx context.Context, req *pb.ReleaseRequest) (*pb.Empty, error) {
+	var delay time.Duration
+	if req.Delay != nil {
+		var err error
+		if delay, err = ptypes.Duration(req.Delay); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	var ignoredReply int8
+	err := g.rpc.Release(api.Job{ID: req.Id, Queue: req.Queue, Delay: delay}, &ignoredReply)
+	return &pb.Empty{}, toStatus(err)
+}
+
+// Touch restarts the TTR of a reserved job
+func (g *GRPCServer) Touch(ctx context.Context, ref *pb.JobRef) (*pb.Empty, error) {
+	var ignoredReply int8
+	err := g.rpc.Touch(api.Job{ID: ref.Id, Queue: ref.Queue}, &ignoredReply)
+	return &pb.Empty{}, toStatus(err)
+}
+
+// Ping replies with "pong"
+func (g *GRPCServer) Ping(ctx context.Context, _ *pb.Empty) (*pb.PingReply, error) {
+	var pong string
+	err := g.rpc.Ping(0, &pong)
+	return &pb.PingReply{Pong: pong}, toStatus(err)
+}
+
+// InspectN returns up to n jobs of a queue without removing them for ad-hoc inspection
+func (g *GRPCServer) InspectN(ctx context.Context, req *pb.InspectRequest) (*pb.InspectReply, error) {
+	rpcJobs := []*api.Job{}
+	if err := g.rpc.InspectQueue(api.InspectArgs{N: int(req.N), Queue: req.Queue}, &rpcJobs); err != nil {
+		return nil, toStatus(err)
+	}
+	reply := &pb.InspectReply{Jobs: make([]*pb.Job, 0, len(rpcJobs))}
+	for _, j := range rpcJobs {
+		reply.Jobs = append(reply.Jobs, toProtoJob(j))
+	}
+	return reply, nil
+}
+
+// Queues lists the names of all queues
+func (g *GRPCServer) Queues(ctx context.Context, _ *pb.Empty) (*pb.QueuesReply, error) {
+	reply := &pb.QueuesReply{}
+	err := g.rpc.Queues(0, &reply.Queues)
+	return reply, toStatus(err)
+}
+
+// Subscribe streams jobs from the requested queues as soon as they are ready, till the client goes away.
+// A job that cannot be sent is put back into its queue
+func (g *GRPCServer) Subscribe(req *pb.SubscribeRequest, stream pb.Chronomq_SubscribeServer) error {
+	queues := watched(req.Queues)
+	log.Debug().Strs("queues", queues).Msg("GRPC:Subscribe client subscribed")
+	for {
+		job := api.Job{}
+		var taken *chronomq.Job
+		if err := g.rpc.wait(stream.Context(), g.rpc.queues, queues, func() bool {
+			taken = g.rpc.next(g.rpc.queues, queues, &job)
+			return taken != nil
+		}); err != nil {
+			log.Debug().Strs("queues", queues).Msg("GRPC:Subscribe client went away")
+			return nil
+		}
+		if err := stream.Send(toProtoJob(&job)); err != nil {
+			if err := g.rpc.putBack(taken, job.Queue); err != nil {
+				log.Error().Err(err).Str("jobID", job.ID).Str("queue", job.Queue).Msg("GRPC:Subscribe cannot put back undelivered job")
+			}
+			return err
+		}
+	}
+}
+
+// toStatus converts errors of the RPC operations to gRPC status errors
+func toStatus(err error) error {
+	switch errors.Cause(err) {
+	case nil:
+		return nil
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	case chronomq.ErrJobExists:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case ErrTimeout:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case chronomq.ErrJobNotReserved:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case chronomq.ErrInvalidQueueName, ErrInvalidTriggerAt, ErrDelayAndTriggerAt:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case chronomq.ErrUnknownQueue:
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+func toProtoJob(j *api.Job) *pb.Job {
+	var triggerAt *timestamp.Timestamp
+	if !j.TriggerAt.IsZero() {
+		// Times within the range of the Timestamp type always convert
+		triggerAt, _ = ptypes.TimestampProto(j.TriggerAt)
+	}
+	return &pb.Job{
+		TriggerAt: triggerAt,
+		Id:        j.ID,
+		Body:      j.Body,
+		Delay:     ptypes.DurationProto(j.Delay),
+		Ttr:       ptypes.DurationProto(j.TTR),
+		Pri:       j.Pri,
+		Queue:     j.Queue,
+		Tags:      j.Tags,
+		Headers:   j.Headers,
+	}
+}
+
+func fromProtoJob(j *pb.Job) (api.Job, error) {
+	rpcJob := api.Job{ID: j.Id, Body: j.Body, Pri: j.Pri, Queue: j.Queue, Tags: j.Tags, Headers: j.Headers}
+	var err error
+	if j.Delay != nil {
+		if rpcJob.Delay, err = ptypes.Duration(j.Delay); err != nil {
+			return rpcJob, err
+		}
+	}
+	if j.Ttr != nil {
+		if rpcJob.TTR, err = ptypes.Duration(j.Ttr); err != nil {
+			return rpcJob, err
+		}
+	}
+	if j.TriggerAt != nil {
+		if rpcJob.TriggerAt, err = ptypes.Timestamp(j.TriggerAt); err != nil {
+			return rpcJob, err
+		}
+	}
+	return rpcJob, nil
+}
+
+// grpcCloser stops a gRPC server
+type grpcCloser struct {
+	srv *grpc.Server
+}
+
+func (c grpcCloser) Close() error {
+	c.srv.Stop()
+	return nil
+}
+
+// ServeGRPC starts serving all queues of the queue set over gRPC
+func ServeGRPC(queues *chronomq.QueueSet, addr string) (io.Closer, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := grpc.NewServer()
+	pb.RegisterChronomqServer(srv, newGRPCServer(queues))
+	go func() {
+		if err := srv.Serve(l); err != nil {
+			log.Error().Err(err).Msg("GRPC server has stopped")
+		}
+	}()
+	return grpcCloser{srv: srv}, nil
+}
@@ -0,0 +1,350 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	api "github.com/chronomq/chronomq/api/rpc/chronomq"
+	"github.com/chronomq/chronomq/pkg/chronomq"
+)
+
+const (
+	// maxHTTPBodySize limits the size of a job put over http
+	maxHTTPBodySize = 16 << 20
+	// defaultInspectLimit is the number of jobs GET /jobs returns if no limit is given
+	defaultInspectLimit = 10
+)
+
+// HTTPJob is a job in the JSON documents of the HTTP API. Body is base64 encoded
+type HTTPJob struct {
+	ID        string            `json:"id,omitempty"`
+	Body      []byte            `json:"body"`
+	Delay     JSONDuration      `json:"delay,omitempty"`     // Trigger delay relative to now
+	TriggerAt *time.Time        `json:"triggerAt,omitempty"` // Absolute trigger time. Cannot be used together with Delay
+	TTR       JSONDuration      `json:"ttr,omitempty"`
+	Pri       int32             `json:"pri,omitempty"`
+	Queue     string            `json:"queue,omitempty"`
+	ExpireAt  *time.Time        `json:"expireAt,omitempty"` // When the job expires if it hasn't been consumed
+	Tags      []string          `json:"tags,omitempty"`     // Labels to cancel jobs by, see RPCServer.CancelByTag
+	Headers   map[string]string `json:"headers,omitempty"`  // Carried with the job, e.g. for consumers to route on
+}
+
+// JSONDuration is a time.Duration that is written to and read from JSON as a Go duration string like "1m30s"
+type JSONDuration time.Duration
+
+// MarshalJSON writes the duration as a string
+func (d JSONDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON reads a duration string
+func (d *JSONDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New("Durations must be strings like \"1m30s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = JSONDuration(v)
+	return nil
+}
+
+type httpError struct {
+	Error string `json:"error"`
+}
+
+type httpPutReply struct {
+	ID string `json:"id"`
+}
+
+// HTTPServer exposes the same operations as RPCServer as a JSON API
+//
+//	POST   /jobs                          put a job, replies 201 with the job id or 409 if the id exists
+//	DELETE /jobs/{id}?queue=              cancel a job, replies 204
+//	GET    /jobs/next?timeout=&queue=     take the next ready job, replies 204 if none was ready within timeout
+//	POST   /jobs/{id}/ack?queue=          acknowledge a reserved job
+//	POST   /jobs/{id}/release?queue=&delay=  release a reserved job
+//	POST   /jobs/{id}/touch?queue=        restart the TTR of a reserved job
+//	GET    /jobs?limit=&queue=            inspect up to limit jobs without consuming them
+//	GET    /queues                        list the queues
+//	GET    /healthz                       liveness check
+//
+// The queue parameter of GET /jobs/next can be repeated to take jobs from several queues.
+// A job taken by GET /jobs/next is put back if its reply cannot be written or the client went away. Replies lost
+// after they were written to the connection go unnoticed, so jobs without a TTR are delivered at most once
+type HTTPServer struct {
+	rpc *RPCServer
+}
+
+// NewHTTPServer creates an http.Handler serving all queues of the queue set
+func NewHTTPServer(queues *chronomq.QueueSet) *HTTPServer {
+	return &HTTPServer{rpc: newRPCServer(queues)}
+}
+
+// ServeHTTP routes requests of the HTTP API
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i, seg := range segments {
+		var err error
+		if segments[i], err = url.PathUnescape(seg); err != nil {
+			writeHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	switch {
+	case len(segments) == 1 && segments[0] == "healthz":
+		if allowMethods(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		}
+	case len(segments) == 1 && segments[0] == "queues":
+		if allowMethods(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, s.queues())
+		}
+	case len(segments) == 1 && segments[0] == "jobs":
+		if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+			return
+		}
+		if r.Method == http.MethodPost {
+			s.put(w, r)
+		} else {
+			s.inspect(w, r)
+		}
+	case len(segments) == 2 && segments[0] == "jobs" && segments[1] == "next" && r.Method == http.MethodGet:
+		s.next(w, r)
+	case len(segments) == 2 && segments[0] == "jobs":
+		if allowMethods(w, r, http.MethodDelete) {
+			s.cancel(w, r, segments[1])
+		}
+	case len(segments) == 3 && segments[0] == "jobs":
+		if allowMethods(w, r, http.MethodPost) {
+			s.reserved(w, r, segments[1], segments[2])
+		}
+	default:
+		writeHTTPError(w, http.StatusNotFound, errors.New("Not found"))
+	}
+}
+
+func (s *HTTPServer) put(w http.ResponseWriter, r *http.Request) {
+	job := HTTPJob{}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHTTPBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&job); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, errors.Wrap(err, "Invalid job"))
+		return
+	}
+
+	rpcJob := api.Job{
+		ID:      job.ID,
+		Body:    job.Body,
+		Delay:   time.Duration(job.Delay),
+		TTR:     time.Duration(job.TTR),
+		Pri:     job.Pri,
+		Queue:   job.Queue,
+		Tags:    job.Tags,
+		Headers: job.Headers,
+	}
+	if job.TriggerAt != nil {
+		rpcJob.TriggerAt = *job.TriggerAt
+	}
+	if job.ExpireAt != nil {
+		rpcJob.ExpireAt = *job.ExpireAt
+	}
+
+	id := rpcJob.ID
+	if err := s.rpc.PutWithID(rpcJob, &id); err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, httpPutReply{ID: id})
+}
+
+func (s *HTTPServer) cancel(w http.ResponseWriter, r *http.Request, id string) {
+	var ignoredReply int8
+	if err := s.rpc.CancelIn(api.Job{ID: id, Queue: r.URL.Query().Get("queue")}, &ignoredReply); err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *HTTPServer) next(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var timeout time.Duration
+	if t := query.Get("timeout"); t != "" {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil {
+			writeHTTPError(w, http.StatusBadRequest, errors.Wrap(err, "Invalid timeout"))
+			return
+		}
+	}
+
+	job := api.Job{}
+	taken, err := s.rpc.waitNext(r.Context(), api.NextArgs{Timeout: timeout, Queues: query["queue"]}, &job)
+	switch errors.Cause(err) {
+	case nil:
+		if err := writeJSON(w, http.StatusOK, toHTTPJob(&job)); err != nil || r.Context().Err() != nil {
+			if err := s.rpc.putBack(taken, job.Queue); err != nil {
+				log.Error().Err(err).Str("jobID", job.ID).Str("queue", job.Queue).Msg("HTTP: Cannot put back undelivered job")
+			}
+		}
+	case ErrTimeout:
+		w.WriteHeader(http.StatusNoContent)
+	case context.Canceled:
+		// client went away, nobody to reply to
+	default:
+		writeHTTPError(w, httpStatus(err), err)
+	}
+}
+
+// reserved runs an action on a reserved job
+func (s *HTTPServer) reserved(w http.ResponseWriter, r *http.Request, id, action string) {
+	query := r.URL.Query()
+	rpcJob := api.Job{ID: id, Queue: query.Get("queue")}
+	var ignoredReply int8
+	var err error
+	switch action {
+	case "ack":
+		err = s.rpc.Ack(rpcJob, &ignoredReply)
+	case "touch":
+		err = s.rpc.Touch(rpcJob, &ignoredReply)
+	case "release":
+		if d := query.Get("delay"); d != "" {
+			if rpcJob.Delay, err = time.ParseDuration(d); err != nil {
+				writeHTTPError(w, http.StatusBadRequest, errors.Wrap(err, "Invalid delay"))
+				return
+			}
+		}
+		err = s.rpc.Release(rpcJob, &ignoredReply)
+	default:
+		writeHTTPError(w, http.StatusNotFound, errors.New("Not found"))
+		return
+	}
+	if err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *HTTPServer) inspect(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultInspectLimit
+	if l := query.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			writeHTTPError(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+			return
+		}
+	}
+
+	rpcJobs := []*api.Job{}
+	if err := s.rpc.InspectQueue(api.InspectArgs{N: limit, Queue: query.Get("queue")}, &rpcJobs); err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+	jobs := make([]HTTPJob, 0, len(rpcJobs))
+	for _, j := range rpcJobs {
+		jobs = append(jobs, toHTTPJob(j))
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *HTTPServer) queues() []string {
+	var queues []string
+	s.rpc.Queues(0, &queues)
+	return queues
+}
+
+func toHTTPJob(j *api.Job) HTTPJob {
+	var triggerAt *time.Time
+	if !j.TriggerAt.IsZero() {
+		triggerAt = &j.TriggerAt
+	}
+	var expireAt *time.Time
+	if !j.ExpireAt.IsZero() {
+		expireAt = &j.ExpireAt
+	}
+	return HTTPJob{
+		TriggerAt: triggerAt,
+		ExpireAt:  expireAt,
+		ID:        j.ID,
+		Body:      j.Body,
+		Delay:     JSONDuration(j.Delay),
+		TTR:       JSONDuration(j.TTR),
+		Pri:       j.Pri,
+		Queue:     j.Queue,
+		Tags:      j.Tags,
+		Headers:   j.Headers,
+	}
+}
+
+// httpStatus maps errors of the RPC operations to http status codes
+func httpStatus(err error) int {
+	switch errors.Cause(err) {
+	case chronomq.ErrJobExists:
+		return http.StatusConflict
+	case chronomq.ErrJobNotReserved:
+		return http.StatusConflict
+	case chronomq.ErrInvalidQueueName, ErrInvalidTriggerAt, ErrDelayAndTriggerAt, ErrInvalidDuplicatePolicy,
+		chronomq.ErrInvalidExpiry:
+		return http.StatusBadRequest
+	case chronomq.ErrUnknownQueue:
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// allowMethods replies with 405 if the request method is not one of the given methods
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeHTTPError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+	return false
+}
+
+func writeHTTPError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, httpError{Error: err.Error()})
+}
+
+// writeJSON writes the reply and returns an error if it could not be written
+func writeJSON(w http.ResponseWriter, code int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Debug().Err(err).Msg("HTTP: Cannot write reply")
+	}
+	return err
+}
+
+// ServeHTTPAPI starts serving all queues of the queue set over the HTTP API
+func ServeHTTPAPI(queues *chronomq.QueueSet, addr string) (io.Closer, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: NewHTTPServer(queues)}
+	go func() {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("HTTP server has stopped")
+		}
+	}()
+	return srv, nil
+}
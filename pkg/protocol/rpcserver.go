@@ -1,12 +1,15 @@
 package protocol
 
 import (
-	"errors"
+	"context"
 	"io"
 	"net"
 	"net/rpc"
+	"reflect"
+	"sync/atomic"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 
 	api "github.com/chronomq/chronomq/api/rpc/chronomq"
@@ -16,79 +19,684 @@ import (
 
 // ErrTimeout indicates that no new jobs were ready to be consumed within the given timeout duration
 var ErrTimeout = errors.New("No new jobs available in given timeout")
+
+// ErrInvalidTriggerAt indicates an absolute trigger time that is too far in the past or the future to be intended
+var ErrInvalidTriggerAt = errors.New("Trigger time is too far in the past or the future")
+
+// ErrDelayAndTriggerAt indicates a job with both a relative delay and an absolute trigger time
+var ErrDelayAndTriggerAt = errors.New("Set either a delay or a trigger time")
+
+// ErrInvalidDuplicatePolicy indicates a put with a duplicate policy the server doesn't know
+var ErrInvalidDuplicatePolicy = errors.New("Unknown duplicate policy")
+
+// ErrNotStandby indicates a promotion of a server that is not a standby replica
+var ErrNotStandby = errors.New("Not a standby replica")
+
+var (
+	// MaxTriggerAtPast is how far in the past an absolute trigger time may be. Jobs in the past are ready right away,
+	// but times further back usually come from a zero value or a unit mix-up on the client
+	MaxTriggerAtPast = time.Hour * 24 * 7
+	// MaxTriggerAtFuture is how far in the future an absolute trigger time may be
+	MaxTriggerAtFuture = time.Hour * 24 * 365 * 50
+)
+
+// inspectOccurrences is the number of upcoming trigger times returned for inspected recurring jobs
+const inspectOccurrences = 5
+
 var memMonitor monitor.MemMonitor
 
+// Replica is a server of a replicated cluster, see package ha. Only the leader serves clients
+type Replica interface {
+	// Queues returns the queues to serve while the replica is the leader. Otherwise it returns an error
+	// redirecting clients to the leader
+	Queues() (*chronomq.QueueSet, error)
+}
+
+// Standby is a replica that serves clients once it is promoted, see package replication
+type Standby interface {
+	Replica
+	// Promote makes the replica serve clients
+	Promote() error
+}
+
 // RPCServer exposes a Chronomq hub backed RPC endpoint
+// Every named queue is served by its own hub
 type RPCServer struct {
-	hub *chronomq.Hub
+	queues  *chronomq.QueueSet
+	replica Replica // Serves the replica's queues instead if set
+	rr      uint32  // Rotates the first queue Next looks at so that no watched queue starves
 }
 
-func newRPCServer(hub *chronomq.Hub) *RPCServer {
+func newRPCServer(queues *chronomq.QueueSet) *RPCServer {
 	memMonitor = monitor.GetMemMonitor()
-	return &RPCServer{hub: hub}
+	return &RPCServer{queues: queues}
+}
+
+// serving returns the queues to serve. Replicas only serve while they are the leader
+func (r *RPCServer) serving() (*chronomq.QueueSet, error) {
+	if r.replica == nil {
+		return r.queues, nil
+	}
+	return r.replica.Queues()
 }
 
-// PutWithID accepts a new job and stores it in a Hub, reply is ignored
+// lookup returns the hub of a queue or nil if the queue doesn't exist yet
+func (r *RPCServer) lookup(queue string) (*chronomq.Hub, error) {
+	queues, err := r.serving()
+	if err != nil {
+		return nil, err
+	}
+	return queues.Lookup(queue), nil
+}
+
+// PutWithID accepts a new job and stores it in the hub of the job's queue, reply is ignored
+// The queue is created if it doesn't exist yet
 func (r *RPCServer) PutWithID(rpcJob api.Job, id *string) error {
+	queues, err := r.serving()
+	if err != nil {
+		return err
+	}
+	hub, err := queues.Hub(rpcJob.Queue)
+	if err != nil {
+		return err
+	}
 	memMonitor.Fence()
 
+	policy, err := duplicatePolicy(rpcJob.OnDuplicate)
+	if err != nil {
+		return err
+	}
+	j, err := newJob(rpcJob)
+	if err != nil {
+		return err
+	}
+	*id = j.ID()
+	outcome, err := hub.PutJobLocked(j, policy)
+	if err != nil {
+		return err
+	}
+	trackPut(j, outcome)
+	return nil
+}
+
+// trackPut accounts for the memory of a put job and of the job it replaced
+func trackPut(j *chronomq.Job, outcome chronomq.PutOutcome) {
+	if outcome.Added {
+		memMonitor.Increment(j)
+	}
+	if outcome.Replaced != nil {
+		memMonitor.Decrement(outcome.Replaced)
+	}
+}
+
+// duplicatePolicy returns the hub's duplicate policy for a policy received on the wire
+func duplicatePolicy(policy api.DuplicatePolicy) (chronomq.DuplicatePolicy, error) {
+	switch policy {
+	case api.DuplicateReject:
+		return chronomq.RejectDuplicates, nil
+	case api.DuplicateIgnore:
+		return chronomq.IgnoreDuplicates, nil
+	case api.DuplicateReplace:
+		return chronomq.ReplaceDuplicates, nil
+	}
+	return 0, ErrInvalidDuplicatePolicy
+}
+
+// putBatch is the part of a batch that goes to the same hub with the same duplicate policy
+type putBatch struct {
+	hub    *chronomq.Hub
+	policy chronomq.DuplicatePolicy
+}
+
+// PutBatch accepts a batch of jobs and stores them in the hubs of their queues. The jobs of a queue are added
+// taking the hub lock only once. The reply holds a result for every job in order - rejected jobs don't fail the batch
+func (r *RPCServer) PutBatch(rpcJobs []api.Job, results *[]api.PutResult) error {
+	queues, err := r.serving()
+	if err != nil {
+		return err
+	}
+	memMonitor.Fence()
+	*results = make([]api.PutResult, len(rpcJobs))
+
+	jobs := make([]*chronomq.Job, len(rpcJobs))
+	var order []putBatch
+	batches := make(map[putBatch][]int) // Indexes of the jobs of each batch
+	for i, rpcJob := range rpcJobs {
+		var b putBatch
+		hub, err := queues.Hub(rpcJob.Queue)
+		if err == nil {
+			b = putBatch{hub: hub}
+			b.policy, err = duplicatePolicy(rpcJob.OnDuplicate)
+		}
+		if err == nil {
+			jobs[i], err = newJob(rpcJob)
+		}
+		if err != nil {
+			(*results)[i] = api.PutResult{ID: rpcJob.ID, Error: err.Error()}
+			continue
+		}
+		(*results)[i].ID = jobs[i].ID()
+		if _, ok := batches[b]; !ok {
+			order = append(order, b)
+		}
+		batches[b] = append(batches[b], i)
+	}
+
+	for _, b := range order {
+		idx := batches[b]
+		batch := make([]*chronomq.Job, len(idx))
+		for k, i := range idx {
+			batch[k] = jobs[i]
+		}
+		outcomes, errs := b.hub.PutJobsLocked(batch, b.policy)
+		for k, err := range errs {
+			i := idx[k]
+			if err != nil {
+				(*results)[i].Error = err.Error()
+				(*results)[i].Duplicate = errors.Cause(err) == chronomq.ErrJobExists
+				continue
+			}
+			(*results)[i].Ignored = !outcomes[k].Added
+			(*results)[i].Replaced = outcomes[k].Replaced != nil
+			trackPut(jobs[i], outcomes[k])
+		}
+	}
+	return nil
+}
+
+// newJob creates the hub job for a job received on the wire, generating an id if it has none
+func newJob(rpcJob api.Job) (*chronomq.Job, error) {
+	triggerAt, err := jobTriggerAt(rpcJob)
+	if err != nil {
+		return nil, err
+	}
+
 	var j *chronomq.Job
 	if rpcJob.ID == "" {
 		// need to generate an id
-		j = chronomq.NewJobAutoID(time.Now().Add(rpcJob.Delay), rpcJob.Body)
-		*id = j.ID()
+		j = chronomq.NewJobAutoID(triggerAt, rpcJob.Body)
 	} else {
-		j = chronomq.NewJob(rpcJob.ID, time.Now().Add(rpcJob.Delay), rpcJob.Body)
+		j = chronomq.NewJob(rpcJob.ID, triggerAt, rpcJob.Body)
+	}
+	j.SetOpts(rpcJob.Pri, rpcJob.TTR)
+	j.SetTags(rpcJob.Tags...)
+	j.SetHeaders(rpcJob.Headers)
+	if rpcJob.Cron != "" {
+		schedule, err := chronomq.NewSchedule(rpcJob.Cron, rpcJob.Timezone, rpcJob.Until)
+		if err != nil {
+			return nil, err
+		}
+		if err := j.SetSchedule(schedule); err != nil {
+			return nil, err
+		}
+	}
+	if err := j.SetExpiry(rpcJob.ExpireAt); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// jobTriggerAt returns the absolute trigger time of a job, computing it from the delay if not set
+func jobTriggerAt(rpcJob api.Job) (time.Time, error) {
+	now := time.Now()
+	if rpcJob.TriggerAt.IsZero() {
+		return now.Add(rpcJob.Delay), nil
+	}
+	if rpcJob.Delay != 0 {
+		return time.Time{}, ErrDelayAndTriggerAt
+	}
+	if rpcJob.TriggerAt.Before(now.Add(-MaxTriggerAtPast)) || rpcJob.TriggerAt.After(now.Add(MaxTriggerAtFuture)) {
+		return time.Time{}, ErrInvalidTriggerAt
 	}
-	defer memMonitor.Increment(j)
-	return r.hub.AddJobLocked(j)
+	return rpcJob.TriggerAt, nil
 }
 
-// Cancel deletes the job pointed to by the id, reply is ignored
+// Cancel deletes the job pointed to by the id from the default queue, reply is ignored
 // If the job doesn't exist, no error is returned so calls to Cancel are idempotent
 func (r *RPCServer) Cancel(id string, ignoredReply *int8) error {
-	j, err := r.hub.CancelJobLocked(id)
+	return r.CancelIn(api.Job{ID: id}, ignoredReply)
+}
+
+// CancelIn is Cancel for the job's queue
+func (r *RPCServer) CancelIn(rpcJob api.Job, ignoredReply *int8) error {
+	hub, err := r.lookup(rpcJob.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return nil
+	}
+	j, err := hub.CancelJobLocked(rpcJob.ID)
 	if j != nil {
 		defer memMonitor.Decrement(j)
 	}
 	return err
 }
 
-// Next sets the reply (job) to a valid job if a job is ready to be triggered
-// If not job is ready yet, this call will wait (block) for the given duration and keep searching
-// for ready jobs. If no job is ready by the end of the timeout, ErrTimeout is returned
-func (r *RPCServer) Next(timeout time.Duration, job *api.Job) error {
-	// try once
-	if j := r.hub.NextLocked(); j != nil {
-		defer memMonitor.Decrement(j)
-		job.Body = j.Body()
-		job.ID = j.ID()
+// Get sets the reply to the job pointed to by the id and its state. Returns ErrJobNotFound if the queue
+// doesn't hold the job - it may have been consumed or canceled already
+func (r *RPCServer) Get(rpcJob api.Job, job *api.Job) error {
+	hub, err := r.lookup(rpcJob.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return chronomq.ErrJobNotFound
+	}
+	j, state, err := hub.GetJobLocked(rpcJob.ID)
+	if err != nil {
+		return err
+	}
+	*job = *toRPCJob(j, hub.Queue())
+	job.State = string(state)
+	return nil
+}
+
+// Reschedule moves a pending job to rpcJob.TriggerAt or, if not set, to rpcJob.Delay from now, reply is ignored
+// The job is moved under the hub lock so that it is never missing or handed out twice in between
+func (r *RPCServer) Reschedule(rpcJob api.Job, ignoredReply *int8) error {
+	hub, err := r.lookup(rpcJob.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return chronomq.ErrJobNotFound
+	}
+	triggerAt, err := jobTriggerAt(rpcJob)
+	if err != nil {
+		return err
+	}
+	return hub.RescheduleLocked(rpcJob.ID, triggerAt)
+}
+
+// UpdateBody replaces the body of a pending job with rpcJob.Body, reply is ignored
+func (r *RPCServer) UpdateBody(rpcJob api.Job, ignoredReply *int8) error {
+	hub, err := r.lookup(rpcJob.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return chronomq.ErrJobNotFound
+	}
+	memMonitor.Fence()
+	prev, err := hub.UpdateBodyLocked(rpcJob.ID, rpcJob.Body)
+	if err != nil {
+		return err
+	}
+	memMonitor.Increment(chronomq.NewJob(prev.ID(), prev.TriggerAt(), rpcJob.Body))
+	memMonitor.Decrement(prev)
+	return nil
+}
+
+// CancelBatch deletes the jobs pointed to by the ids from the queue taking the hub lock only once.
+// The reply is true for every job that existed and was deleted
+func (r *RPCServer) CancelBatch(args api.CancelBatchArgs, canceled *[]bool) error {
+	*canceled = make([]bool, len(args.IDs))
+	hub, err := r.lookup(args.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
 		return nil
 	}
-	// if we couldn't find a ready job and timeout was set to 0
+	for i, j := range hub.CancelJobsLocked(args.IDs) {
+		if j != nil {
+			(*canceled)[i] = true
+			memMonitor.Decrement(j)
+		}
+	}
+	return nil
+}
+
+// CancelByTag deletes all jobs of a queue with the given tag. The reply is the number of deleted jobs
+func (r *RPCServer) CancelByTag(args api.CancelMatchingArgs, canceled *int) error {
+	hub, err := r.lookup(args.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return nil
+	}
+	*canceled = releaseCanceled(hub.CancelByTagLocked(args.Match))
+	return nil
+}
+
+// CancelByPrefix deletes all jobs of a queue whose id starts with the given prefix.
+// The reply is the number of deleted jobs
+func (r *RPCServer) CancelByPrefix(args api.CancelMatchingArgs, canceled *int) error {
+	hub, err := r.lookup(args.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return nil
+	}
+	*canceled = releaseCanceled(hub.CancelByPrefixLocked(args.Match))
+	return nil
+}
+
+// releaseCanceled releases the memory of canceled jobs and returns their number
+func releaseCanceled(jobs []*chronomq.Job) int {
+	for _, j := range jobs {
+		memMonitor.Decrement(j)
+	}
+	return len(jobs)
+}
+
+// Next sets the reply (job) to a valid job if a job is ready to be triggered in the default queue
+// If not job is ready yet, this call will wait (block) for the given duration till a job becomes ready.
+// If no job is ready by the end of the timeout, ErrTimeout is returned
+// Jobs with a TTR are reserved and must be acknowledged with Ack before the TTR runs out
+func (r *RPCServer) Next(timeout time.Duration, job *api.Job) error {
+	return r.NextFrom(api.NextArgs{Timeout: timeout}, job)
+}
+
+// NextFrom is Next for any of the watched queues
+func (r *RPCServer) NextFrom(args api.NextArgs, job *api.Job) error {
+	_, err := r.waitNext(context.Background(), args, job)
+	return err
+}
+
+// NextN is Next for up to args.N jobs. It returns as soon as any job is ready, so fewer than args.N jobs may be
+// returned. The jobs of one queue are taken with the hub lock taken only once. N less than 1 is treated as 1
+func (r *RPCServer) NextN(args api.NextNArgs, jobs *[]*api.Job) error {
+	qs, err := r.serving()
+	if err != nil {
+		return err
+	}
+	queues := watched(args.Queues)
+	n := args.N
+	if n < 1 {
+		n = 1
+	}
+	return r.waitFor(context.Background(), qs, args.Timeout, queues, func() bool {
+		return r.nextN(qs, queues, n, jobs)
+	})
+}
+
+// waitNext is Next but stops waiting as soon as ctx is done. Returns the job taken from the hub so that it can be
+// put back if it cannot be delivered, see putBack
+func (r *RPCServer) waitNext(ctx context.Context, args api.NextArgs, job *api.Job) (*chronomq.Job, error) {
+	qs, err := r.serving()
+	if err != nil {
+		return nil, err
+	}
+	queues := watched(args.Queues)
+	var taken *chronomq.Job
+	err = r.waitFor(ctx, qs, args.Timeout, queues, func() bool {
+		taken = r.next(qs, queues, job)
+		return taken != nil
+	})
+	return taken, err
+}
+
+// waitFor calls take till it finds ready jobs in the queues of qs or the timeout passes
+func (r *RPCServer) waitFor(ctx context.Context, qs *chronomq.QueueSet, timeout time.Duration, queues []string, take func() bool) error {
+	// if timeout was set to 0, try once
 	if timeout.Seconds() == 0 {
+		if take() {
+			return nil
+		}
 		return ErrTimeout
 	}
 
-	waitTill := time.Now().Add(timeout)
-	// wait for timeout and keep trying
 	log.Debug().
 		Dur("timeout", timeout).
 		Time("now", time.Now()).
-		Time("waitTill", waitTill).
+		Time("waitTill", time.Now().Add(timeout)).
 		Msg("waiting for reserve")
-	for waitTill.After(time.Now()) {
-		if j := r.hub.NextLocked(); j != nil {
-			defer memMonitor.Decrement(j)
-			job.Body = j.Body()
-			job.ID = j.ID()
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := r.wait(waitCtx, qs, queues, take)
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		return ErrTimeout
+	}
+	return err
+}
+
+// wait calls take every time a job may have become ready in any of the given queues of qs till take succeeds.
+// It blocks till a hub signals a ready job or ctx is done, so consumers are woken up as soon as a job triggers
+func (r *RPCServer) wait(ctx context.Context, qs *chronomq.QueueSet, queues []string, take func() bool) error {
+	for {
+		wakeups := r.wakeups(ctx, qs, queues)
+		if take() {
 			return nil
 		}
-		time.Sleep(time.Millisecond * 200)
-		log.Debug().Dur("timeout", timeout).Msg("waiting for reserve finished sleep duration")
+		if chosen, _, _ := reflect.Select(wakeups); chosen == 0 {
+			return ctx.Err()
+		}
+	}
+}
+
+// wakeups returns the select cases wait blocks on - ctx being done, a job becoming ready in any of the queues
+// or, if some queues don't exist yet, a new queue being created.
+// The channels are taken before looking for jobs so that no wakeup in between is missed
+func (r *RPCServer) wakeups(ctx context.Context, qs *chronomq.QueueSet, queues []string) []reflect.SelectCase {
+	created := qs.Created()
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}}
+	missing := false
+	for _, queue := range queues {
+		hub := qs.Lookup(queue)
+		if hub == nil {
+			missing = true
+			continue
+		}
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(hub.Ready())})
+	}
+	if missing {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(created)})
 	}
+	return cases
+}
 
-	return ErrTimeout
+// next delivers the first ready job found in the given queues of qs and returns the job taken from the hub or nil.
+// Queues that don't exist yet are skipped
+func (r *RPCServer) next(qs *chronomq.QueueSet, queues []string, job *api.Job) *chronomq.Job {
+	start := int(atomic.AddUint32(&r.rr, 1))
+	for i := range queues {
+		queue := queues[(start+i)%len(queues)]
+		hub := qs.Lookup(queue)
+		if hub == nil {
+			continue
+		}
+		if j := hub.NextLocked(); j != nil {
+			r.deliver(j, job)
+			job.Queue = hub.Queue()
+			return j
+		}
+	}
+	return nil
+}
+
+// putBack returns a job taken from the hub of the queue that was never delivered to its consumer, e.g. because
+// the connection broke while sending it. The job is restored as it was, see Hub.ReturnLocked
+func (r *RPCServer) putBack(j *chronomq.Job, queue string) error {
+	hub, err := r.lookup(queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return chronomq.ErrUnknownQueue
+	}
+	if err := hub.ReturnLocked(j); err != nil {
+		return err
+	}
+	if j.TTR() == 0 && !j.IsRecurring() {
+		// Delivered jobs were no longer accounted for
+		memMonitor.Increment(j)
+	}
+	return nil
+}
+
+// nextN delivers up to n ready jobs found in the given queues of qs. Queues that don't exist yet are skipped
+func (r *RPCServer) nextN(qs *chronomq.QueueSet, queues []string, n int, jobs *[]*api.Job) bool {
+	start := int(atomic.AddUint32(&r.rr, 1))
+	for i := 0; i < len(queues) && len(*jobs) < n; i++ {
+		hub := qs.Lookup(queues[(start+i)%len(queues)])
+		if hub == nil {
+			continue
+		}
+		for _, j := range hub.NextNLocked(n - len(*jobs)) {
+			job := &api.Job{Queue: hub.Queue()}
+			r.deliver(j, job)
+			*jobs = append(*jobs, job)
+		}
+	}
+	return len(*jobs) > 0
+}
+
+// watched returns the queues a consumer takes jobs from. No queues means the default queue
+func watched(queues []string) []string {
+	if len(queues) == 0 {
+		return []string{chronomq.DefaultQueue}
+	}
+	return queues
+}
+
+// deliver copies a dequeued job into the reply. Reserved and recurring jobs are still held by the hub
+// so their memory is only released once they are acknowledged or stop recurring
+func (r *RPCServer) deliver(j *chronomq.Job, job *api.Job) {
+	if j.TTR() == 0 && !j.IsRecurring() {
+		memMonitor.Decrement(j)
+	}
+	job.Body = j.Body()
+	job.ID = j.ID()
+	job.TTR = j.TTR()
+	job.Pri = j.Pri()
+	job.TriggerAt = j.TriggerAt()
+	job.Attempts = j.Attempts()
+	job.ExpireAt = j.ExpireAt()
+	job.Tags = j.Tags()
+	job.Headers = j.Headers()
+}
+
+// Ack deletes a reserved job once the consumer has finished working on it, reply is ignored
+// Recurring jobs are scheduled again at their next occurrence
+func (r *RPCServer) Ack(rpcJob api.Job, ignoredReply *int8) error {
+	hub, err := r.lookup(rpcJob.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return chronomq.ErrJobNotReserved
+	}
+	j, err := hub.AckLocked(rpcJob.ID)
+	if j != nil && !j.IsRecurring() {
+		defer memMonitor.Decrement(j)
+	}
+	return err
+}
+
+// Release puts a reserved job back into the queue, reply is ignored
+// The job will be ready again after rpcJob.Delay or right away if no delay is set
+func (r *RPCServer) Release(rpcJob api.Job, ignoredReply *int8) error {
+	hub, err := r.lookup(rpcJob.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return chronomq.ErrJobNotReserved
+	}
+	return hub.ReleaseLocked(rpcJob.ID, rpcJob.Delay)
+}
+
+// Touch restarts the TTR of a reserved job so that the consumer gets more time to work on it, reply is ignored
+func (r *RPCServer) Touch(rpcJob api.Job, ignoredReply *int8) error {
+	hub, err := r.lookup(rpcJob.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return chronomq.ErrJobNotReserved
+	}
+	return hub.TouchLocked(rpcJob.ID)
+}
+
+// Nack fails a reserved job. The job is retried with the backoff of its queue or moved to the dead-letter store
+// once it failed too often. The reply is true if the job was dead-lettered
+func (r *RPCServer) Nack(rpcJob api.Job, dead *bool) error {
+	hub, err := r.lookup(rpcJob.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return chronomq.ErrJobNotReserved
+	}
+	*dead, err = hub.NackLocked(rpcJob.ID)
+	return err
+}
+
+// DeadLetters returns up to n jobs of the dead-letter store of a queue, the ones that died first first
+func (r *RPCServer) DeadLetters(args api.InspectArgs, rpcJobs *[]*api.Job) error {
+	hub, err := r.lookup(args.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil || args.N == 0 {
+		return nil
+	}
+	for _, j := range hub.DeadLettersLocked(args.N) {
+		*rpcJobs = append(*rpcJobs, toRPCJob(j, hub.Queue()))
+	}
+	return nil
+}
+
+// DeadLetter sets the reply to the dead-lettered job pointed to by the id
+func (r *RPCServer) DeadLetter(rpcJob api.Job, job *api.Job) error {
+	hub, err := r.lookup(rpcJob.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return chronomq.ErrJobNotDead
+	}
+	j, err := hub.DeadLetterLocked(rpcJob.ID)
+	if err != nil {
+		return err
+	}
+	*job = *toRPCJob(j, hub.Queue())
+	return nil
+}
+
+// RequeueDeadLetter moves a job out of the dead-letter store back into its queue, reply is ignored
+// The job will be ready again after rpcJob.Delay or right away if no delay is set
+func (r *RPCServer) RequeueDeadLetter(rpcJob api.Job, ignoredReply *int8) error {
+	hub, err := r.lookup(rpcJob.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return chronomq.ErrJobNotDead
+	}
+	return hub.RequeueDeadLocked(rpcJob.ID, rpcJob.Delay)
+}
+
+// PurgeDeadLetters deletes dead-lettered jobs of a queue, all of them if no ids are given.
+// The reply is the number of deleted jobs
+func (r *RPCServer) PurgeDeadLetters(args api.PurgeArgs, purged *int) error {
+	hub, err := r.lookup(args.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return nil
+	}
+	jobs := hub.PurgeDeadLocked(args.IDs...)
+	for _, j := range jobs {
+		memMonitor.Decrement(j)
+	}
+	*purged = len(jobs)
+	return nil
+}
+
+// Queues sets the reply to the names of all existing queues
+func (r *RPCServer) Queues(ignore int8, names *[]string) error {
+	queues, err := r.serving()
+	if err != nil {
+		return err
+	}
+	*names = queues.Names()
+	return nil
 }
 
 // Ping the server, sets "pong" as the reply
@@ -99,28 +707,114 @@ func (r *RPCServer) Ping(ignore int8, pong *string) error {
 	return nil
 }
 
-// InspectN returns n jobs without removing them for ad-hoc inspection
+// Promote makes a standby replica serve clients, reply is ignored. Returns ErrNotStandby for other servers
+func (r *RPCServer) Promote(ignore int8, ignoredReply *int8) error {
+	standby, ok := r.replica.(Standby)
+	if !ok {
+		return ErrNotStandby
+	}
+	return standby.Promote()
+}
+
+// InspectN returns n jobs of the default queue without removing them for ad-hoc inspection
 func (r *RPCServer) InspectN(n int, rpcJobs *[]*api.Job) error {
-	if n == 0 {
+	return r.InspectQueue(api.InspectArgs{N: n}, rpcJobs)
+}
+
+// InspectQueue is InspectN for a named queue
+func (r *RPCServer) InspectQueue(args api.InspectArgs, rpcJobs *[]*api.Job) error {
+	if args.N == 0 {
+		return nil
+	}
+	hub, err := r.lookup(args.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
 		return nil
 	}
-	log.Debug().Int("count", n).Msg("Returning jobs for inspection")
-	jobs := r.hub.GetNJobs(n)
+	log.Debug().Int("count", args.N).Str("queue", args.Queue).Msg("Returning jobs for inspection")
+	jobs := hub.GetNJobs(args.N)
 
 	for j := range jobs {
-		rpcJob := &api.Job{
-			Body:  j.Body(),
-			ID:    j.ID(),
-			Delay: j.TriggerAt().Sub(time.Now()),
-		}
-		*rpcJobs = append(*rpcJobs, rpcJob)
+		*rpcJobs = append(*rpcJobs, toRPCJob(j, hub.Queue()))
 	}
 	return nil
 }
 
-// ServeRPC starts serving hub over rpc
+// Unowned returns up to args.N pending jobs of a queue that a ring of args.Nodes assigns to another node than
+// args.Self, in order of their ids. Only jobs with ids greater than args.After are returned. The jobs are not
+// removed, clients rebalancing a sharded cluster cancel them once they are moved. Expired jobs are left to the hub to drop or dead-letter, no server accepts them anymore.
+// See api.Rebalance
+func (r *RPCServer) Unowned(args api.UnownedArgs, rpcJobs *[]*api.Job) error {
+	if args.N < 1 || len(args.Nodes) == 0 {
+		return nil
+	}
+	hub, err := r.lookup(args.Queue)
+	if err != nil {
+		return err
+	}
+	if hub == nil {
+		return nil
+	}
+	ring := api.NewRing(args.Nodes...)
+	jobs := hub.PendingJobsLocked(args.After, func(j *chronomq.Job) bool {
+		return !j.IsExpired() && ring.Owner(j.ID()) != args.Self
+	}, args.N)
+	for _, j := range jobs {
+		*rpcJobs = append(*rpcJobs, toRPCJob(j, hub.Queue()))
+	}
+	return nil
+}
+
+// toRPCJob copies a job that stays in the hub into a job on the wire
+func toRPCJob(j *chronomq.Job, queue string) *api.Job {
+	rpcJob := &api.Job{
+		Body:      j.Body(),
+		ID:        j.ID(),
+		Delay:     j.TriggerAt().Sub(time.Now()),
+		TriggerAt: j.TriggerAt(),
+		TTR:       j.TTR(),
+		Pri:       j.Pri(),
+		Queue:     queue,
+		Attempts:  j.Attempts(),
+		DeadAt:    j.DeadAt(),
+		ExpireAt:  j.ExpireAt(),
+		Tags:      j.Tags(),
+		Headers:   j.Headers(),
+	}
+	if s := j.Schedule(); s != nil {
+		rpcJob.Cron = s.Spec()
+		rpcJob.Timezone = s.Timezone()
+		rpcJob.Until = s.Until()
+		rpcJob.Occurrences = j.Occurrences(inspectOccurrences)
+	}
+	return rpcJob
+}
+
+// ServeRPC starts serving hub over rpc as the default queue. No other queues can be created
 func ServeRPC(hub *chronomq.Hub, addr string) (io.Closer, error) {
-	srv := newRPCServer(hub)
+	queues := chronomq.NewQueueSet(nil)
+	if err := queues.Add(chronomq.DefaultQueue, hub); err != nil {
+		return nil, err
+	}
+	return ServeQueuesRPC(queues, addr)
+}
+
+// ServeQueuesRPC starts serving all queues of the queue set over rpc
+func ServeQueuesRPC(queues *chronomq.QueueSet, addr string) (io.Closer, error) {
+	return serveRPC(newRPCServer(queues), addr)
+}
+
+// ServeReplicaRPC starts serving the queues of a replica over rpc. Clients of replicas that are not
+// the leader get an error naming the leader's address
+func ServeReplicaRPC(replica Replica, addr string) (io.Closer, error) {
+	srv := newRPCServer(nil)
+	srv.replica = replica
+	return serveRPC(srv, addr)
+}
+
+func serveRPC(srv *RPCServer, addr string) (io.Closer, error) {
 	rpcSrv := rpc.NewServer()
 	rpcSrv.Register(srv)
 	l, e := net.Listen("tcp", addr)
@@ -20,7 +20,7 @@ var opts = chronomq.HubOpts{
 	SpokeSpan:      time.Second * 5}
 
 type jobPutter interface {
-	Put(body []byte, delay time.Duration) (string, error)
+	Put(body []byte, delay time.Duration, opts ...api.PutOpt) (string, error)
 }
 
 func benchPut(b *testing.B, bodySize int, putter jobPutter) {
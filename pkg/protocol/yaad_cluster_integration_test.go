@@ -0,0 +1,260 @@
+package protocol_test
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	api "github.com/chronomq/chronomq/api/rpc/chronomq"
+	"github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+	"github.com/chronomq/chronomq/pkg/protocol"
+)
+
+var _ = Describe("Test sharded cluster:", func() {
+	defer GinkgoRecover()
+	var port = 9801
+	var addrs []string
+	var srvs []io.Closer
+	var queueSets []*chronomq.QueueSet
+
+	// serve starts another server of the cluster
+	serve := func() {
+		queues := chronomq.NewQueueSet(func(queue string) (*chronomq.Hub, error) {
+			store, err := persistence.InMemStorage()
+			if err != nil {
+				return nil, err
+			}
+			return chronomq.NewHub(&chronomq.HubOpts{
+				Persister: persistence.NewJournalPersister(store),
+				SpokeSpan: time.Second * 5,
+				Queue:     queue}), nil
+		})
+		addr := fmt.Sprintf("127.0.0.1:%d", port)
+		port++
+		srv, err := protocol.ServeQueuesRPC(queues, addr)
+		Expect(err).NotTo(HaveOccurred())
+		addrs = append(addrs, addr)
+		srvs = append(srvs, srv)
+		queueSets = append(queueSets, queues)
+	}
+
+	// held returns the ids of the jobs of a queue held by the server at addr
+	held := func(addr string, queue string) []string {
+		client, err := api.NewClient(addr)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		var jobs []*api.Job
+		Expect(client.Use(queue).InspectN(1000, &jobs)).To(Succeed())
+		ids := []string{}
+		for _, j := range jobs {
+			ids = append(ids, j.ID)
+		}
+		return ids
+	}
+
+	BeforeEach(func() {
+		addrs, srvs, queueSets = nil, nil, nil
+		for i := 0; i < 3; i++ {
+			serve()
+		}
+	})
+
+	AfterEach(func() {
+		for i, srv := range srvs {
+			Expect(srv.Close()).To(Succeed())
+			queueSets[i].Stop(false)
+		}
+	})
+
+	It("assigns ids to the same nodes in any order", func() {
+		ring := api.NewRing("a:1", "b:1", "c:1")
+		reversed := api.NewRing("c:1", "b:1", "a:1", "a:1")
+		Expect(reversed.Nodes()).To(Equal([]string{"a:1", "b:1", "c:1"}))
+		owned := map[string]int{}
+		for i := 0; i < 3000; i++ {
+			id := fmt.Sprintf("job-%d", i)
+			Expect(reversed.Owner(id)).To(Equal(ring.Owner(id)))
+			owned[ring.Owner(id)]++
+		}
+		for _, node := range ring.Nodes() {
+			Expect(owned[node]).To(BeNumerically("~", 1000, 250), node)
+		}
+		Expect(api.NewRing().Owner("job-1")).To(BeEmpty())
+	})
+
+	It("only moves ids to an added node", func() {
+		ring := api.NewRing("a:1", "b:1", "c:1")
+		grown := api.NewRing("a:1", "b:1", "c:1", "d:1")
+		moved := 0
+		for i := 0; i < 4000; i++ {
+			id := fmt.Sprintf("job-%d", i)
+			if owner := grown.Owner(id); owner != ring.Owner(id) {
+				Expect(owner).To(Equal("d:1"))
+				moved++
+			}
+		}
+		Expect(moved).To(BeNumerically("~", 1000, 250))
+	})
+
+	It("puts jobs into the servers owning their ids", func() {
+		client, err := api.NewClusterClient(addrs...)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		for i := 0; i < 60; i++ {
+			id := fmt.Sprintf("job-%d", i)
+			Expect(client.Use("emails").PutWithID(id, []byte(id), time.Minute)).To(Succeed())
+		}
+		id, err := client.Use("emails").Put([]byte("generated"), time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).NotTo(BeEmpty())
+
+		total := 0
+		for _, addr := range addrs {
+			ids := held(addr, "emails")
+			Expect(ids).NotTo(BeEmpty(), addr)
+			for _, id := range ids {
+				Expect(client.Owner(id)).To(Equal(addr))
+			}
+			total += len(ids)
+		}
+		Expect(total).To(Equal(61))
+
+		j, err := client.Use("emails").Get("job-7")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.Body).To(Equal([]byte("job-7")))
+		Expect(client.Use("emails").Cancel("job-7")).To(Succeed())
+		_, err = client.Use("emails").Get("job-7")
+		Expect(err).To(MatchError(api.ErrJobNotFound))
+		// Canceling again is a noop, like with a single server
+		Expect(client.Use("emails").Cancel("job-7")).To(Succeed())
+
+		queues, err := client.Queues()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queues).To(ContainElement("emails"))
+	})
+
+	It("takes jobs from all servers", func() {
+		client, err := api.NewClusterClient(addrs...)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		for i := 0; i < 30; i++ {
+			Expect(client.PutWithID(fmt.Sprintf("job-%d", i), []byte("hi"), 0, api.WithTTR(time.Minute))).To(Succeed())
+		}
+		seen := map[string]bool{}
+		for len(seen) < 30 {
+			jobs, err := client.NextN(7, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			for _, j := range jobs {
+				Expect(seen).NotTo(HaveKey(j.ID))
+				seen[j.ID] = true
+				Expect(client.Ack(j.ID)).To(Succeed())
+			}
+		}
+		_, _, err = client.Next(time.Millisecond * 300)
+		Expect(err).To(MatchError(api.ErrTimeout))
+
+		// Jobs becoming ready on any server wake up a waiting consumer
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(time.Millisecond * 200)
+			Expect(client.PutWithID("late", []byte("late"), 0)).To(Succeed())
+		}()
+		id, body, err := client.Next(time.Second * 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("late"))
+		Expect(body).To(Equal([]byte("late")))
+	})
+
+	It("moves jobs to an added server", func() {
+		old := addrs[:2]
+		client, err := api.NewClusterClient(old...)
+		Expect(err).NotTo(HaveOccurred())
+		for i := 0; i < 100; i++ {
+			id := fmt.Sprintf("job-%d", i)
+			Expect(client.Use("emails").PutWithID(id, []byte(id), time.Minute, api.WithTags("t"))).To(Succeed())
+		}
+		Expect(client.PutWithID("recurring", []byte("r"), 0, api.WithSchedule("*/5 * * * *", "", time.Time{}))).To(Succeed())
+		recurring, err := client.Get("recurring")
+		Expect(err).NotTo(HaveOccurred())
+		client.Close()
+
+		client, err = api.NewClusterClient(addrs...)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		Expect(held(addrs[2], "emails")).To(BeEmpty())
+		// Jobs not moved yet are found on their old servers
+		for i := 0; i < 100; i++ {
+			id := fmt.Sprintf("job-%d", i)
+			if client.Owner(id) == addrs[2] {
+				_, err := client.Use("emails").Get(id)
+				Expect(err).NotTo(HaveOccurred())
+				break
+			}
+		}
+
+		moved, err := api.Rebalance(old, addrs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(moved).To(BeNumerically(">", 0))
+
+		total := 0
+		for _, addr := range addrs {
+			ids := held(addr, "emails")
+			for _, id := range ids {
+				Expect(client.Owner(id)).To(Equal(addr))
+			}
+			total += len(ids)
+		}
+		Expect(total).To(Equal(100))
+		j, err := client.Use("emails").Get("job-42")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.Body).To(Equal([]byte("job-42")))
+		Expect(j.Tags).To(Equal([]string{"t"}))
+
+		j, err = client.Get("recurring")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.Cron).To(Equal("*/5 * * * *"))
+		Expect(j.TriggerAt).To(BeTemporally("==", recurring.TriggerAt))
+
+		// Nothing is left to move
+		moved, err = api.Rebalance(addrs, addrs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(moved).To(BeZero())
+	})
+
+	It("leaves expired jobs to their server when rebalancing", func() {
+		old := addrs[:2]
+		client, err := api.NewClusterClient(addrs...)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		var expired, live string
+		for i := 0; expired == "" || live == ""; i++ {
+			id := fmt.Sprintf("job-%d", i)
+			if client.Owner(id) != addrs[2] {
+				continue
+			}
+			if expired == "" {
+				expired = id
+			} else {
+				live = id
+			}
+		}
+		oldClient, err := api.NewClusterClient(old...)
+		Expect(err).NotTo(HaveOccurred())
+		defer oldClient.Close()
+		Expect(oldClient.PutWithID(expired, nil, 0, api.WithExpiry(time.Now().Add(time.Millisecond*100)))).To(Succeed())
+		Expect(oldClient.PutWithID(live, nil, 0)).To(Succeed())
+		time.Sleep(time.Millisecond * 200)
+
+		moved, err := api.Rebalance(old, addrs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(moved).To(Equal(1))
+		Expect(held(addrs[2], "")).To(Equal([]string{live}))
+		Expect(held(oldClient.Owner(expired), "")).To(Equal([]string{expired}))
+	})
+})
@@ -0,0 +1,169 @@
+package protocol_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/chronomq/chronomq/api/grpc/chronomq"
+	"github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+	"github.com/chronomq/chronomq/pkg/protocol"
+)
+
+var _ = Describe("Test grpc protocol:", func() {
+	defer GinkgoRecover()
+	var port = 9501
+	var client pb.ChronomqClient
+	var conn *grpc.ClientConn
+
+	var srv io.Closer
+	var queues *chronomq.QueueSet
+	ctx := context.Background()
+
+	BeforeEach(func(done Done) {
+		defer close(done)
+		queues = chronomq.NewQueueSet(func(queue string) (*chronomq.Hub, error) {
+			store, err := persistence.InMemStorage()
+			if err != nil {
+				return nil, err
+			}
+			return chronomq.NewHub(&chronomq.HubOpts{
+				Persister: persistence.NewJournalPersister(store),
+				SpokeSpan: time.Second * 5,
+				Queue:     queue}), nil
+		})
+		addr := fmt.Sprintf("127.0.0.1:%d", port)
+		var err error
+		srv, err = protocol.ServeGRPC(queues, addr)
+		Expect(err).NotTo(HaveOccurred())
+		port++
+
+		conn, err = grpc.Dial(addr, grpc.WithInsecure())
+		Expect(err).NotTo(HaveOccurred())
+		client = pb.NewChronomqClient(conn)
+	}, 0.5)
+
+	AfterEach(func(done Done) {
+		defer close(done)
+		Expect(conn.Close()).To(Succeed())
+		Expect(srv.Close()).To(Succeed())
+		queues.Stop(false)
+	})
+
+	It("pings grpc server", func(done Done) {
+		defer close(done)
+		reply, err := client.Ping(ctx, &pb.Empty{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reply.Pong).To(Equal("pong"))
+	}, 1)
+
+	It("puts, inspects, cancels and takes jobs", func(done Done) {
+		defer close(done)
+
+		put, err := client.Put(ctx, &pb.Job{Body: []byte("generated"), Delay: ptypes.DurationProto(time.Millisecond)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(put.Id).NotTo(BeEmpty())
+		_, err = client.PutWithID(ctx, &pb.Job{Id: "cancel-me", Queue: "other", Delay: ptypes.DurationProto(time.Hour)})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.PutWithID(ctx, &pb.Job{Id: "cancel-me", Queue: "other"})
+		Expect(err).To(HaveOccurred())
+		_, err = client.PutWithID(ctx, &pb.Job{})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		_, err = client.PutWithID(ctx, &pb.Job{Id: "epoch", TriggerAt: &timestamp.Timestamp{}})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		at, _ := ptypes.TimestampProto(time.Now().Add(time.Hour))
+		_, err = client.PutWithID(ctx, &pb.Job{Id: "at", Queue: "other", TriggerAt: at, Tags: []string{"user-1"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		queuesReply, err := client.Queues(ctx, &pb.Empty{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queuesReply.Queues).To(Equal([]string{chronomq.DefaultQueue, "other"}))
+
+		inspected, err := client.InspectN(ctx, &pb.InspectRequest{N: 5, Queue: "other"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inspected.Jobs).To(HaveLen(2))
+		for _, j := range inspected.Jobs {
+			Expect(j.Queue).To(Equal("other"))
+			if j.Id == "at" {
+				Expect(proto.Equal(j.TriggerAt, at)).To(BeTrue())
+				Expect(j.Tags).To(Equal([]string{"user-1"}))
+			}
+		}
+
+		_, err = client.Cancel(ctx, &pb.JobRef{Id: "cancel-me", Queue: "other"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.Cancel(ctx, &pb.JobRef{Id: "at", Queue: "other"})
+		Expect(err).NotTo(HaveOccurred())
+
+		job, err := client.Next(ctx, &pb.NextRequest{Timeout: ptypes.DurationProto(time.Second), Queues: []string{"other", ""}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Id).To(Equal(put.Id))
+		Expect(job.Body).To(Equal([]byte("generated")))
+		Expect(job.Queue).To(Equal(chronomq.DefaultQueue))
+
+		_, err = client.Next(ctx, &pb.NextRequest{Queues: []string{"other", ""}})
+		Expect(status.Code(err)).To(Equal(codes.DeadlineExceeded))
+	}, 5)
+
+	It("reserves, releases and acks jobs with a ttr", func(done Done) {
+		defer close(done)
+
+		headers := map[string]string{"type": "email"}
+		_, err := client.PutWithID(ctx, &pb.Job{Id: "ttr", Ttr: ptypes.DurationProto(time.Minute), Headers: headers})
+		Expect(err).NotTo(HaveOccurred())
+		job, err := client.Next(ctx, &pb.NextRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Id).To(Equal("ttr"))
+		Expect(ptypes.Duration(job.Ttr)).To(Equal(time.Minute))
+		Expect(job.Headers).To(Equal(headers))
+
+		_, err = client.Touch(ctx, &pb.JobRef{Id: "ttr"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.Release(ctx, &pb.ReleaseRequest{Id: "ttr"})
+		Expect(err).NotTo(HaveOccurred())
+		job, err = client.Next(ctx, &pb.NextRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.Ack(ctx, &pb.JobRef{Id: job.Id})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.Ack(ctx, &pb.JobRef{Id: job.Id})
+		Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+	}, 5)
+
+	It("streams jobs to subscribers as they become ready", func(done Done) {
+		defer close(done)
+
+		subCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stream, err := client.Subscribe(subCtx, &pb.SubscribeRequest{Queues: []string{"a", "b"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.PutWithID(ctx, &pb.Job{Id: "later", Queue: "a", Delay: ptypes.DurationProto(time.Millisecond * 300)})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.PutWithID(ctx, &pb.Job{Id: "now", Queue: "b"})
+		Expect(err).NotTo(HaveOccurred())
+
+		job, err := stream.Recv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Id).To(Equal("now"))
+		Expect(job.Queue).To(Equal("b"))
+		job, err = stream.Recv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Id).To(Equal("later"))
+		Expect(job.Queue).To(Equal("a"))
+
+		cancel()
+		_, err = stream.Recv()
+		Expect(status.Code(err)).To(Equal(codes.Canceled))
+	}, 5)
+})
@@ -0,0 +1,188 @@
+package protocol_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+	"github.com/chronomq/chronomq/pkg/protocol"
+)
+
+var _ = Describe("Test http protocol:", func() {
+	defer GinkgoRecover()
+
+	var srv *httptest.Server
+	var queues *chronomq.QueueSet
+
+	BeforeEach(func() {
+		queues = chronomq.NewQueueSet(func(queue string) (*chronomq.Hub, error) {
+			store, err := persistence.InMemStorage()
+			if err != nil {
+				return nil, err
+			}
+			return chronomq.NewHub(&chronomq.HubOpts{
+				Persister: persistence.NewJournalPersister(store),
+				SpokeSpan: time.Second * 5,
+				Queue:     queue}), nil
+		})
+		srv = httptest.NewServer(protocol.NewHTTPServer(queues))
+	})
+
+	AfterEach(func() {
+		srv.Close()
+		queues.Stop(false)
+	})
+
+	do := func(method, path string, body interface{}) (int, []byte) {
+		var reqBody []byte
+		switch b := body.(type) {
+		case nil:
+		case string:
+			reqBody = []byte(b)
+		default:
+			var err error
+			reqBody, err = json.Marshal(b)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(reqBody))
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		respBody, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, respBody
+	}
+
+	It("reports health", func() {
+		code, body := do(http.MethodGet, "/healthz", nil)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(MatchJSON(`{"status": "ok"}`))
+
+		code, _ = do(http.MethodPost, "/healthz", nil)
+		Expect(code).To(Equal(http.StatusMethodNotAllowed))
+		code, _ = do(http.MethodGet, "/unknown", nil)
+		Expect(code).To(Equal(http.StatusNotFound))
+	})
+
+	It("puts, inspects, cancels and takes jobs", func(done Done) {
+		defer close(done)
+
+		code, body := do(http.MethodPost, "/jobs", protocol.HTTPJob{Body: []byte("generated")})
+		Expect(code).To(Equal(http.StatusCreated))
+		put := map[string]string{}
+		Expect(json.Unmarshal(body, &put)).To(Succeed())
+		Expect(put["id"]).NotTo(BeEmpty())
+
+		triggerAt := time.Now().Add(time.Hour)
+		code, _ = do(http.MethodPost, "/jobs", protocol.HTTPJob{ID: "a/b", Queue: "later", TriggerAt: &triggerAt, Tags: []string{"user-1"}})
+		Expect(code).To(Equal(http.StatusCreated))
+		code, body = do(http.MethodPost, "/jobs", protocol.HTTPJob{ID: "a/b", Queue: "later"})
+		Expect(code).To(Equal(http.StatusConflict))
+		Expect(string(body)).To(ContainSubstring(chronomq.ErrJobExists.Error()))
+
+		code, _ = do(http.MethodPost, "/jobs", `{"delay": 10}`)
+		Expect(code).To(Equal(http.StatusBadRequest))
+		code, _ = do(http.MethodPost, "/jobs", `{"delay": "1s", "triggerAt": "2030-01-01T00:00:00Z"}`)
+		Expect(code).To(Equal(http.StatusBadRequest))
+		code, _ = do(http.MethodPost, "/jobs", protocol.HTTPJob{Queue: "bad/queue"})
+		Expect(code).To(Equal(http.StatusBadRequest))
+		code, body = do(http.MethodPost, "/jobs", `{"triggerAt": "1970-01-01T00:00:00Z"}`)
+		Expect(code).To(Equal(http.StatusBadRequest))
+		Expect(string(body)).To(ContainSubstring(protocol.ErrInvalidTriggerAt.Error()))
+
+		code, body = do(http.MethodGet, "/jobs?queue=later&limit=5", nil)
+		Expect(code).To(Equal(http.StatusOK))
+		jobs := []protocol.HTTPJob{}
+		Expect(json.Unmarshal(body, &jobs)).To(Succeed())
+		Expect(jobs).To(HaveLen(1))
+		Expect(jobs[0].ID).To(Equal("a/b"))
+		Expect(jobs[0].Tags).To(Equal([]string{"user-1"}))
+		Expect(time.Duration(jobs[0].Delay)).To(BeNumerically("~", time.Hour, time.Minute))
+
+		code, _ = do(http.MethodDelete, "/jobs/a%2Fb?queue=later", nil)
+		Expect(code).To(Equal(http.StatusNoContent))
+		code, body = do(http.MethodGet, "/jobs?queue=later", nil)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(MatchJSON(`[]`))
+
+		code, body = do(http.MethodGet, "/jobs/next?timeout=1s&queue=later&queue=default", nil)
+		Expect(code).To(Equal(http.StatusOK))
+		job := protocol.HTTPJob{}
+		Expect(json.Unmarshal(body, &job)).To(Succeed())
+		Expect(job.ID).To(Equal(put["id"]))
+		Expect(job.Body).To(Equal([]byte("generated")))
+		Expect(job.Queue).To(Equal(chronomq.DefaultQueue))
+
+		code, _ = do(http.MethodGet, "/jobs/next?timeout=10ms", nil)
+		Expect(code).To(Equal(http.StatusNoContent))
+		code, _ = do(http.MethodGet, "/jobs/next?timeout=soon", nil)
+		Expect(code).To(Equal(http.StatusBadRequest))
+
+		code, body = do(http.MethodGet, "/queues", nil)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(MatchJSON(`["default", "later"]`))
+	}, 5)
+
+	It("reserves, releases and acks jobs with a ttr", func(done Done) {
+		defer close(done)
+
+		code, _ := do(http.MethodPost, "/jobs", `{"id": "ttr", "ttr": "1m", "body": "aGk=", "headers": {"type": "email"}}`)
+		Expect(code).To(Equal(http.StatusCreated))
+		code, body := do(http.MethodGet, "/jobs/next", nil)
+		Expect(code).To(Equal(http.StatusOK))
+		job := map[string]interface{}{}
+		Expect(json.Unmarshal(body, &job)).To(Succeed())
+		Expect(job).To(HaveKey("triggerAt"))
+		delete(job, "triggerAt")
+		Expect(job).To(Equal(map[string]interface{}{"id": "ttr", "ttr": "1m0s", "body": "aGk=", "queue": "default",
+			"headers": map[string]interface{}{"type": "email"}}))
+
+		code, _ = do(http.MethodPost, "/jobs/ttr/touch", nil)
+		Expect(code).To(Equal(http.StatusNoContent))
+		code, _ = do(http.MethodPost, "/jobs/ttr/release?delay=10ms", nil)
+		Expect(code).To(Equal(http.StatusNoContent))
+		code, _ = do(http.MethodGet, "/jobs/next?timeout=1s", nil)
+		Expect(code).To(Equal(http.StatusOK))
+		code, _ = do(http.MethodPost, "/jobs/ttr/ack", nil)
+		Expect(code).To(Equal(http.StatusNoContent))
+		code, _ = do(http.MethodPost, "/jobs/ttr/ack", nil)
+		Expect(code).To(Equal(http.StatusConflict))
+		code, _ = do(http.MethodPost, "/jobs/ttr/bury", nil)
+		Expect(code).To(Equal(http.StatusNotFound))
+	}, 5)
+
+	It("puts back jobs whose reply cannot be written", func(done Done) {
+		defer close(done)
+
+		code, _ := do(http.MethodPost, "/jobs", protocol.HTTPJob{ID: "undelivered", Body: []byte("body")})
+		Expect(code).To(Equal(http.StatusCreated))
+		req := httptest.NewRequest(http.MethodGet, "/jobs/next", nil)
+		protocol.NewHTTPServer(queues).ServeHTTP(failingWriter{httptest.NewRecorder()}, req)
+
+		code, body := do(http.MethodGet, "/jobs/next?timeout=1s", nil)
+		Expect(code).To(Equal(http.StatusOK))
+		job := protocol.HTTPJob{}
+		Expect(json.Unmarshal(body, &job)).To(Succeed())
+		Expect(job.ID).To(Equal("undelivered"))
+		Expect(job.Body).To(Equal([]byte("body")))
+	}, 5)
+})
+
+// failingWriter fails every write of a reply as if the client went away
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
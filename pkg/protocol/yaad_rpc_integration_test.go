@@ -1,8 +1,10 @@
 package protocol_test
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"net/rpc"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -21,6 +23,7 @@ var _ = Describe("Test rpc protocol:", func() {
 
 	var srv io.Closer
 	var h *chronomq.Hub
+	var addr string
 
 	BeforeEach(func(done Done) {
 		defer close(done)
@@ -31,7 +34,7 @@ var _ = Describe("Test rpc protocol:", func() {
 			Persister:      persistence.NewJournalPersister(store),
 			SpokeSpan:      time.Second * 5}
 		h = chronomq.NewHub(&opts)
-		addr := fmt.Sprintf(":%d", port)
+		addr = fmt.Sprintf(":%d", port)
 		srv, err = protocol.ServeRPC(h, addr)
 		Expect(err).NotTo(HaveOccurred())
 		port++
@@ -159,6 +162,225 @@ var _ = Describe("Test rpc protocol:", func() {
 		}
 	}, 20)
 
+	It("Puts jobs with priorities and reads them in priority order", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		ExpectNoErr(client.PutWithID("low", nil, 0, api.WithPriority(-5)))
+		ExpectNoErr(client.PutWithID("high", nil, 0, api.WithPriority(5)))
+		ExpectNoErr(client.PutWithID("default", nil, 0))
+
+		for _, id := range []string{"high", "default", "low"} {
+			job, err := client.NextJob(time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.ID).To(Equal(id))
+		}
+	}, 5)
+
+	It("Reserves a job with a ttr, releases and acks it", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		hw := "Hello world"
+		id, err := client.Put([]byte(hw), 0, api.WithTTR(time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+
+		job, err := client.NextJob(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.ID).To(Equal(id))
+		Expect(job.TTR).To(Equal(time.Minute))
+
+		// Reserved job isn't handed out again
+		_, _, err = client.Next(0)
+		Expect(err).To(MatchError(protocol.ErrTimeout.Error()))
+
+		ExpectNoErr(client.Touch(id))
+		ExpectNoErr(client.Release(id, 0))
+
+		rid, body, err := client.Next(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rid).To(Equal(id))
+		Expect(string(body)).To(Equal(hw))
+
+		ExpectNoErr(client.Ack(id))
+		Expect(client.Ack(id)).To(MatchError(chronomq.ErrJobNotReserved.Error()))
+	}, 5)
+
+	It("Puts jobs at an absolute trigger time", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		at := time.Now().Add(time.Millisecond * 200)
+		ExpectNoErr(client.PutAtWithID("at", []byte("at"), at))
+		id, err := client.PutAt([]byte("past"), time.Now().Add(-time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+
+		rpcJobs := []*api.Job{}
+		ExpectNoErr(client.InspectN(5, &rpcJobs))
+		Expect(rpcJobs).To(HaveLen(2))
+		for _, j := range rpcJobs {
+			if j.ID == "at" {
+				Expect(j.TriggerAt).To(BeTemporally("==", at))
+			}
+		}
+
+		job, err := client.NextJob(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.ID).To(Equal(id))
+		job, err = client.NextJob(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.ID).To(Equal("at"))
+		Expect(time.Now()).To(BeTemporally(">=", at))
+
+		// Bogus trigger times are rejected
+		Expect(client.PutAtWithID("zero", nil, time.Unix(0, 0))).To(MatchError(protocol.ErrInvalidTriggerAt.Error()))
+		_, err = client.PutAt(nil, time.Now().AddDate(100, 0, 0))
+		Expect(err).To(MatchError(protocol.ErrInvalidTriggerAt.Error()))
+		Expect(client.PutAtWithID("both", nil, time.Now(), func(j *api.Job) { j.Delay = time.Second })).
+			To(MatchError(protocol.ErrDelayAndTriggerAt.Error()))
+	}, 5)
+
+	It("Puts a recurring job and takes its occurrences", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		ExpectNoErr(client.PutWithID("tick", []byte("tick"), 0, api.WithSchedule("@every 1s", "Europe/Berlin", time.Time{})))
+		Expect(client.PutWithID("bad", nil, 0, api.WithSchedule("every second", "", time.Time{}))).To(HaveOccurred())
+		Expect(client.PutWithID("ended", nil, 0, api.WithSchedule("@daily", "", time.Now().Add(-time.Hour)))).
+			To(MatchError(chronomq.ErrNoOccurrence.Error()))
+
+		rpcJobs := []*api.Job{}
+		ExpectNoErr(client.InspectN(5, &rpcJobs))
+		Expect(rpcJobs).To(HaveLen(1))
+		Expect(rpcJobs[0].Cron).To(Equal("@every 1s"))
+		Expect(rpcJobs[0].Timezone).To(Equal("Europe/Berlin"))
+		Expect(rpcJobs[0].Occurrences).To(HaveLen(5))
+		Expect(rpcJobs[0].Occurrences[0]).To(BeTemporally("==", rpcJobs[0].TriggerAt))
+		Expect(rpcJobs[0].Occurrences[4].Sub(rpcJobs[0].Occurrences[0])).To(Equal(time.Second * 4))
+
+		for i := 0; i < 2; i++ {
+			job, err := client.NextJob(time.Second * 2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.ID).To(Equal("tick"))
+			Expect(string(job.Body)).To(Equal("tick"))
+		}
+		ExpectNoErr(client.Cancel("tick"))
+		_, _, err := client.Next(time.Millisecond * 1200)
+		Expect(err).To(MatchError(protocol.ErrTimeout.Error()))
+	}, 8)
+
+	It("Reschedules and updates a pending job", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		ExpectNoErr(client.PutWithID("reminder", []byte("old"), time.Hour))
+		at := time.Now().Add(time.Millisecond * 200)
+		ExpectNoErr(client.Reschedule("reminder", at))
+		ExpectNoErr(client.UpdateBody("reminder", []byte("new")))
+		Expect(client.Reschedule("reminder", time.Unix(0, 0))).To(MatchError(protocol.ErrInvalidTriggerAt.Error()))
+
+		job, err := client.NextJob(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.ID).To(Equal("reminder"))
+		Expect(string(job.Body)).To(Equal("new"))
+		Expect(job.TriggerAt).To(BeTemporally("==", at))
+
+		Expect(client.Reschedule("reminder", time.Now())).To(MatchError(chronomq.ErrJobNotFound.Error()))
+		Expect(client.UpdateBody("reminder", nil)).To(MatchError(chronomq.ErrJobNotFound.Error()))
+	}, 5)
+
+	It("Gets a job by id", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		at := time.Now().Add(time.Hour)
+		ExpectNoErr(client.PutAtWithID("later", []byte("later"), at, api.WithPriority(2)))
+		job, err := client.Get("later")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.ID).To(Equal("later"))
+		Expect(job.Queue).To(Equal(chronomq.DefaultQueue))
+		Expect(job.State).To(Equal(string(chronomq.JobPending)))
+		Expect(job.TriggerAt).To(BeTemporally("==", at))
+		Expect(job.Pri).To(Equal(int32(2)))
+		Expect(string(job.Body)).To(Equal("later"))
+
+		ExpectNoErr(client.PutWithID("ttr", nil, 0, api.WithTTR(time.Minute)))
+		_, err = client.NextJob(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		job, err = client.Get("ttr")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.State).To(Equal(string(chronomq.JobReserved)))
+
+		ExpectNoErr(client.Ack("ttr"))
+		_, err = client.Get("ttr")
+		Expect(err).To(MatchError(chronomq.ErrJobNotFound.Error()))
+		_, err = client.Use("unknown").Get("later")
+		Expect(err).To(MatchError(chronomq.ErrJobNotFound.Error()))
+	}, 5)
+
+	It("Drops jobs that expire before they are taken", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		err := client.PutWithID("stale", nil, time.Minute, api.WithExpiry(time.Now()))
+		Expect(errors.Is(err, api.ErrInvalidExpiry)).To(BeTrue())
+
+		expireAt := time.Now().Add(time.Millisecond * 100)
+		ExpectNoErr(client.PutWithID("stale", nil, 0, api.WithExpiry(expireAt)))
+		job, err := client.Get("stale")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.ExpireAt).To(BeTemporally("==", expireAt))
+
+		time.Sleep(time.Millisecond * 150)
+		_, _, err = client.Next(0)
+		Expect(errors.Is(err, api.ErrTimeout)).To(BeTrue())
+		Expect(h.Stats().ExpiredJobs).To(Equal(int64(1)))
+	}, 5)
+
+	It("Puts jobs with headers and returns them to consumers", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		headers := map[string]string{"type": "email", "locale": "de"}
+		ExpectNoErr(client.PutWithID("routed", []byte("body"), 0, api.WithHeaders(headers)))
+		ExpectNoErr(client.PutWithID("plain", nil, time.Hour))
+
+		rpcJobs := []*api.Job{}
+		ExpectNoErr(client.InspectN(5, &rpcJobs))
+		Expect(rpcJobs).To(HaveLen(2))
+		for _, j := range rpcJobs {
+			if j.ID == "routed" {
+				Expect(j.Headers).To(Equal(headers))
+			} else {
+				Expect(j.Headers).To(BeEmpty())
+			}
+		}
+
+		job, err := client.NextJob(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.ID).To(Equal("routed"))
+		Expect(job.Headers).To(Equal(headers))
+	}, 5)
+
+	It("Cancels jobs by tag and id prefix", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		ExpectNoErr(client.PutWithID("user-1/welcome", nil, time.Hour, api.WithTags("user-1")))
+		ExpectNoErr(client.PutWithID("reminder", nil, time.Hour*48, api.WithTags("user-1", "reminders")))
+		ExpectNoErr(client.PutWithID("user-2/welcome", nil, time.Hour, api.WithTags("user-2")))
+		job, err := client.Get("reminder")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Tags).To(Equal([]string{"user-1", "reminders"}))
+
+		Expect(client.CancelByTag("user-1")).To(Equal(2))
+		Expect(client.CancelByTag("user-1")).To(Equal(0))
+		Expect(client.Use("unknown").CancelByTag("user-2")).To(Equal(0))
+		Expect(client.CancelByPrefix("")).To(Equal(0))
+		Expect(client.CancelByPrefix("user-2/")).To(Equal(1))
+		Expect(h.Stats().CurrentJobs).To(Equal(int64(0)))
+	}, 5)
+
 	It("Puts a job and then deletes it", func(done Done) {
 		defer close(done)
 		defer GinkgoRecover()
@@ -170,4 +392,289 @@ var _ = Describe("Test rpc protocol:", func() {
 		//delete
 		ExpectNoErr(client.Cancel(id))
 	})
+
+	It("serves the default queue to clients of earlier releases", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+		old, err := rpc.Dial("tcp", addr)
+		Expect(err).NotTo(HaveOccurred())
+		defer old.Close()
+
+		id, err := client.Put([]byte("old"), 0)
+		Expect(err).NotTo(HaveOccurred())
+		var jobs []*api.Job
+		Expect(old.Call("RPCServer.InspectN", 10, &jobs)).To(Succeed())
+		Expect(jobs).To(HaveLen(1))
+		var job api.Job
+		Expect(old.Call("RPCServer.Next", time.Second, &job)).To(Succeed())
+		Expect(job.ID).To(Equal(id))
+		Expect(job.Body).To(Equal([]byte("old")))
+
+		id, err = client.Put([]byte("canceled"), time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		var ignoredReply int8
+		Expect(old.Call("RPCServer.Cancel", id, &ignoredReply)).To(Succeed())
+		Expect(old.Call("RPCServer.Cancel", id, &ignoredReply)).To(Succeed())
+		Expect(h.Stats().CurrentJobs).To(BeZero())
+	}, 5)
+})
+
+var _ = Describe("Test rpc protocol with named queues:", func() {
+	defer GinkgoRecover()
+	var port = 9401
+	var client *api.Client
+
+	var srv io.Closer
+	var queues *chronomq.QueueSet
+
+	BeforeEach(func(done Done) {
+		defer close(done)
+		queues = chronomq.NewQueueSet(func(queue string) (*chronomq.Hub, error) {
+			store, err := persistence.InMemStorage()
+			if err != nil {
+				return nil, err
+			}
+			return chronomq.NewHub(&chronomq.HubOpts{
+				Persister:   persistence.NewJournalPersister(store),
+				SpokeSpan:   time.Second * 5,
+				Queue:       queue,
+				Backoff:     chronomq.BackoffPolicy{MaxAttempts: 2},
+				DedupWindow: time.Minute}), nil
+		})
+		addr := fmt.Sprintf(":%d", port)
+		var err error
+		srv, err = protocol.ServeQueuesRPC(queues, addr)
+		Expect(err).NotTo(HaveOccurred())
+		port++
+
+		Eventually(func() error {
+			client, err = api.NewClient(addr)
+			return err
+		}, "1s").Should(BeNil())
+	}, 0.5)
+
+	AfterEach(func(done Done) {
+		defer close(done)
+		Expect(srv.Close()).To(Succeed())
+		queues.Stop(false)
+	})
+
+	It("keeps jobs of different queues apart", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		emails := client.Use("emails")
+		carts := client.Use("carts")
+		ExpectNoErr(emails.PutWithID("same", []byte("email"), 0))
+		ExpectNoErr(carts.PutWithID("same", []byte("cart"), 0))
+		Expect(client.Queues()).To(Equal([]string{"carts", "emails"}))
+
+		// Nothing in the default queue
+		_, _, err := client.Next(0)
+		Expect(err).To(MatchError(protocol.ErrTimeout.Error()))
+
+		rpcJobs := []*api.Job{}
+		ExpectNoErr(carts.InspectN(5, &rpcJobs))
+		Expect(rpcJobs).To(HaveLen(1))
+		Expect(rpcJobs[0].Queue).To(Equal("carts"))
+		Expect(string(rpcJobs[0].Body)).To(Equal("cart"))
+
+		ExpectNoErr(carts.Cancel("same"))
+		job, err := emails.NextJob(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Queue).To(Equal("emails"))
+		Expect(string(job.Body)).To(Equal("email"))
+		_, _, err = carts.Next(0)
+		Expect(err).To(MatchError(protocol.ErrTimeout.Error()))
+	}, 5)
+
+	It("takes jobs from all watched queues", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		ExpectNoErr(client.Use("a").PutWithID("a1", nil, 0, api.WithTTR(time.Minute)))
+		ExpectNoErr(client.Use("b").PutWithID("b1", nil, 0))
+		ExpectNoErr(client.Use("c").PutWithID("c1", nil, 0))
+
+		watcher := client.Watch("a", "b", "unknown")
+		got := map[string]string{}
+		for i := 0; i < 2; i++ {
+			job, err := watcher.NextJob(time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			got[job.ID] = job.Queue
+			if job.TTR > 0 {
+				ExpectNoErr(client.Use(job.Queue).Ack(job.ID))
+			}
+		}
+		Expect(got).To(Equal(map[string]string{"a1": "a", "b1": "b"}))
+		_, _, err := watcher.Next(0)
+		Expect(err).To(MatchError(protocol.ErrTimeout.Error()))
+
+		Expect(client.Use("bad/name").PutWithID("x", nil, 0)).To(MatchError(chronomq.ErrInvalidQueueName.Error()))
+	}, 5)
+
+	It("puts, takes and cancels jobs in batches", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		results, err := client.Use("batch").PutBatch([]api.Job{
+			{ID: "a", Body: []byte("a")},
+			{Body: []byte("generated")},
+			{ID: "a"},
+			{ID: "later", Delay: time.Hour},
+			{ID: "other", Queue: "other"},
+			{ID: "bad", Queue: "bad/name"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(6))
+		Expect(results[0]).To(Equal(api.PutResult{ID: "a"}))
+		Expect(results[1].ID).NotTo(BeEmpty())
+		Expect(results[1].Error).To(BeEmpty())
+		Expect(results[2].Duplicate).To(BeTrue())
+		Expect(results[2].Error).To(ContainSubstring(chronomq.ErrJobExists.Error()))
+		Expect(results[3]).To(Equal(api.PutResult{ID: "later"}))
+		Expect(results[4]).To(Equal(api.PutResult{ID: "other"}))
+		Expect(results[5].Duplicate).To(BeFalse())
+		Expect(results[5].Error).To(Equal(chronomq.ErrInvalidQueueName.Error()))
+		Expect(client.Queues()).To(Equal([]string{"batch", "other"}))
+
+		jobs, err := client.Watch("batch", "other").NextN(10, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		ids := map[string]string{}
+		for _, j := range jobs {
+			ids[j.ID] = j.Queue
+		}
+		Expect(ids).To(Equal(map[string]string{"a": "batch", results[1].ID: "batch", "other": "other"}))
+		_, err = client.Use("batch").NextN(10, 0)
+		Expect(err).To(MatchError(protocol.ErrTimeout.Error()))
+
+		canceled, err := client.Use("batch").CancelBatch([]string{"a", "later", "unknown"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(canceled).To(Equal([]bool{false, true, false}))
+		rpcJobs := []*api.Job{}
+		ExpectNoErr(client.Use("batch").InspectN(5, &rpcJobs))
+		Expect(rpcJobs).To(BeEmpty())
+	}, 5)
+
+	It("wakes up waiting consumers as soon as a job is ready", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		// Neither queue exists when the consumer starts waiting
+		jobs := make(chan *api.Job)
+		go func() {
+			defer GinkgoRecover()
+			job, err := client.Watch("fresh", "other").NextJob(time.Second * 2)
+			Expect(err).NotTo(HaveOccurred())
+			jobs <- job
+		}()
+
+		time.Sleep(time.Millisecond * 50)
+		triggerAt := time.Now().Add(time.Millisecond * 300)
+		ExpectNoErr(client.Use("fresh").PutAtWithID("wake", nil, triggerAt))
+		var job *api.Job
+		Eventually(jobs, time.Second).Should(Receive(&job))
+		Expect(job.ID).To(Equal("wake"))
+		Expect(time.Now()).To(BeTemporally("~", triggerAt, time.Millisecond*50))
+	}, 5)
+
+	It("puts jobs with duplicate policies and returns typed errors", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		orders := client.Use("orders")
+		ExpectNoErr(orders.PutWithID("order", []byte("v1"), time.Hour))
+		err := orders.PutWithID("order", []byte("v1"), time.Hour)
+		Expect(errors.Is(err, api.ErrJobExists)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring(chronomq.ErrJobExists.Error())))
+
+		// Retried puts of the same job succeed, different jobs with the same id don't
+		ExpectNoErr(orders.PutWithID("order", []byte("v1"), time.Hour, api.WithDuplicatePolicy(api.DuplicateIgnore)))
+		err = orders.PutWithID("order", []byte("v2"), time.Hour, api.WithDuplicatePolicy(api.DuplicateIgnore))
+		Expect(errors.Is(err, api.ErrJobExists)).To(BeTrue())
+
+		ExpectNoErr(orders.PutWithID("order", []byte("v2"), 0, api.WithDuplicatePolicy(api.DuplicateReplace)))
+		job, err := orders.NextJob(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(job.Body)).To(Equal("v2"))
+
+		// The id of the consumed job is remembered for the dedup window
+		err = orders.PutWithID("order", []byte("v2"), 0)
+		Expect(errors.Is(err, api.ErrJobExists)).To(BeTrue())
+		results, err := orders.PutBatch([]api.Job{
+			{ID: "order", OnDuplicate: api.DuplicateIgnore},
+			{ID: "new", OnDuplicate: api.DuplicateIgnore},
+			{ID: "new", Body: []byte("new"), OnDuplicate: api.DuplicateReplace},
+			{ID: "bad", OnDuplicate: api.DuplicatePolicy(9)},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(Equal([]api.PutResult{
+			{ID: "order", Ignored: true},
+			{ID: "new"},
+			{ID: "new", Replaced: true},
+			{ID: "bad", Error: protocol.ErrInvalidDuplicatePolicy.Error()},
+		}))
+		job, err = orders.NextJob(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(job.Body)).To(Equal("new"))
+
+		_, err = orders.Get("unknown")
+		Expect(errors.Is(err, api.ErrJobNotFound)).To(BeTrue())
+		Expect(errors.Is(err, api.ErrJobExists)).To(BeFalse())
+		_, _, err = orders.Next(0)
+		Expect(errors.Is(err, api.ErrTimeout)).To(BeTrue())
+	}, 5)
+
+	It("retries nacked jobs and dead-letters them after the max attempts", func(done Done) {
+		defer close(done)
+		defer GinkgoRecover()
+
+		jobs := client.Use("jobs")
+		ExpectNoErr(jobs.PutWithID("flaky", []byte("flaky"), 0, api.WithTTR(time.Minute)))
+		_, err := jobs.Nack("flaky")
+		Expect(err).To(MatchError(chronomq.ErrJobNotReserved.Error()))
+
+		for attempt := 0; attempt < 2; attempt++ {
+			job, err := jobs.NextJob(time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.ID).To(Equal("flaky"))
+			Expect(job.Attempts).To(Equal(int32(attempt)))
+			dead, err := jobs.Nack("flaky")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dead).To(Equal(attempt == 1))
+		}
+		_, _, err = jobs.Next(0)
+		Expect(err).To(MatchError(protocol.ErrTimeout.Error()))
+
+		deadJobs, err := jobs.DeadLetters(10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deadJobs).To(HaveLen(1))
+		Expect(deadJobs[0].ID).To(Equal("flaky"))
+		Expect(deadJobs[0].Queue).To(Equal("jobs"))
+		Expect(deadJobs[0].Attempts).To(Equal(int32(2)))
+		Expect(deadJobs[0].DeadAt).NotTo(BeZero())
+		dead, err := jobs.DeadLetter("flaky")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(dead.Body)).To(Equal("flaky"))
+		_, err = jobs.DeadLetter("unknown")
+		Expect(err).To(MatchError(chronomq.ErrJobNotDead.Error()))
+
+		ExpectNoErr(jobs.RequeueDeadLetter("flaky", 0))
+		Expect(jobs.RequeueDeadLetter("flaky", 0)).To(MatchError(chronomq.ErrJobNotDead.Error()))
+		job, err := jobs.NextJob(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.ID).To(Equal("flaky"))
+		Expect(job.Attempts).To(BeZero())
+
+		Expect(jobs.Nack("flaky")).To(BeFalse())
+		job, err = jobs.NextJob(time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(jobs.Nack(job.ID)).To(BeTrue())
+		purged, err := jobs.PurgeDeadLetters()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(purged).To(Equal(1))
+		deadJobs, err = jobs.DeadLetters(10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deadJobs).To(BeEmpty())
+	}, 5)
 })
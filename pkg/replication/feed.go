@@ -0,0 +1,159 @@
+// Package replication streams the mutations of a primary server's hubs to standby replicas. A replica keeps
+// hubs identical to the primary's in memory and serves no clients till it is promoted, e.g. once the primary
+// failed. Promoted replicas serve right away without restoring a snapshot.
+//
+// Replication is asynchronous: mutations the primary acknowledged shortly before it failed may be missing on
+// the replica. Jobs reserved on the primary are pending on the replica, like after a restart
+package replication
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+// feedBuffer is the number of mutations buffered for every replica. Replicas that fall further behind are
+// disconnected and sync again
+const feedBuffer = 10000
+
+// message is sent from the primary to its replicas
+type message struct {
+	Queue  string
+	Record persistence.Record
+	Synced bool // Sent once all jobs the primary held when the replica connected were sent
+}
+
+// Feed publishes the mutations of the hubs of a primary to the connected replicas.
+// It is safe to call methods on Feed from multiple goroutines
+type Feed struct {
+	codec persistence.Codec
+	subs  map[*subscriber]struct{}
+	lock  *sync.RWMutex
+}
+
+// subscriber is a connected replica
+type subscriber struct {
+	messages chan message
+	dropped  chan struct{} // Closed when the replica fell too far behind
+	once     *sync.Once
+}
+
+func (s *subscriber) drop() {
+	s.once.Do(func() {
+		close(s.dropped)
+	})
+}
+
+// NewFeed creates a feed encoding jobs with the given codec. persistence.GobCodec is used if codec is nil
+func NewFeed(codec persistence.Codec) *Feed {
+	if codec == nil {
+		codec = persistence.GobCodec
+	}
+	return &Feed{codec: codec, subs: make(map[*subscriber]struct{}), lock: &sync.RWMutex{}}
+}
+
+// WAL returns the write-ahead log for the hub of a queue. Every record is appended to wal, if not nil,
+// and then published to the replicas. Use it as the hub's HubOpts.WAL
+func (f *Feed) WAL(queue string, wal persistence.WAL) persistence.WAL {
+	return &feedWAL{feed: f, queue: queue, wal: wal}
+}
+
+func (f *Feed) subscribe() *subscriber {
+	s := &subscriber{messages: make(chan message, feedBuffer), dropped: make(chan struct{}), once: &sync.Once{}}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.subs[s] = struct{}{}
+	return s
+}
+
+func (f *Feed) unsubscribe(s *subscriber) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.subs, s)
+}
+
+// subscribed returns true if any replica is connected
+func (f *Feed) subscribed() bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return len(f.subs) > 0
+}
+
+// publish sends a message to all replicas without blocking. Replicas whose buffer is full are dropped
+func (f *Feed) publish(m message) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	for s := range f.subs {
+		select {
+		case s.messages <- m:
+		default:
+			log.Warn().Msg("Replication: Replica fell behind. Disconnecting it")
+			s.drop()
+		}
+	}
+}
+
+// feedWAL publishes the records of a hub's write-ahead log
+type feedWAL struct {
+	feed  *Feed
+	queue string
+	wal   persistence.WAL // Optional write-ahead log of the hub
+}
+
+// Append appends the record to the hub's write-ahead log and then publishes it
+func (w *feedWAL) Append(op persistence.Op, id string, e persistence.Entry) error {
+	if w.wal != nil {
+		if err := w.wal.Append(op, id, e); err != nil {
+			return err
+		}
+	}
+	// Records are only encoded for replicas
+	if !w.feed.subscribed() {
+		return nil
+	}
+	r := persistence.Record{Op: op, ID: id}
+	if op == persistence.OpPut {
+		var err error
+		if r.Data, err = w.feed.codec.Encode(e); err != nil {
+			return err
+		}
+	}
+	w.feed.publish(message{Queue: w.queue, Record: r})
+	return nil
+}
+
+// Rotate rotates the hub's write-ahead log if it has one
+func (w *feedWAL) Rotate(min uint64) (uint64, error) {
+	if w.wal == nil {
+		return min, nil
+	}
+	return w.wal.Rotate(min)
+}
+
+// Truncate truncates the hub's write-ahead log if it has one
+func (w *feedWAL) Truncate(seq uint64) error {
+	if w.wal == nil {
+		return nil
+	}
+	return w.wal.Truncate(seq)
+}
+
+// Replay replays the hub's write-ahead log. Nothing is replayed if the hub has none
+func (w *feedWAL) Replay(from uint64) (chan persistence.Record, error) {
+	if w.wal == nil {
+		records := make(chan persistence.Record)
+		close(records)
+		return records, nil
+	}
+	return w.wal.Replay(from)
+}
+
+// Close closes the hub's write-ahead log if it has one
+func (w *feedWAL) Close() error {
+	if w.wal == nil {
+		return nil
+	}
+	return w.wal.Close()
+}
@@ -0,0 +1,18 @@
+package replication_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestReplication(t *testing.T) {
+	defer GinkgoRecover()
+
+	log.Logger = zerolog.New(GinkgoWriter)
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Replication Suite")
+}
@@ -0,0 +1,140 @@
+package replication_test
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+	"github.com/chronomq/chronomq/pkg/replication"
+)
+
+var _ = Describe("Test standby replicas", func() {
+	port := 9901
+	var addr string
+	var feed *replication.Feed
+	var primary *chronomq.QueueSet
+	var srv io.Closer
+	var standby *replication.Standby
+
+	newHub := func(wal func(queue string) persistence.WAL) chronomq.HubFactory {
+		return func(queue string) (*chronomq.Hub, error) {
+			store, err := persistence.InMemStorage()
+			if err != nil {
+				return nil, err
+			}
+			opts := &chronomq.HubOpts{
+				Persister: persistence.NewJournalPersister(store),
+				SpokeSpan: time.Second * 5,
+				Queue:     queue,
+			}
+			if wal != nil {
+				opts.WAL = wal(queue)
+			}
+			return chronomq.NewHub(opts), nil
+		}
+	}
+
+	put := func(queue string, id string, delay time.Duration) {
+		hub, err := primary.Hub(queue)
+		Expect(err).NotTo(HaveOccurred())
+		j := chronomq.NewJob(id, time.Now().Add(delay), []byte(id))
+		j.SetTags("t")
+		Expect(hub.AddJobLocked(j)).To(Succeed())
+	}
+
+	serve := func() {
+		var err error
+		srv, err = replication.Serve(feed, primary, addr)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		addr = fmt.Sprintf("127.0.0.1:%d", port)
+		port++
+		feed = replication.NewFeed(persistence.ProtobufCodec)
+		primary = chronomq.NewQueueSet(newHub(func(queue string) persistence.WAL {
+			return feed.WAL(queue, nil)
+		}))
+		serve()
+		standby = nil
+	})
+
+	AfterEach(func() {
+		if srv != nil {
+			Expect(srv.Close()).To(Succeed())
+		}
+		primary.Stop(false)
+		if standby != nil {
+			standby.Stop(false)
+		}
+	})
+
+	It("replicates jobs held before and mutated after the replica connected", func() {
+		put("", "pending", time.Minute)
+		put("emails", "canceled", time.Minute)
+		put("emails", "consumed", 0)
+
+		standby = replication.Follow(addr, newHub(nil))
+		_, err := standby.Queues()
+		Expect(err).To(MatchError(replication.ErrStandby))
+		Eventually(standby.Synced, "2s").Should(BeTrue())
+
+		put("emails", "later", time.Minute)
+		hub := primary.Lookup("emails")
+		_, err = hub.CancelJobLocked("canceled")
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() *chronomq.Job { return hub.NextLocked() }, "1s").ShouldNot(BeNil())
+		Eventually(standby.Applied, "2s").Should(Equal(uint64(3)))
+
+		Expect(standby.Promote()).To(Succeed())
+		queues, err := standby.Queues()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queues.Names()).To(Equal([]string{"default", "emails"}))
+		j, state, err := queues.Lookup("").GetJobLocked("pending")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(chronomq.JobPending))
+		Expect(j.Tags()).To(Equal([]string{"t"}))
+		emails := queues.Lookup("emails")
+		_, _, err = emails.GetJobLocked("later")
+		Expect(err).NotTo(HaveOccurred())
+		for _, id := range []string{"canceled", "consumed"} {
+			_, _, err = emails.GetJobLocked(id)
+			Expect(err).To(MatchError(chronomq.ErrJobNotFound), id)
+		}
+	})
+
+	It("syncs again after losing the primary", func() {
+		put("", "first", time.Minute)
+		standby = replication.Follow(addr, newHub(nil))
+		Eventually(standby.Synced, "2s").Should(BeTrue())
+
+		Expect(srv.Close()).To(Succeed())
+		Eventually(standby.Synced, "2s").Should(BeFalse())
+		// Missed while the replica was disconnected
+		put("", "second", time.Minute)
+		_, err := primary.Lookup("").CancelJobLocked("first")
+		Expect(err).NotTo(HaveOccurred())
+		serve()
+		Eventually(standby.Synced, "5s").Should(BeTrue())
+
+		Expect(standby.Promote()).To(Succeed())
+		queues, err := standby.Queues()
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = queues.Lookup("").GetJobLocked("second")
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = queues.Lookup("").GetJobLocked("first")
+		Expect(err).To(MatchError(chronomq.ErrJobNotFound))
+	})
+
+	It("is not promoted before it synced", func() {
+		standby = replication.Follow("127.0.0.1:1", newHub(nil))
+		Expect(standby.Promote()).To(MatchError(replication.ErrNotSynced))
+		_, err := standby.Queues()
+		Expect(err).To(MatchError(replication.ErrStandby))
+	})
+})
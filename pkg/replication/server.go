@@ -0,0 +1,122 @@
+package replication
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronomq/chronomq/pkg/chronomq"
+	"github.com/chronomq/chronomq/pkg/persistence"
+)
+
+// server streams the jobs of a primary's queues and the mutations of its feed to replicas
+type server struct {
+	feed     *Feed
+	queues   *chronomq.QueueSet
+	listener net.Listener
+
+	conns map[net.Conn]struct{}
+	lock  *sync.Mutex
+}
+
+// Serve streams the queues of a primary to the replicas connecting on addr. The hubs of the queues must
+// journal to the feed's write-ahead logs, see Feed.WAL. Close the returned closer to disconnect all replicas
+func Serve(feed *Feed, queues *chronomq.QueueSet, addr string) (io.Closer, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "Replication: Cannot listen for replicas")
+	}
+	srv := &server{feed: feed, queues: queues, listener: l, conns: make(map[net.Conn]struct{}), lock: &sync.Mutex{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				log.Error().Err(err).Msg("Replication: Cannot handle replica connection")
+				return
+			}
+			go srv.stream(conn)
+		}
+	}()
+	return srv, nil
+}
+
+// Close stops listening and disconnects all replicas
+func (srv *server) Close() error {
+	err := srv.listener.Close()
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	for conn := range srv.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// stream sends all jobs and then every mutation to a replica till it disconnects or falls behind
+func (srv *server) stream(conn net.Conn) {
+	srv.lock.Lock()
+	srv.conns[conn] = struct{}{}
+	srv.lock.Unlock()
+	defer func() {
+		srv.lock.Lock()
+		delete(srv.conns, conn)
+		srv.lock.Unlock()
+		conn.Close()
+	}()
+	addr := conn.RemoteAddr().String()
+	log.Info().Str("replica", addr).Msg("Replication: Replica connected")
+
+	// Subscribe before reading the jobs so that no mutation in between is missed.
+	// Mutations of jobs that are sent anyway are applied again, which changes nothing
+	sub := srv.feed.subscribe()
+	defer srv.feed.unsubscribe(sub)
+
+	w := bufio.NewWriter(conn)
+	enc := gob.NewEncoder(w)
+	err := srv.sync(enc)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Error().Err(err).Str("replica", addr).Msg("Replication: Cannot sync replica")
+		return
+	}
+	log.Info().Str("replica", addr).Msg("Replication: Replica synced. Streaming mutations")
+	for {
+		select {
+		case m := <-sub.messages:
+			err = enc.Encode(m)
+			// Batch the writes of busy primaries
+			if err == nil && len(sub.messages) == 0 {
+				err = w.Flush()
+			}
+			if err != nil {
+				log.Error().Err(err).Str("replica", addr).Msg("Replication: Replica disconnected")
+				return
+			}
+		case <-sub.dropped:
+			return
+		}
+	}
+}
+
+// sync sends all jobs the queues hold
+func (srv *server) sync(enc *gob.Encoder) error {
+	for _, queue := range srv.queues.Names() {
+		for _, j := range srv.queues.Lookup(queue).JobsLocked() {
+			data, err := srv.feed.codec.Encode(j)
+			if err != nil {
+				return err
+			}
+			r := persistence.Record{Op: persistence.OpPut, ID: j.ID(), Data: data}
+			if err := enc.Encode(message{Queue: queue, Record: r}); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.Encode(message{Synced: true})
+}
@@ -0,0 +1,229 @@
+package replication
+
+import (
+	"bufio"
+	"encoding/gob"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/chronomq/chronomq/pkg/chronomq"
+)
+
+// ErrStandby is returned to clients of a replica that was not promoted. Its message ends like the message of
+// the errors of replicated clusters' followers, so that clients see the same error
+var ErrStandby = errors.New("Standby replica. Not the leader")
+
+// ErrNotSynced is returned when promoting a replica that never synced with its primary
+var ErrNotSynced = errors.New("Replica never synced with the primary")
+
+const (
+	dialTimeout    = time.Second * 5
+	reconnectDelay = time.Second // How long a replica waits before connecting to its primary again
+)
+
+// Standby is a replica of a primary server. It is safe to call methods on Standby from multiple goroutines
+type Standby struct {
+	primary string
+	factory chronomq.HubFactory
+
+	queues   *chronomq.QueueSet // Hubs identical to the primary's as of the last sync. Nil till the first sync
+	promoted bool
+	conn     net.Conn // Connection to the primary. Nil while disconnected
+	synced   bool     // True once the primary sent all of its jobs on the current connection
+	applied  uint64   // Mutations applied since the last sync
+	lock     *sync.Mutex
+
+	stop chan struct{}
+	done chan struct{} // Closed once the replica stopped following the primary
+}
+
+// Follow starts a replica of the primary streaming on addr, see Serve. Hubs are created with the factory.
+// They must not journal to the primary's write-ahead logs or store. The replica reconnects and syncs again
+// till it is promoted or stopped
+func Follow(addr string, factory chronomq.HubFactory) *Standby {
+	s := &Standby{
+		primary: addr,
+		factory: factory,
+		lock:    &sync.Mutex{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.follow()
+	return s
+}
+
+func (s *Standby) follow() {
+	defer close(s.done)
+	for {
+		err := s.sync()
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		log.Error().Err(err).Str("primary", s.primary).Msg("Replication: Lost primary. Reconnecting")
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// sync connects to the primary and applies its jobs and mutations till the connection breaks.
+// The replica's hubs are replaced once the primary sent all of its jobs
+func (s *Standby) sync() error {
+	conn, err := net.DialTimeout("tcp", s.primary, dialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if !s.setConn(conn) {
+		return nil
+	}
+	defer s.setConn(nil)
+	log.Info().Str("primary", s.primary).Msg("Replication: Connected to primary. Syncing")
+
+	queues := chronomq.NewQueueSet(s.factory)
+	synced := false
+	defer func() {
+		if !synced {
+			queues.Stop(false)
+		}
+	}()
+	dec := gob.NewDecoder(bufio.NewReader(conn))
+	for {
+		var m message
+		if err := dec.Decode(&m); err != nil {
+			return errors.Wrap(err, "Replication: Cannot read from primary")
+		}
+		if m.Synced {
+			synced = s.swap(queues)
+			continue
+		}
+		hub, err := queues.Hub(m.Queue)
+		if err != nil {
+			return err
+		}
+		if err := hub.ApplyLocked(m.Record); err != nil {
+			log.Error().Err(err).Str("queue", m.Queue).Str("jobID", m.Record.ID).Msg("Replication: Cannot apply mutation")
+		}
+		if synced {
+			s.lock.Lock()
+			s.applied++
+			s.lock.Unlock()
+		}
+	}
+}
+
+// setConn sets the connection to the primary. Returns false if the replica stopped following
+func (s *Standby) setConn(conn net.Conn) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if conn != nil && (s.promoted || isClosed(s.stop)) {
+		return false
+	}
+	s.conn = conn
+	s.synced = false
+	return true
+}
+
+// swap replaces the replica's hubs with freshly synced ones. Returns false if the replica was promoted meanwhile
+func (s *Standby) swap(queues *chronomq.QueueSet) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.promoted {
+		return false
+	}
+	old := s.queues
+	s.queues = queues
+	s.synced = true
+	s.applied = 0
+	if old != nil {
+		go old.Stop(false)
+	}
+	log.Info().Str("primary", s.primary).Strs("queues", queues.Names()).Msg("Replication: Synced with primary")
+	return true
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// unfollow stops following the primary and waits till the replica applied its last mutation
+func (s *Standby) unfollow() {
+	s.lock.Lock()
+	if !isClosed(s.stop) {
+		close(s.stop)
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.lock.Unlock()
+	<-s.done
+}
+
+// Promote stops following the primary. From now on the replica serves clients with the hubs of the last sync.
+// Make sure that the primary is down or does not serve clients anymore
+func (s *Standby) Promote() error {
+	s.lock.Lock()
+	synced := s.queues != nil
+	s.lock.Unlock()
+	// Hubs are only replaced by other synced hubs, so the replica stays synced
+	if !synced {
+		return ErrNotSynced
+	}
+	s.unfollow()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.promoted {
+		s.promoted = true
+		log.Info().Str("primary", s.primary).Strs("queues", s.queues.Names()).Msg("Replication: Promoted replica")
+	}
+	return nil
+}
+
+// Synced returns true while the replica is connected to its primary and holds all of the primary's jobs
+func (s *Standby) Synced() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.synced
+}
+
+// Applied returns the number of mutations applied since the replica last synced with its primary
+func (s *Standby) Applied() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.applied
+}
+
+// Queues returns the queues to serve once the replica was promoted. Returns ErrStandby before
+func (s *Standby) Queues() (*chronomq.QueueSet, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.promoted {
+		return nil, ErrStandby
+	}
+	return s.queues, nil
+}
+
+// Stop stops following the primary and stops the hubs. The hubs of a promoted replica are persisted if persist
+// is true, the hubs of a replica that wasn't promoted never are. See Hub.Stop
+func (s *Standby) Stop(persist bool) {
+	s.unfollow()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.queues != nil {
+		s.queues.Stop(persist && s.promoted)
+	}
+}